@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// jsonContaining matches a jsonb argument containing all of the given fragments
+type jsonContaining []string
+
+func (j jsonContaining) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+
+	for _, x := range j {
+		if !strings.Contains(string(b), x) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func foodRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "known_as", "country_id", "make_year", "slug", "description", "created_at", "updated_at", "version",
+		"id", "country_name", "created_at", "updated_at"})
+}
+
+func tasteRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "taste", "created_at", "updated_at"})
+}
+
+func TestApplication_DeleteFood_Audited(t *testing.T) {
+	app, mock := newMockedApp(t)
+	admin := testUser(t, "secret")
+
+	// the full row, as it was before the delete, must be written to the audit log in the
+	// same transaction as the delete
+	mock.ExpectBegin()
+	mock.ExpectQuery("from foods f").
+		WithArgs(3).
+		WillReturnRows(foodRows().AddRow(3, "Hamburger", 1, 2022, "hamburger", "Hamburger description", time.Now(), time.Now(), 1,
+			1, "USA", time.Now(), time.Now()))
+	mock.ExpectQuery("from tastes").
+		WithArgs(3).
+		WillReturnRows(tasteRows().AddRow(5, "salty", time.Now(), time.Now()))
+	mock.ExpectExec("delete from foods").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("insert into audit_events").
+		WithArgs(1, "delete", "food", 3,
+			jsonContaining{`"known_as":"Hamburger"`, `"description":"Hamburger description"`, `"country_name":"USA"`, `"taste":"salty"`},
+			nil, "192.0.2.1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rr := httptest.NewRecorder()
+	app.DeleteFood(rr, meRequest("POST", "/admin/foods/delete", `{"id": 3}`, admin))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("DeleteFood returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplication_DeleteFood_AuditFailureRollsBack(t *testing.T) {
+	app, mock := newMockedApp(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("from foods f").
+		WillReturnRows(foodRows().AddRow(3, "Hamburger", 1, 2022, "hamburger", "", time.Now(), time.Now(), 1,
+			1, "USA", time.Now(), time.Now()))
+	mock.ExpectQuery("from tastes").WillReturnRows(tasteRows())
+	mock.ExpectExec("delete from foods").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("insert into audit_events").WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	rr := httptest.NewRecorder()
+	app.DeleteFood(rr, meRequest("POST", "/admin/foods/delete", `{"id": 3}`, testUser(t, "secret")))
+
+	if rr.Code == http.StatusOK {
+		t.Error("DeleteFood succeeded even though the audit event could not be written")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplication_EditFood_AuditedDiff(t *testing.T) {
+	app, mock := newMockedApp(t)
+
+	// only the description changes, so only the description is recorded
+	mock.ExpectBegin()
+	mock.ExpectQuery("from foods f").
+		WithArgs(3).
+		WillReturnRows(foodRows().AddRow(3, "Hamburger", 1, 2022, "hamburger", "old", time.Now(), time.Now(), 1,
+			1, "USA", time.Now(), time.Now()))
+	mock.ExpectQuery("from tastes").WillReturnRows(tasteRows())
+	mock.ExpectExec("update foods set").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("insert into audit_events").
+		WithArgs(1, "update", "food", 3, []byte(`{"description":"old"}`), []byte(`{"description":"new"}`),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := `{"id": 3, "known_as": "Hamburger", "country_id": 1, "make_year": 2022, "description": "new", "version": 1}`
+
+	rr := httptest.NewRecorder()
+	app.EditFood(rr, meRequest("POST", "/admin/foods/save", body, testUser(t, "secret")))
+
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("EditFood returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplication_AuditLog(t *testing.T) {
+	app, mock := newMockedApp(t)
+
+	since := "2022-01-01T00:00:00Z"
+	sinceTime, _ := time.Parse(time.RFC3339, since)
+
+	rows := sqlmock.NewRows([]string{"id", "actor_id", "action", "entity_type", "entity_id", "before", "after", "ip",
+		"request_id", "created_at", "total"})
+	mock.ExpectQuery("from audit_events where entity_type = \\$1 and actor_id = \\$2 and created_at >= \\$3").
+		WithArgs("food", 2, sinceTime, 10, 10).
+		WillReturnRows(rows.AddRow(1, 2, "delete", "food", 3, []byte(`{"known_as":"Hamburger"}`), nil, "192.0.2.1",
+			"req-1", time.Now(), 11))
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/audit?entity=food&actor=2&since="+since+"&page=2&page_size=10", nil)
+	app.AuditLog(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("AuditLog returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if !strings.Contains(rr.Body.String(), `"known_as": "Hamburger"`) || !strings.Contains(rr.Body.String(), `"total": 11`) {
+		t.Errorf("AuditLog returned unexpected body: %s", rr.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// bad filters are rejected before we go near the database
+	for _, qs := range []string{"since=yesterday", "actor=bob", "page=0", "page_size=1000"} {
+		rr = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/admin/audit?"+qs, nil)
+		app.AuditLog(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("AuditLog accepted %s, status code %d", qs, rr.Code)
+		}
+	}
+}
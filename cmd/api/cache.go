@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cacheableWriter is the ResponseWriter handed to routes wrapped in Cacheable. When a
+// handler writes a successful response to it with writeJSON, the response gets an ETag and
+// the route's Cache-Control, and a conditional request for what the client already has is
+// answered with 304 Not Modified instead.
+type cacheableWriter struct {
+	http.ResponseWriter
+	r            *http.Request
+	cacheControl string
+}
+
+// Cacheable returns middleware for a GET route whose responses may be cached, as described
+// by cacheControl, such as "public, max-age=60". An empty cacheControl sends no
+// Cache-Control header, but still answers conditional requests.
+func (app *application) Cacheable(cacheControl string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&cacheableWriter{ResponseWriter: w, r: r, cacheControl: cacheControl}, r)
+		})
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (w *cacheableWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// notModified sets the caching headers for body, and reports whether the request's
+// conditions show the client already has it. If-None-Match is checked against the ETag;
+// only when there is none is If-Modified-Since checked against any Last-Modified header the
+// handler set.
+func (w *cacheableWriter) notModified(body []byte) bool {
+	etag := strongETag(body)
+
+	h := w.Header()
+	h.Set("ETag", etag)
+	if w.cacheControl != "" {
+		h.Set("Cache-Control", w.cacheControl)
+	}
+
+	if inm := w.r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	ims, err := http.ParseTime(w.r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(ims)
+}
+
+// strongETag returns a strong entity tag for body, derived from its content
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header value header matches etag. Weak
+// tags match their strong equivalent, as If-None-Match uses the weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastModified returns a Last-Modified header for the latest of times, for writeJSON
+func lastModified(times ...time.Time) http.Header {
+	var latest time.Time
+	for _, t := range times {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+
+	h := http.Header{}
+	if !latest.IsZero() {
+		h.Set("Last-Modified", latest.UTC().Format(http.TimeFormat))
+	}
+
+	return h
+}
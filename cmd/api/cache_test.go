@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+func TestCacheable(t *testing.T) {
+	updated := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	app := testApp
+	app.models.Food = fakeFoods{foods: map[string]*data.Food{
+		"hamburger": {ID: 1, KnownAs: "Hamburger", Slug: "hamburger", UpdatedAt: updated},
+	}}
+	handler := app.Cacheable("public, max-age=300")(http.HandlerFunc(app.OneFood))
+
+	get := func(slug string, headers map[string]string) *httptest.ResponseRecorder {
+		req := requestWithURLParam(httptest.NewRequest("GET", "/foods/"+slug, nil), "slug", slug)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("hamburger", nil)
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag, got %d %v", rr.Code, rr.Header())
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "public, max-age=300" {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+	if got := rr.Header().Get("Last-Modified"); got != "Fri, 01 Mar 2024 12:00:00 GMT" {
+		t.Errorf("unexpected Last-Modified %q", got)
+	}
+
+	if again := get("hamburger", nil); again.Header().Get("ETag") != etag {
+		t.Errorf("ETag changed between identical responses: %s, %s", etag, again.Header().Get("ETag"))
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"matching etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"one of several etags", map[string]string{"If-None-Match": `"other", W/` + etag}, http.StatusNotModified},
+		{"any etag", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"stale etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": "Thu, 29 Feb 2024 12:00:00 GMT"}, http.StatusOK},
+		{"etag takes precedence", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rr := get("hamburger", tt.headers)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, rr.Code)
+		}
+		if rr.Code == http.StatusNotModified && (rr.Body.Len() != 0 || rr.Header().Get("ETag") != etag) {
+			t.Errorf("%s: expected an empty 304 with the ETag, got %q %v", tt.name, rr.Body.String(), rr.Header())
+		}
+	}
+
+	// errors are not cached
+	rr = get("pizza", map[string]string{"If-None-Match": "*"})
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("ETag") != "" || rr.Header().Get("Cache-Control") != "" {
+		t.Errorf("expected an uncached 400 for a missing food, got %d %v", rr.Code, rr.Header())
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/food/pkg/client"
+)
+
+// newClientServer serves app's routes, through wrap if it is given, and returns a client
+// for them which retries quickly, configured by opts
+func newClientServer(t *testing.T, app *application, wrap func(http.Handler) http.Handler, opts ...client.Option) *client.Client {
+	t.Helper()
+
+	handler := app.routes()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	opts = append([]client.Option{client.WithHTTPClient(srv.Client()), client.WithRetries(3, time.Millisecond, 5*time.Millisecond)}, opts...)
+	return client.New(srv.URL, opts...)
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newClientServer(t, newMemoryApp(t), nil)
+
+	if _, err := c.Me(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized before logging in, got %v", err)
+	}
+	if _, err := c.Login(ctx, "alice@example.com", "wrong"); err == nil {
+		t.Error("logged in with the wrong password")
+	}
+
+	me, err := c.Login(ctx, "alice@example.com", "alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.FirstName != "Alice" || c.Token() == "" {
+		t.Fatalf("unexpected login: %+v", me)
+	}
+	if valid, err := c.ValidateToken(ctx, c.Token()); err != nil || !valid {
+		t.Errorf("expected the token to be valid, got %v %v", valid, err)
+	}
+
+	// foods
+	foods, err := c.ListFoods(ctx)
+	if err != nil || len(foods) != 3 {
+		t.Fatalf("expected 3 foods, got %d %v", len(foods), err)
+	}
+	if food, err := c.GetFoodBySlug(ctx, foods[0].Slug); err != nil || food.ID != foods[0].ID {
+		t.Errorf("could not get %s by slug: %v", foods[0].Slug, err)
+	}
+
+	food, err := c.CreateFood(ctx, client.FoodInput{KnownAs: "Burrito", CountryID: 3, MakeYear: 1900, TasteIDs: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if food.Slug != "burrito" || food.Version != 1 || len(food.Tastes) != 1 {
+		t.Errorf("unexpected food %+v", food)
+	}
+
+	food, err = c.PatchFood(ctx, food.ID, food.Version, client.MergePatch{"description": "wrapped"})
+	if err != nil || food.Description != "wrapped" || food.KnownAs != "Burrito" || food.Version != 2 {
+		t.Fatalf("unexpected patched food %+v: %v", food, err)
+	}
+	if _, err := c.PatchFood(ctx, food.ID, 1, client.MergePatch{"description": "stale"}); !errors.Is(err, client.ErrConflict) {
+		t.Errorf("expected ErrConflict for a stale version, got %v", err)
+	}
+	if _, err := c.ReplaceFood(ctx, food.ID, client.FoodInput{KnownAs: "Burrito", CountryID: 3}); !errors.Is(err, client.ErrPreconditionRequired) {
+		t.Errorf("expected ErrPreconditionRequired without a version, got %v", err)
+	}
+
+	food, err = c.ReplaceFood(ctx, food.ID, client.FoodInput{KnownAs: "Burrito", CountryID: 3, MakeYear: 1901, Version: 2})
+	if err != nil || food.Description != "" || food.MakeYear != 1901 {
+		t.Fatalf("unexpected replaced food %+v: %v", food, err)
+	}
+
+	if err := c.DeleteFood(ctx, food.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetFood(ctx, food.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted food, got %v", err)
+	}
+
+	if countries, err := c.ListCountries(ctx); err != nil || len(countries) == 0 || countries[0].Name == "" {
+		t.Errorf("unexpected countries %+v: %v", countries, err)
+	}
+
+	// users
+	user, err := c.CreateUser(ctx, client.UserInput{Email: "dave@example.com", FirstName: "Dave", Password: "dave-password", Active: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateUser(ctx, client.UserInput{Email: "dave@example.com", Password: "x"}); !errors.Is(err, client.ErrForbidden) {
+		t.Errorf("expected ErrForbidden for a duplicate email address, got %v", err)
+	}
+
+	user, err = c.PatchUser(ctx, user.ID, user.Version, client.JSONPatch{{Op: "replace", Path: "/last_name", Value: "Green"}})
+	if err != nil || user.FirstName != "Dave" || user.LastName != "Green" {
+		t.Fatalf("unexpected patched user %+v: %v", user, err)
+	}
+
+	users, err := c.ListUsers(ctx)
+	if err != nil || len(users) != 4 {
+		t.Fatalf("expected 4 users, got %d %v", len(users), err)
+	}
+	for _, u := range users {
+		if u.ID == me.ID && !u.HasToken {
+			t.Error("the logged in user has no token")
+		}
+	}
+
+	if err := c.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetUser(ctx, user.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted user, got %v", err)
+	}
+
+	if page, err := c.AuditLog(ctx, client.AuditQuery{Entity: "food", PageSize: 10}); err != nil || page.Total == 0 {
+		t.Errorf("expected the changes in the audit log, got %+v: %v", page, err)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Me(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized after logging out, got %v", err)
+	}
+}
+
+func TestClient_LogsInAgain(t *testing.T) {
+	ctx := context.Background()
+	app := newMemoryApp(t)
+	c := newClientServer(t, app, nil)
+
+	if _, err := c.Login(ctx, "alice@example.com", "alice-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token is revoked behind the client's back
+	revoked := c.Token()
+	if err := app.models.Token.DeleteByToken(ctx, revoked); err != nil {
+		t.Fatal(err)
+	}
+
+	me, err := c.Me(ctx)
+	if err != nil || me.FirstName != "Alice" {
+		t.Fatalf("expected the client to log in again, got %+v: %v", me, err)
+	}
+	if c.Token() == revoked {
+		t.Error("the client kept the revoked token")
+	}
+
+	// a token given to the client cannot be replaced
+	other := newClientServer(t, app, nil, client.WithToken(revoked))
+	if _, err := other.Me(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	ctx := context.Background()
+	app := newMemoryApp(t)
+
+	// failures counts down the requests which fail, and attempts counts them all
+	var failures, attempts atomic.Int32
+	c := newClientServer(t, app, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			if r.URL.Path == "/users/login" || failures.Add(-1) < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the request is handled, but the response lost on the way back
+			next.ServeHTTP(httptest.NewRecorder(), r)
+			w.WriteHeader(http.StatusBadGateway)
+		})
+	})
+
+	if _, err := c.Login(ctx, "alice@example.com", "alice-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	failures.Store(2)
+	attempts.Store(0)
+	if foods, err := c.ListFoods(ctx); err != nil || len(foods) != 3 {
+		t.Fatalf("expected the list after retrying, got %d %v", len(foods), err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+
+	// a retried POST is answered with the first response, so only one food is created
+	failures.Store(1)
+	food, err := c.CreateFood(ctx, client.FoodInput{KnownAs: "Burrito", CountryID: 3, MakeYear: 1900})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := app.models.Food.GetAll(ctx); len(all) != 4 || food.KnownAs != "Burrito" {
+		t.Errorf("expected one new food, got %d foods", len(all))
+	}
+
+	// a PATCH is not safe to repeat, so is not retried
+	failures.Store(1)
+	attempts.Store(0)
+	if _, err := c.PatchFood(ctx, food.ID, food.Version, client.MergePatch{"description": "wrapped"}); !client.IsStatus(err, http.StatusBadGateway) {
+		t.Errorf("expected the 502, got %v", err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("expected 1 attempt, got %d", n)
+	}
+
+	// giving up after the last retry
+	failures.Store(10)
+	if _, err := c.ListFoods(ctx); !client.IsStatus(err, http.StatusBadGateway) {
+		t.Errorf("expected the 502 after the last retry, got %v", err)
+	}
+}
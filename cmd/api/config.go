@@ -0,0 +1,562 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// config is the type for all application configuration.
+//
+// Every setting has a single name, such as db.max-open-conns, and can be given in any of
+// the following places. Later places take precedence over earlier ones:
+//
+//  1. the default, built in to the application
+//  2. a YAML (.yaml or .yml) or TOML (.toml) file, named by the -config flag or the
+//     CONFIG_FILE environment variable, where the name is split on dots into sections:
+//     db: {max-open-conns: 10}
+//  3. an environment variable, named by upper casing the setting and replacing dots and
+//     dashes with underscores: DB_MAX_OPEN_CONNS=10
+//  4. a command line flag: -db.max-open-conns=10
+//
+// Run "foodapi config print" to see the effective configuration, and "foodapi -help" to
+// list every setting.
+type config struct {
+	env         string     // development or production
+	port        int        // what port do we want the web server to listen on
+	http        httpConfig // web server timeouts
+	cache       cacheConfig
+	foodCache   foodCacheConfig
+	idempotency idempotencyConfig
+	graphql     graphqlConfig
+	grpc        grpcConfig
+	shutdown    shutdownConfig
+	storage     string     // where models are kept: postgres, sqlite, or memory for tests and demos
+	seedFile    string     // JSON file of data the memory backend starts with
+	sqlitePath  string     // database file for the sqlite backend
+	db          dbConfig   // database connection and pool settings
+	auth        authConfig // token lifetimes
+	cors        corsConfig // cross-origin settings
+	staticPath  string     // directory static files are served from, and samples written to
+	logLevel    string     // debug, info, warn or error
+	oidc        oidcConfig // single sign-on settings; disabled when issuer is empty
+	tracing     tracingConfig
+	smtp        smtpConfig // where we send email
+	frontendURL string     // base URL of the front end, used for links in emails
+
+	legacySunset string // when the /admin routes replaced by /v1 will be removed, as YYYY-MM-DD
+}
+
+// httpConfig holds the web server timeouts, which stop slow or idle clients from holding
+// connections open forever
+type httpConfig struct {
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+}
+
+// cacheConfig holds the Cache-Control header sent with each cacheable route. Every one of
+// them also answers conditional requests, whatever its Cache-Control.
+type cacheConfig struct {
+	foods     string // GET /foods
+	food      string // GET /foods/{slug}
+	countries string // GET /admin/countries/all
+}
+
+// foodCacheConfig holds the settings for the in-process cache of foods read from storage
+type foodCacheConfig struct {
+	ttl        time.Duration // how long a food is cached; changes made by other servers are seen after this
+	maxEntries int           // 0 disables the cache
+}
+
+// idempotencyConfig holds the settings for Idempotency-Key on POST routes
+type idempotencyConfig struct {
+	ttl time.Duration // how long a key and its response are kept; a retry after this is handled again
+}
+
+// graphqlConfig holds the limits on what one GraphQL query may ask for
+type graphqlConfig struct {
+	maxDepth      int // how deeply fields may be nested
+	maxComplexity int // how many fields may be resolved, counting those of each item in a list as many
+}
+
+// grpcConfig holds the settings for the gRPC server
+type grpcConfig struct {
+	port    int           // 0 disables the gRPC server
+	timeout time.Duration // the longest a call may run; a client may give a shorter deadline
+}
+
+// shutdownConfig controls how we stop. On SIGINT or SIGTERM we report not ready, wait delay
+// so that load balancers stop sending us new requests, then give in-flight requests and
+// background workers up to timeout to finish.
+type shutdownConfig struct {
+	delay   time.Duration
+	timeout time.Duration
+}
+
+// dbConfig holds the settings for connecting to the database. A complete dsn takes
+// precedence over the individual parts.
+type dbConfig struct {
+	dsn             string
+	host            string
+	port            int
+	user            string
+	password        string
+	name            string
+	sslMode         string
+	timezone        string
+	connectTimeout  int
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	timeout         time.Duration // the longest any one query may take
+
+	connectAttempts   int           // how many times to try connecting at startup
+	connectBackoff    time.Duration // wait after the first failed attempt, doubled after each one
+	connectMaxBackoff time.Duration
+
+	replicas             stringList    // DSNs of read replicas, which listings are read from
+	replicaCheckInterval time.Duration // how often to check whether unhealthy replicas are back
+}
+
+// authConfig holds the lifetimes of the tokens we hand out
+type authConfig struct {
+	tokenTTL             time.Duration
+	emailVerificationTTL time.Duration
+}
+
+// corsConfig holds the settings for cross-origin requests
+type corsConfig struct {
+	allowedOrigins stringList
+}
+
+// tracingConfig holds the settings for exporting OpenTelemetry traces
+type tracingConfig struct {
+	endpoint    string  // URL of an OTLP/HTTP collector, such as http://localhost:4318; empty disables export
+	sampleRatio float64 // fraction of new traces to record
+}
+
+// oidcConfig holds the settings for logging in through an OpenID Connect identity provider
+type oidcConfig struct {
+	issuer        string
+	clientID      string
+	clientSecret  string
+	redirectURL   string
+	autoProvision bool // create users on their first single sign-on login
+}
+
+// smtpConfig holds the settings for sending email
+type smtpConfig struct {
+	host string
+	port int
+	from string
+}
+
+// secretSettings are never printed by "config print"
+var secretSettings = map[string]bool{
+	"dsn":                true,
+	"db.password":        true,
+	"db.replicas":        true,
+	"oidc.client-secret": true,
+}
+
+// deprecatedEnv holds the environment variables settings used to be read from before they
+// were named after the setting, such as MAIL_FROM for smtp.from. Each is still read, but only
+// when the new variable is not set.
+var deprecatedEnv = map[string]string{
+	"smtp.from": "MAIL_FROM",
+}
+
+// newConfigFlags registers every setting in cfg as a flag with its default value
+func newConfigFlags(cfg *config) *flag.FlagSet {
+	fs := flag.NewFlagSet("foodapi", flag.ContinueOnError)
+
+	fs.String("config", "", "path to an optional YAML or TOML configuration file")
+
+	fs.StringVar(&cfg.env, "env", "production", "environment: development or production")
+	fs.IntVar(&cfg.port, "port", 8081, "port the web server listens on")
+	fs.DurationVar(&cfg.http.readTimeout, "http.read-timeout", 10*time.Second, "maximum duration for reading a request, including the body")
+	fs.DurationVar(&cfg.http.readHeaderTimeout, "http.read-header-timeout", 5*time.Second, "maximum duration for reading request headers")
+	fs.DurationVar(&cfg.http.writeTimeout, "http.write-timeout", 30*time.Second, "maximum duration for writing a response")
+	fs.DurationVar(&cfg.http.idleTimeout, "http.idle-timeout", time.Minute, "how long to keep idle keep-alive connections open")
+	fs.StringVar(&cfg.cache.foods, "cache.foods", "public, max-age=60", "Cache-Control header for the list of foods; empty sends none")
+	fs.StringVar(&cfg.cache.food, "cache.food", "public, max-age=300", "Cache-Control header for one food; empty sends none")
+	fs.StringVar(&cfg.cache.countries, "cache.countries", "private, max-age=3600", "Cache-Control header for the list of countries, which needs authentication; empty sends none")
+	fs.DurationVar(&cfg.foodCache.ttl, "food-cache.ttl", 30*time.Second, "how long foods read from storage are cached in memory")
+	fs.IntVar(&cfg.foodCache.maxEntries, "food-cache.max-entries", 1000, "most foods and lists of foods cached in memory; 0 disables the cache")
+	fs.DurationVar(&cfg.idempotency.ttl, "idempotency.ttl", 24*time.Hour, "how long the response to a POST made with an Idempotency-Key is kept for retries")
+	fs.IntVar(&cfg.graphql.maxDepth, "graphql.max-depth", 6, "how deeply the fields of a GraphQL query may be nested")
+	fs.IntVar(&cfg.graphql.maxComplexity, "graphql.max-complexity", 1000, "the most fields a GraphQL query may resolve, counting the fields under a list as if it held 10 items")
+	fs.IntVar(&cfg.grpc.port, "grpc.port", 8082, "port the gRPC server listens on; 0 disables it")
+	fs.DurationVar(&cfg.grpc.timeout, "grpc.timeout", 30*time.Second, "the longest a gRPC call may run, when the client gives no shorter deadline")
+	fs.DurationVar(&cfg.shutdown.delay, "shutdown.delay", 5*time.Second, "how long to report not ready before draining connections on shutdown")
+	fs.DurationVar(&cfg.shutdown.timeout, "shutdown.timeout", 30*time.Second, "how long to wait for in-flight requests and workers to finish on shutdown")
+	fs.StringVar(&cfg.staticPath, "static-path", "./static/", "directory static files are served from")
+	fs.StringVar(&cfg.logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&cfg.legacySunset, "legacy.sunset", "2027-04-30", "date the deprecated /admin routes replaced by /v1 will be removed, as YYYY-MM-DD, sent in their Sunset header")
+	fs.StringVar(&cfg.frontendURL, "frontend-url", "http://localhost:8080", "base URL of the front end, used for links in emails")
+
+	fs.StringVar(&cfg.storage, "storage", "postgres", "storage backend: postgres, sqlite, or memory, which loses everything when stopped")
+	fs.StringVar(&cfg.sqlitePath, "sqlite.path", "foodapi.db", "database file for the sqlite backend, created if it does not exist")
+	fs.StringVar(&cfg.seedFile, "seed-file", "", "JSON file of countries, tastes, foods and users for the memory backend to start with")
+
+	fs.StringVar(&cfg.db.dsn, "dsn", "", "complete database DSN; overrides the other db settings")
+	fs.StringVar(&cfg.db.host, "db.host", "localhost", "database host")
+	fs.IntVar(&cfg.db.port, "db.port", 5432, "database port")
+	fs.StringVar(&cfg.db.user, "db.user", "postgres", "database user")
+	fs.StringVar(&cfg.db.password, "db.password", "", "database password")
+	fs.StringVar(&cfg.db.name, "db.name", "foodapi", "database name")
+	fs.StringVar(&cfg.db.sslMode, "db.sslmode", "disable", "database sslmode")
+	fs.StringVar(&cfg.db.timezone, "db.timezone", "UTC", "database session time zone")
+	fs.IntVar(&cfg.db.connectTimeout, "db.connect-timeout", 5, "seconds to wait when connecting to the database")
+	fs.IntVar(&cfg.db.maxOpenConns, "db.max-open-conns", 5, "maximum open database connections")
+	fs.IntVar(&cfg.db.maxIdleConns, "db.max-idle-conns", 5, "maximum idle database connections")
+	fs.DurationVar(&cfg.db.connMaxLifetime, "db.conn-max-lifetime", 5*time.Minute, "maximum lifetime of a database connection")
+	fs.DurationVar(&cfg.db.timeout, "db.timeout", 3*time.Second, "maximum duration of a database query")
+	fs.IntVar(&cfg.db.connectAttempts, "db.connect-attempts", 5, "how many times to try connecting to the database at startup")
+	fs.DurationVar(&cfg.db.connectBackoff, "db.connect-backoff", time.Second, "wait after the first failed connection attempt, doubled after each further failure")
+	fs.DurationVar(&cfg.db.connectMaxBackoff, "db.connect-max-backoff", 30*time.Second, "longest wait between connection attempts")
+	fs.Var(&cfg.db.replicas, "db.replicas", "comma separated DSNs of Postgres read replicas, which listings are read from")
+	fs.DurationVar(&cfg.db.replicaCheckInterval, "db.replica-check-interval", 10*time.Second, "how often to check the health of the read replicas")
+
+	fs.DurationVar(&cfg.auth.tokenTTL, "auth.token-ttl", 24*time.Hour, "lifetime of login tokens")
+	fs.DurationVar(&cfg.auth.emailVerificationTTL, "auth.email-verification-ttl", 24*time.Hour, "lifetime of email verification links")
+
+	cfg.cors.allowedOrigins = stringList{"https://*", "http://*"}
+	fs.Var(&cfg.cors.allowedOrigins, "cors.allowed-origins", "comma separated list of allowed CORS origins")
+
+	fs.StringVar(&cfg.oidc.issuer, "oidc.issuer", "", "OpenID Connect issuer URL; empty disables single sign-on")
+	fs.StringVar(&cfg.oidc.clientID, "oidc.client-id", "", "OpenID Connect client id")
+	fs.StringVar(&cfg.oidc.clientSecret, "oidc.client-secret", "", "OpenID Connect client secret")
+	fs.StringVar(&cfg.oidc.redirectURL, "oidc.redirect-url", "", "URL of /users/oidc/callback, as registered with the identity provider")
+	fs.BoolVar(&cfg.oidc.autoProvision, "oidc.auto-provision", false, "create users on their first single sign-on login")
+
+	fs.StringVar(&cfg.tracing.endpoint, "tracing.endpoint", "", "URL of an OTLP/HTTP trace collector, such as http://localhost:4318; empty disables tracing")
+	fs.Float64Var(&cfg.tracing.sampleRatio, "tracing.sample-ratio", 1, "fraction of traces to record, from 0 to 1")
+
+	fs.StringVar(&cfg.smtp.host, "smtp.host", "localhost", "SMTP server host")
+	fs.IntVar(&cfg.smtp.port, "smtp.port", 1025, "SMTP server port")
+	fs.StringVar(&cfg.smtp.from, "smtp.from", "no-reply@food-api.local", "address email is sent from")
+
+	return fs
+}
+
+// loadConfig builds the configuration from defaults, the optional configuration file,
+// environment variables (looked up with lookupEnv) and the command line flags in args,
+// in that order of precedence. The returned error lists every invalid setting.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (config, *flag.FlagSet, error) {
+	var cfg config
+	fs := newConfigFlags(&cfg)
+	fs.SetOutput(io.Discard)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, fs, err
+	}
+
+	// remember what was given on the command line, since it must win over everything else
+	cmdline := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		cmdline[f.Name] = f.Value.String()
+	})
+
+	var errs configErrors
+
+	file := cmdline["config"]
+	if file == "" {
+		file, _ = lookupEnv("CONFIG_FILE")
+	}
+	if file != "" {
+		values, err := readConfigFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("config: %s", err))
+		}
+
+		for _, name := range sortedKeys(values) {
+			if name == "config" || fs.Lookup(name) == nil {
+				errs = append(errs, fmt.Sprintf("%s: unknown setting in %s", name, file))
+				continue
+			}
+			if err := fs.Set(name, values[name]); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: invalid value %q in %s", name, values[name], file))
+			}
+		}
+	}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		key := envName(f.Name)
+		value, ok := lookupEnv(key)
+		if old := deprecatedEnv[f.Name]; !ok && old != "" {
+			key = old
+			value, ok = lookupEnv(key)
+		}
+		if ok {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: invalid value %q in environment variable %s", f.Name, value, key))
+			}
+		}
+	})
+
+	for name, value := range cmdline {
+		_ = fs.Set(name, value)
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return cfg, fs, errs
+	}
+
+	return cfg, fs, nil
+}
+
+// validate checks every setting, and returns a description of each one which is invalid
+func (cfg *config) validate() configErrors {
+	var errs configErrors
+
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.env == "development" || cfg.env == "production", "env: must be development or production, not %q", cfg.env)
+	check(cfg.port > 0 && cfg.port < 65536, "port: must be between 1 and 65535, not %d", cfg.port)
+	check(cfg.http.readTimeout > 0, "http.read-timeout: must be greater than zero")
+	check(cfg.http.readHeaderTimeout > 0, "http.read-header-timeout: must be greater than zero")
+	check(cfg.http.writeTimeout > 0, "http.write-timeout: must be greater than zero")
+	check(cfg.http.idleTimeout > 0, "http.idle-timeout: must be greater than zero")
+	check(cfg.foodCache.ttl > 0, "food-cache.ttl: must be greater than zero")
+	check(cfg.foodCache.maxEntries >= 0, "food-cache.max-entries: must not be negative")
+	_, err := time.Parse(time.DateOnly, cfg.legacySunset)
+	check(err == nil, "legacy.sunset: must be a date such as 2027-04-30, not %q", cfg.legacySunset)
+	check(cfg.idempotency.ttl > 0, "idempotency.ttl: must be greater than zero")
+	check(cfg.graphql.maxDepth > 0, "graphql.max-depth: must be greater than zero")
+	check(cfg.graphql.maxComplexity > 0, "graphql.max-complexity: must be greater than zero")
+	check(cfg.grpc.port >= 0 && cfg.grpc.port < 65536 && cfg.grpc.port != cfg.port, "grpc.port: must be between 0 and 65535, and not the same as port, not %d", cfg.grpc.port)
+	check(cfg.grpc.timeout > 0, "grpc.timeout: must be greater than zero")
+	check(cfg.shutdown.delay >= 0, "shutdown.delay: must not be negative")
+	check(cfg.shutdown.timeout > 0, "shutdown.timeout: must be greater than zero")
+	check(cfg.staticPath != "", "static-path: must not be empty")
+	check(cfg.logLevel == "debug" || cfg.logLevel == "info" || cfg.logLevel == "warn" || cfg.logLevel == "error",
+		"log-level: must be debug, info, warn or error, not %q", cfg.logLevel)
+
+	check(cfg.storage == "postgres" || cfg.storage == "sqlite" || cfg.storage == "memory",
+		"storage: must be postgres, sqlite or memory, not %q", cfg.storage)
+	check(cfg.seedFile == "" || cfg.storage == "memory", "seed-file: only the memory storage backend can be seeded")
+	check(cfg.storage != "sqlite" || cfg.sqlitePath != "", "sqlite.path: must not be empty when storage is sqlite")
+
+	if cfg.storage == "postgres" && cfg.db.dsn == "" {
+		check(cfg.db.host != "", "db.host: must not be empty unless dsn is set")
+		check(cfg.db.port > 0 && cfg.db.port < 65536, "db.port: must be between 1 and 65535, not %d", cfg.db.port)
+		check(cfg.db.user != "", "db.user: must not be empty unless dsn is set")
+		check(cfg.db.name != "", "db.name: must not be empty unless dsn is set")
+		check(cfg.db.connectTimeout >= 0, "db.connect-timeout: must not be negative")
+	}
+	check(cfg.db.maxOpenConns > 0, "db.max-open-conns: must be at least 1, not %d", cfg.db.maxOpenConns)
+	check(cfg.db.maxIdleConns >= 0, "db.max-idle-conns: must not be negative")
+	check(cfg.db.maxIdleConns <= cfg.db.maxOpenConns, "db.max-idle-conns: must not be more than db.max-open-conns")
+	check(cfg.db.connMaxLifetime >= 0, "db.conn-max-lifetime: must not be negative")
+	check(cfg.db.timeout > 0, "db.timeout: must be greater than zero")
+	check(cfg.db.connectAttempts > 0, "db.connect-attempts: must be at least 1, not %d", cfg.db.connectAttempts)
+	check(cfg.db.connectBackoff >= 0, "db.connect-backoff: must not be negative")
+	check(cfg.db.connectMaxBackoff >= cfg.db.connectBackoff, "db.connect-max-backoff: must not be less than db.connect-backoff")
+	check(len(cfg.db.replicas) == 0 || cfg.storage == "postgres", "db.replicas: only the postgres storage backend has read replicas")
+	check(cfg.db.replicaCheckInterval > 0, "db.replica-check-interval: must be greater than zero")
+
+	check(cfg.auth.tokenTTL > 0, "auth.token-ttl: must be greater than zero")
+	check(cfg.auth.emailVerificationTTL > 0, "auth.email-verification-ttl: must be greater than zero")
+
+	check(len(cfg.cors.allowedOrigins) > 0, "cors.allowed-origins: must list at least one origin")
+
+	if cfg.oidc.issuer != "" {
+		check(cfg.oidc.clientID != "", "oidc.client-id: must be set when oidc.issuer is set")
+		check(cfg.oidc.redirectURL != "", "oidc.redirect-url: must be set when oidc.issuer is set")
+	}
+
+	check(cfg.tracing.sampleRatio >= 0 && cfg.tracing.sampleRatio <= 1, "tracing.sample-ratio: must be between 0 and 1, not %g", cfg.tracing.sampleRatio)
+	if cfg.tracing.endpoint != "" {
+		u, err := url.Parse(cfg.tracing.endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"tracing.endpoint: must be an http or https URL, not %q", cfg.tracing.endpoint)
+	}
+
+	check(cfg.smtp.host != "", "smtp.host: must not be empty")
+	check(cfg.smtp.port > 0 && cfg.smtp.port < 65536, "smtp.port: must be between 1 and 65535, not %d", cfg.smtp.port)
+
+	return errs
+}
+
+// DSN returns the connection string for the database
+func (c dbConfig) DSN() string {
+	if c.dsn != "" {
+		return c.dsn
+	}
+
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s timezone=%s connect_timeout=%d",
+		dsnQuote(c.host), c.port, dsnQuote(c.user), dsnQuote(c.password), dsnQuote(c.name),
+		dsnQuote(c.sslMode), dsnQuote(c.timezone), c.connectTimeout)
+}
+
+// dsnQuote quotes a value for use in a key=value connection string, if it needs it
+func dsnQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, ` '\`) {
+		return s
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// writeConfig writes the effective configuration in fs to w as YAML, with secrets redacted
+func writeConfig(w io.Writer, fs *flag.FlagSet) error {
+	out := make(map[string]interface{})
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+
+		value := f.Value.(flag.Getter).Get()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case stringList:
+			value = []string(v)
+		}
+
+		if secretSettings[f.Name] && f.Value.String() != "" {
+			value = "<redacted>"
+		}
+
+		// nest the value in sections named by the parts of the setting's name
+		section := out
+		parts := strings.Split(f.Name, ".")
+		for _, part := range parts[:len(parts)-1] {
+			if _, ok := section[part]; !ok {
+				section[part] = make(map[string]interface{})
+			}
+			section = section[part].(map[string]interface{})
+		}
+		section[parts[len(parts)-1]] = value
+	})
+
+	b, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// readConfigFile reads a YAML or TOML configuration file, and returns its settings as
+// strings, keyed by the setting's full dotted name
+func readConfigFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		return nil, fmt.Errorf("%s must end in .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	flattenConfig("", raw, values)
+
+	return values, nil
+}
+
+// flattenConfig copies the settings in raw into values. Sections are walked recursively,
+// and their names joined to the setting's name with dots; lists become comma separated.
+func flattenConfig(name string, raw interface{}, values map[string]string) {
+	join := func(k string) string {
+		if name == "" {
+			return k
+		}
+		return name + "." + k
+	}
+
+	switch v := raw.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			flattenConfig(join(k), x, values)
+		}
+	case map[interface{}]interface{}:
+		for k, x := range v {
+			flattenConfig(join(fmt.Sprint(k)), x, values)
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, x := range v {
+			parts = append(parts, fmt.Sprint(x))
+		}
+		values[name] = strings.Join(parts, ",")
+	default:
+		values[name] = fmt.Sprint(v)
+	}
+}
+
+// envName returns the environment variable for a setting: db.max-open-conns is DB_MAX_OPEN_CONNS
+func envName(setting string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(setting))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configErrors lists every problem found in the configuration
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// stringList is a flag.Value holding a comma separated list of strings
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = nil
+	for _, x := range strings.Split(value, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			*s = append(*s, x)
+		}
+	}
+	return nil
+}
+
+func (s *stringList) Get() interface{} {
+	return *s
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/food/internal/data"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// /graphql answers GraphQL queries for foods, countries, tastes and users. Reading foods,
+// countries and tastes is public, as GET /foods is; everything else needs the same token as
+// /admin. A request with a token which is not valid is refused with 401 before the query is
+// looked at, just as it is by /admin. A request with a token may carry an Idempotency-Key,
+// as a POST to /admin may, so that a mutation can be retried without being made twice.
+
+// graphqlListSize is how many items a list is assumed to hold when working out how complex a
+// query is
+const graphqlListSize = 10
+
+// graphqlContextKey is where GraphQL stores what resolvers need to know about the request
+const graphqlContextKey = contextKey("graphql")
+
+// graphqlRequest is the body of a POST to /graphql
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// graphqlState is what resolvers need to know about the request they are resolving
+type graphqlState struct {
+	app    *application
+	user   *data.User // nil if the request is anonymous
+	actor  data.Actor
+	tastes *tasteLoader
+}
+
+// state returns the graphqlState of the request a resolver is resolving
+func state(ctx context.Context) *graphqlState {
+	return ctx.Value(graphqlContextKey).(*graphqlState)
+}
+
+// errAuthenticationRequired is returned by a resolver which needs a token the request did
+// not send
+var errAuthenticationRequired = errors.New("authentication required")
+
+// authenticated returns the state of the request, or an error if it has no user
+func authenticated(ctx context.Context) (*graphqlState, error) {
+	s := state(ctx)
+	if s.user == nil {
+		return nil, errAuthenticationRequired
+	}
+
+	return s, nil
+}
+
+// GraphQL answers a GraphQL query. A query which cannot be parsed, is not valid against the
+// schema, or asks for too much is refused with 400 Bad Request; any other answers 200 OK,
+// with the errors of the fields which could not be resolved alongside the data.
+func (app *application) GraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+
+	if err := app.readJSON(w, r, &req); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		app.writeJSON(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	if result := graphql.ValidateDocument(&graphqlSchema, doc, nil); !result.IsValid {
+		app.writeJSON(w, http.StatusBadRequest, &graphql.Result{Errors: result.Errors})
+		return
+	}
+
+	if err := app.checkGraphQLLimits(doc, req.OperationName); err != nil {
+		app.writeJSON(w, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	s := &graphqlState{
+		app:    app,
+		user:   app.authenticatedUser(r),
+		actor:  app.actor(r),
+		tastes: newTasteLoader(app.models.Taste),
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphqlSchema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(r.Context(), graphqlContextKey, s),
+	})
+
+	app.writeJSON(w, http.StatusOK, result)
+}
+
+// OptionalAuthTokenMiddleware authenticates a request which sends a token, refusing it if
+// the token is not valid, as AuthTokenMiddleware does, but lets a request without one
+// through, without a user
+func (app *application) OptionalAuthTokenMiddleware(next http.Handler) http.Handler {
+	auth := app.AuthTokenMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		auth.ServeHTTP(w, r)
+	})
+}
+
+// tasteLoader loads the tastes of foods for one request. The tastes of every food asked for
+// while one level of a query is resolved are loaded together, in one call to
+// Taste.ForFoods, rather than one query for each food.
+type tasteLoader struct {
+	store data.TasteStore
+
+	mu     sync.Mutex
+	batch  *tasteBatch
+	loaded map[int][]data.Taste
+}
+
+// tasteBatch is the foods whose tastes are loaded together
+type tasteBatch struct {
+	foodIDs []int
+	done    bool
+	err     error
+}
+
+func newTasteLoader(store data.TasteStore) *tasteLoader {
+	return &tasteLoader{store: store, loaded: make(map[int][]data.Taste)}
+}
+
+// load returns a thunk for the tastes of the food with foodID. GraphQL calls the thunks for a
+// level of the query once every field on it has been resolved, so the first call loads the
+// tastes for all of them.
+func (l *tasteLoader) load(ctx context.Context, foodID int) func() (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.batch == nil || l.batch.done {
+		l.batch = &tasteBatch{}
+	}
+	b := l.batch
+	b.foodIDs = append(b.foodIDs, foodID)
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !b.done {
+			b.done = true
+
+			var missing []int
+			for _, id := range b.foodIDs {
+				if _, ok := l.loaded[id]; !ok {
+					missing = append(missing, id)
+				}
+			}
+
+			if len(missing) > 0 {
+				// tastes which could not be loaded are not remembered, so that a later batch
+				// tries again rather than finding none
+				tastes, err := l.store.ForFoods(ctx, missing)
+				if err != nil {
+					b.err = err
+				} else {
+					for _, id := range missing {
+						l.loaded[id] = tastes[id]
+					}
+				}
+			}
+		}
+
+		if b.err != nil {
+			return nil, resolverError(ctx, b.err)
+		}
+
+		tastes := l.loaded[foodID]
+		if tastes == nil {
+			tastes = []data.Taste{}
+		}
+		return tastes, nil
+	}
+}
+
+// checkGraphQLLimits refuses an operation nested more deeply than graphql.max-depth, or
+// which may resolve more fields than graphql.max-complexity. The introspection fields, such
+// as __schema, do not count, so that tools can read the schema.
+func (app *application) checkGraphQLLimits(doc *ast.Document, operationName string) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var operation *ast.OperationDefinition
+
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		return errors.New("no operation to run")
+	}
+
+	var root *graphql.Object
+	if operation.Operation == ast.OperationTypeMutation {
+		root = graphqlSchema.MutationType()
+	} else {
+		root = graphqlSchema.QueryType()
+	}
+
+	c := queryCost{fragments: fragments}
+	depth, complexity := c.of(operation.SelectionSet, root, 1)
+
+	if depth > app.config.graphql.maxDepth {
+		return errors.New("the query is nested too deeply")
+	}
+	if complexity > app.config.graphql.maxComplexity {
+		return errors.New("the query asks for too much at once")
+	}
+
+	return nil
+}
+
+// queryCost works out how deeply a query is nested, and how many fields it may resolve
+type queryCost struct {
+	fragments map[string]*ast.FragmentDefinition
+}
+
+// of returns the depth of set, which selects fields of parent, and the number of fields it
+// may resolve, when parent is resolved multiplier times
+func (c queryCost) of(set *ast.SelectionSet, parent *graphql.Object, multiplier int) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+
+	for _, selection := range set.Selections {
+		var d, n int
+
+		switch s := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(s.Name.Value, "__") {
+				continue
+			}
+
+			d, n = 1, multiplier
+			if field, ok := parent.Fields()[s.Name.Value]; ok {
+				childType, isList := unwrapType(field.Type)
+				childMultiplier := multiplier
+				if isList {
+					childMultiplier *= graphqlListSize
+				}
+
+				if object, ok := childType.(*graphql.Object); ok {
+					childDepth, childComplexity := c.of(s.SelectionSet, object, childMultiplier)
+					d += childDepth
+					n += childComplexity
+				}
+			}
+		case *ast.InlineFragment:
+			d, n = c.of(s.SelectionSet, parent, multiplier)
+		case *ast.FragmentSpread:
+			if fragment, ok := c.fragments[s.Name.Value]; ok {
+				d, n = c.of(fragment.SelectionSet, parent, multiplier)
+			}
+		}
+
+		depth = max(depth, d)
+		complexity += n
+	}
+
+	return depth, complexity
+}
+
+// unwrapType returns the named type under t, and whether t is a list of it
+func unwrapType(t graphql.Output) (graphql.Type, bool) {
+	isList := false
+
+	for {
+		switch wrapper := t.(type) {
+		case *graphql.NonNull:
+			t = wrapper.OfType.(graphql.Output)
+		case *graphql.List:
+			isList = true
+			t = wrapper.OfType.(graphql.Output)
+		default:
+			return t, isList
+		}
+	}
+}
+
+// resolverError returns the error a resolver reports to the client for err, as errorJSON
+// would describe it, logging errors which are not the client's fault
+func resolverError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("not found")
+	}
+
+	shown, status := clientError(err, http.StatusInternalServerError)
+	if status >= http.StatusInternalServerError {
+		state(ctx).app.logger.ErrorContext(ctx, "graphql resolver failed", "err", err)
+		// the answer is still 200 OK, but a retry with the same Idempotency-Key should try again
+		dontKeepResponse(ctx)
+		return errors.New("internal server error")
+	}
+
+	return shown
+}
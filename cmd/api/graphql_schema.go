@@ -0,0 +1,420 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/food/internal/data"
+	"github.com/graphql-go/graphql"
+)
+
+// graphqlSchema is the schema /graphql answers queries against. Resolvers find the models,
+// and who is asking, in the state stored in the context of the request.
+var graphqlSchema = newGraphQLSchema()
+
+var countryType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Country",
+	Description: "A country a food comes from",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				switch c := p.Source.(type) {
+				case data.Country:
+					return c.CountryName, nil
+				case *data.Country:
+					return c.CountryName, nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var tasteType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Taste",
+	Description: "One of the tastes a food may have",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.String),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				switch t := p.Source.(type) {
+				case data.Taste:
+					return t.Taste, nil
+				case *data.Taste:
+					return t.Taste, nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var foodType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "Food",
+	Description: "A food, with where it comes from and how it tastes",
+	Fields: graphql.Fields{
+		"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"knownAs":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"slug":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"makeYear":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"country":     &graphql.Field{Type: graphql.NewNonNull(countryType)},
+		"tastes": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tasteType))),
+			Description: "The tastes of every food in a query are loaded together",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				food := p.Source.(*data.Food)
+				return state(p.Context).tastes.load(p.Context, food.ID), nil
+			},
+		},
+		"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name:        "User",
+	Description: "A user, who may log in to manage foods",
+	Fields: graphql.Fields{
+		"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"email":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"firstName": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"lastName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"active": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Boolean),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*data.User).Active == 1, nil
+			},
+		},
+		"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"version":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+var foodInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "FoodInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"knownAs":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"countryId":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+		"makeYear":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"description": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"tasteIds":    &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.Int))},
+	},
+})
+
+var userInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"email":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"firstName": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"lastName":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"password": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Only changed if it is given",
+		},
+		"active": &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+func newGraphQLSchema() graphql.Schema {
+	id := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)}
+	version := &graphql.ArgumentConfig{
+		Type:        graphql.NewNonNull(graphql.Int),
+		Description: "The version the change is based on; if the record has changed since, the change is refused",
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"foods": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(foodType))),
+				Description: "Foods ordered by name, narrowed down by any of the arguments given",
+				Args: graphql.FieldConfigArgument{
+					"countryId": &graphql.ArgumentConfig{Type: graphql.Int},
+					"tasteId":   &graphql.ArgumentConfig{Type: graphql.Int},
+					"search":    &graphql.ArgumentConfig{Type: graphql.String, Description: "part of the name, in any case"},
+				},
+				Resolve: resolveFoods,
+			},
+			"food": &graphql.Field{
+				Type:        foodType,
+				Description: "The food with id, or with slug",
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.Int},
+					"slug": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveFood,
+			},
+			"countries": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(countryType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					countries, err := state(p.Context).app.models.Country.All(p.Context)
+					return countries, resolverError(p.Context, err)
+				},
+			},
+			"tastes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tasteType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					tastes, err := state(p.Context).app.models.Taste.All(p.Context)
+					return tastes, resolverError(p.Context, err)
+				},
+			},
+			"me": &graphql.Field{
+				Type:        userType,
+				Description: "The logged in user, or null",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if user := state(p.Context).user; user != nil {
+						return user, nil
+					}
+					return nil, nil
+				},
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+				Description: "Every user; needs a token",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					s, err := authenticated(p.Context)
+					if err != nil {
+						return nil, err
+					}
+
+					users, err := s.app.models.User.GetAll(p.Context)
+					return users, resolverError(p.Context, err)
+				},
+			},
+			"user": &graphql.Field{
+				Type:        userType,
+				Description: "The user with id; needs a token",
+				Args:        graphql.FieldConfigArgument{"id": id},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					s, err := authenticated(p.Context)
+					if err != nil {
+						return nil, err
+					}
+
+					user, err := s.app.models.User.GetOne(p.Context, p.Args["id"].(int))
+					if errors.Is(err, sql.ErrNoRows) {
+						return nil, nil
+					}
+					return user, resolverError(p.Context, err)
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Mutation",
+		Description: "Changes to foods and users, which need a token",
+		Fields: graphql.Fields{
+			"createFood": &graphql.Field{
+				Type:    graphql.NewNonNull(foodType),
+				Args:    graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(foodInputType)}},
+				Resolve: resolveCreateFood,
+			},
+			"updateFood": &graphql.Field{
+				Type:    graphql.NewNonNull(foodType),
+				Args:    graphql.FieldConfigArgument{"id": id, "version": version, "input": {Type: graphql.NewNonNull(foodInputType)}},
+				Resolve: resolveUpdateFood,
+			},
+			"deleteFood": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": id},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					s, err := authenticated(p.Context)
+					if err != nil {
+						return nil, err
+					}
+
+					err = s.app.models.Food.DeleteByID(p.Context, p.Args["id"].(int), s.actor)
+					return err == nil, resolverError(p.Context, err)
+				},
+			},
+			"createUser": &graphql.Field{
+				Type:    graphql.NewNonNull(userType),
+				Args:    graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(userInputType)}},
+				Resolve: resolveCreateUser,
+			},
+			"updateUser": &graphql.Field{
+				Type:    graphql.NewNonNull(userType),
+				Args:    graphql.FieldConfigArgument{"id": id, "version": version, "input": {Type: graphql.NewNonNull(userInputType)}},
+				Resolve: resolveUpdateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": id},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					s, err := authenticated(p.Context)
+					if err != nil {
+						return nil, err
+					}
+
+					err = s.app.models.User.DeleteByID(p.Context, p.Args["id"].(int), s.actor)
+					return err == nil, resolverError(p.Context, err)
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+func resolveFoods(p graphql.ResolveParams) (interface{}, error) {
+	filter := data.FoodFilter{}
+	filter.CountryID, _ = p.Args["countryId"].(int)
+	filter.TasteID, _ = p.Args["tasteId"].(int)
+	filter.Search, _ = p.Args["search"].(string)
+
+	foods, err := state(p.Context).app.models.Food.Search(p.Context, filter)
+	return foods, resolverError(p.Context, err)
+}
+
+func resolveFood(p graphql.ResolveParams) (interface{}, error) {
+	s := state(p.Context)
+
+	var food *data.Food
+	var err error
+	if id, ok := p.Args["id"].(int); ok {
+		food, err = s.app.models.Food.GetOneById(p.Context, id)
+	} else if slug, ok := p.Args["slug"].(string); ok {
+		food, err = s.app.models.Food.GetOneBySlug(p.Context, slug)
+	} else {
+		return nil, errors.New("give the id or the slug of the food")
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return food, resolverError(p.Context, err)
+}
+
+// foodInput returns the food described by a FoodInput, as a foodRequest, so that it is read
+// the same way as the body of POST /v1/foods. A FoodInput is the whole food, so TasteIDs is
+// never nil, and updateFood without tasteIds removes the food's tastes.
+func foodInput(input map[string]interface{}) foodRequest {
+	req := foodRequest{TasteIDs: []int{}}
+	req.KnownAs, _ = input["knownAs"].(string)
+	req.CountryID, _ = input["countryId"].(int)
+	req.MakeYear, _ = input["makeYear"].(int)
+	req.Description, _ = input["description"].(string)
+
+	ids, _ := input["tasteIds"].([]interface{})
+	for _, id := range ids {
+		req.TasteIDs = append(req.TasteIDs, id.(int))
+	}
+
+	return req
+}
+
+func resolveCreateFood(p graphql.ResolveParams) (interface{}, error) {
+	s, err := authenticated(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	food := foodInput(p.Args["input"].(map[string]interface{})).food()
+
+	id, err := s.app.models.Food.Insert(p.Context, food, s.actor)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	created, err := s.app.models.Food.GetOneById(p.Context, id)
+	return created, resolverError(p.Context, err)
+}
+
+func resolveUpdateFood(p graphql.ResolveParams) (interface{}, error) {
+	s, err := authenticated(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	req := foodInput(p.Args["input"].(map[string]interface{}))
+	req.ID = p.Args["id"].(int)
+
+	food := req.food()
+	food.Version = p.Args["version"].(int)
+
+	if err := s.app.models.Food.Update(p.Context, food, s.actor); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	updated, err := s.app.models.Food.GetOneById(p.Context, food.ID)
+	return updated, resolverError(p.Context, err)
+}
+
+// userInput returns the user described by a UserInput, as a userRequest, so that it is read
+// the same way as the body of POST /v1/users
+func userInput(input map[string]interface{}) userRequest {
+	req := userRequest{}
+	req.Email, _ = input["email"].(string)
+	req.FirstName, _ = input["firstName"].(string)
+	req.LastName, _ = input["lastName"].(string)
+	req.Password, _ = input["password"].(string)
+	if active, _ := input["active"].(bool); active {
+		req.Active = 1
+	}
+
+	return req
+}
+
+func resolveCreateUser(p graphql.ResolveParams) (interface{}, error) {
+	s, err := authenticated(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	user := userInput(p.Args["input"].(map[string]interface{})).user()
+
+	id, err := s.app.models.User.Insert(p.Context, user, s.actor)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	created, err := s.app.models.User.GetOne(p.Context, id)
+	return created, resolverError(p.Context, err)
+}
+
+// resolveUpdateUser saves a user as updateUser does for PUT /v1/users/{id}
+func resolveUpdateUser(p graphql.ResolveParams) (interface{}, error) {
+	s, err := authenticated(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	req := userInput(p.Args["input"].(map[string]interface{}))
+	id := p.Args["id"].(int)
+
+	u, err := s.app.models.User.GetOne(p.Context, id)
+	if err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	u.Email = req.Email
+	u.FirstName = req.FirstName
+	u.LastName = req.LastName
+	u.Active = req.Active
+	u.Version = p.Args["version"].(int)
+
+	if err := s.app.models.User.Update(p.Context, *u, s.actor); err != nil {
+		return nil, resolverError(p.Context, err)
+	}
+
+	if req.Password != "" {
+		if err := s.app.models.User.ResetPassword(p.Context, id, req.Password, s.actor); err != nil {
+			return nil, resolverError(p.Context, err)
+		}
+	}
+
+	updated, err := s.app.models.User.GetOne(p.Context, id)
+	return updated, resolverError(p.Context, err)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/food/internal/data"
+)
+
+// countingTastes counts the calls to ForFoods
+type countingTastes struct {
+	data.TasteStore
+	calls atomic.Int32
+}
+
+func (c *countingTastes) ForFoods(ctx context.Context, foodIDs []int) (map[int][]data.Taste, error) {
+	c.calls.Add(1)
+	return c.TasteStore.ForFoods(ctx, foodIDs)
+}
+
+// flakyTastes fails the first call to ForFoods
+type flakyTastes struct {
+	data.TasteStore
+	failed bool
+}
+
+func (f *flakyTastes) ForFoods(ctx context.Context, foodIDs []int) (map[int][]data.Taste, error) {
+	if !f.failed {
+		f.failed = true
+		return nil, errors.New("connection reset")
+	}
+	return f.TasteStore.ForFoods(ctx, foodIDs)
+}
+
+func TestTasteLoader_Error(t *testing.T) {
+	app := newMemoryApp(t)
+	loader := newTasteLoader(&flakyTastes{TasteStore: app.models.Taste})
+	ctx := context.WithValue(context.Background(), graphqlContextKey, &graphqlState{app: app, tastes: loader})
+
+	if _, err := loader.load(ctx, 1)(); err == nil {
+		t.Fatal("expected the failed load to be reported")
+	}
+
+	// a later batch loads the tastes again, rather than finding none
+	tastes, err := loader.load(ctx, 1)()
+	if err != nil || len(tastes.([]data.Taste)) != 2 {
+		t.Errorf("expected the 2 tastes of Tacos, got %v %v", tastes, err)
+	}
+}
+
+// graphqlResponse is the body of a response from /graphql
+type graphqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// postGraphQL sends query with variables to /graphql, returning the status and decoded body
+func postGraphQL(t *testing.T, app *application, token, query string, variables map[string]interface{}) (int, graphqlResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := serve(app, token, http.MethodPost, "/graphql", string(body), nil)
+
+	var resp graphqlResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("could not decode %q: %v", rr.Body.String(), err)
+	}
+
+	return rr.Code, resp
+}
+
+// field returns the field of the response called name, without the indentation
+func (r graphqlResponse) field(name string) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, r.Data[name]); err != nil {
+		return ""
+	}
+
+	return b.String()
+}
+
+func Test_GraphQL_Foods(t *testing.T) {
+	app := newMemoryApp(t)
+	tastes := &countingTastes{TasteStore: app.models.Taste}
+	app.models.Taste = tastes
+
+	status, resp := postGraphQL(t, app, "", `{ foods { knownAs country { name } tastes { name } } }`, nil)
+	if status != http.StatusOK || len(resp.Errors) > 0 {
+		t.Fatalf("unexpected response %d %+v", status, resp.Errors)
+	}
+
+	var foods []struct {
+		KnownAs string `json:"knownAs"`
+		Country struct {
+			Name string `json:"name"`
+		} `json:"country"`
+		Tastes []struct {
+			Name string `json:"name"`
+		} `json:"tastes"`
+	}
+	if err := json.Unmarshal(resp.Data["foods"], &foods); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(foods) != 3 {
+		t.Fatalf("expected 3 foods, got %d", len(foods))
+	}
+	for _, food := range foods {
+		if food.Country.Name == "" || len(food.Tastes) == 0 {
+			t.Errorf("expected the country and tastes of %s, got %+v", food.KnownAs, food)
+		}
+	}
+	if n := tastes.calls.Load(); n != 1 {
+		t.Errorf("expected the tastes of every food to be loaded at once, got %d loads", n)
+	}
+
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		want      []string
+	}{
+		{"by country", `query($id: Int) { foods(countryId: $id) { knownAs } }`, map[string]interface{}{"id": 2}, []string{"Pizza"}},
+		{"by taste", `{ foods(tasteId: 4) { knownAs } }`, nil, []string{"Pizza", "Tacos"}},
+		{"by name", `{ foods(search: "RAM") { knownAs } }`, nil, []string{"Ramen"}},
+		{"no match", `{ foods(countryId: 1, tasteId: 5) { knownAs } }`, nil, []string{}},
+	}
+
+	for _, e := range tests {
+		_, resp := postGraphQL(t, app, "", e.query, e.variables)
+
+		var foods []struct {
+			KnownAs string `json:"knownAs"`
+		}
+		if err := json.Unmarshal(resp.Data["foods"], &foods); err != nil {
+			t.Fatalf("%s: %v %+v", e.name, err, resp.Errors)
+		}
+
+		var got []string
+		for _, food := range foods {
+			got = append(got, food.KnownAs)
+		}
+		if strings.Join(got, ",") != strings.Join(e.want, ",") {
+			t.Errorf("%s: expected %v, got %v", e.name, e.want, got)
+		}
+	}
+
+	_, resp = postGraphQL(t, app, "", `{ food(slug: "ramen") { id } missing: food(id: 99) { id } }`, nil)
+	if resp.field("food") != `{"id":3}` || resp.field("missing") != "null" {
+		t.Errorf("unexpected foods %s and %s", resp.Data["food"], resp.Data["missing"])
+	}
+}
+
+func Test_GraphQL_Auth(t *testing.T) {
+	app := newMemoryApp(t)
+
+	// anonymous requests can read foods, but not users
+	_, resp := postGraphQL(t, app, "", `{ me { email } }`, nil)
+	if len(resp.Errors) > 0 || resp.field("me") != "null" {
+		t.Errorf("expected no user, got %s %+v", resp.Data["me"], resp.Errors)
+	}
+
+	_, resp = postGraphQL(t, app, "", `{ users { email } }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != errAuthenticationRequired.Error() {
+		t.Errorf("expected authentication to be required, got %+v", resp.Errors)
+	}
+
+	_, resp = postGraphQL(t, app, "", `mutation { deleteFood(id: 1) }`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != errAuthenticationRequired.Error() {
+		t.Errorf("expected authentication to be required, got %+v", resp.Errors)
+	}
+
+	// a token which is not valid is refused, as it is by /admin
+	rr := serve(app, "not-a-token", http.MethodPost, "/graphql", `{"query": "{ tastes { name } }"}`, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a bad token, got %d", rr.Code)
+	}
+
+	_, resp = postGraphQL(t, app, loggedIn(t, app, 1), `{ me { email } users { email } }`, nil)
+	if len(resp.Errors) > 0 || !strings.Contains(resp.field("me"), "alice@example.com") || !strings.Contains(resp.field("users"), "carol") {
+		t.Errorf("unexpected response %s %+v", resp.Data, resp.Errors)
+	}
+}
+
+func Test_GraphQL_Mutations(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	_, resp := postGraphQL(t, app, token, `mutation($input: FoodInput!) { createFood(input: $input) { id slug version tastes { id } } }`,
+		map[string]interface{}{"input": map[string]interface{}{"knownAs": "Burrito", "countryId": 3, "makeYear": 1900, "tasteIds": []int{1, 5}}})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors %+v", resp.Errors)
+	}
+
+	var food struct {
+		ID      int    `json:"id"`
+		Slug    string `json:"slug"`
+		Version int    `json:"version"`
+		Tastes  []struct {
+			ID int `json:"id"`
+		} `json:"tastes"`
+	}
+	if err := json.Unmarshal(resp.Data["createFood"], &food); err != nil {
+		t.Fatal(err)
+	}
+	if food.Slug != "burrito" || food.Version != 1 || len(food.Tastes) != 2 {
+		t.Errorf("unexpected food %+v", food)
+	}
+
+	// the food is replaced whole, so the tastes left out are removed
+	update := `mutation($id: Int!, $version: Int!) { updateFood(id: $id, version: $version, input: {knownAs: "Burrito", countryId: 3, description: "wrapped"}) { description version tastes { id } } }`
+
+	_, resp = postGraphQL(t, app, token, update, map[string]interface{}{"id": food.ID, "version": 1})
+	if len(resp.Errors) > 0 || resp.field("updateFood") != `{"description":"wrapped","tastes":[],"version":2}` {
+		t.Errorf("unexpected update %s %+v", resp.Data["updateFood"], resp.Errors)
+	}
+
+	_, resp = postGraphQL(t, app, token, update, map[string]interface{}{"id": food.ID, "version": 1})
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "changed by someone else") {
+		t.Errorf("expected a conflict for a stale version, got %+v", resp.Errors)
+	}
+
+	_, resp = postGraphQL(t, app, token, `mutation($id: Int!) { deleteFood(id: $id) }`, map[string]interface{}{"id": food.ID})
+	if len(resp.Errors) > 0 {
+		t.Fatalf("unexpected errors %+v", resp.Errors)
+	}
+	if _, err := app.models.Food.GetOneById(context.Background(), food.ID); err == nil {
+		t.Error("the food was not deleted")
+	}
+
+	// the changes are recorded as made by the logged in user
+	events, _, err := app.models.Audit.GetAll(context.Background(), data.AuditFilter{EntityType: "food", EntityID: food.ID}, 1, 10)
+	if err != nil || len(events) != 3 || events[0].ActorID != 1 {
+		t.Errorf("expected 3 changes by user 1, got %d: %v", len(events), err)
+	}
+
+	_, resp = postGraphQL(t, app, token, `mutation { createUser(input: {email: "dave@example.com", password: "dave-password", active: true}) { email active } }`, nil)
+	if len(resp.Errors) > 0 || resp.field("createUser") != `{"active":true,"email":"dave@example.com"}` {
+		t.Errorf("unexpected user %s %+v", resp.Data["createUser"], resp.Errors)
+	}
+}
+
+func Test_GraphQL_Limits(t *testing.T) {
+	app := newMemoryApp(t)
+	app.config.graphql.maxDepth = 2
+	app.config.graphql.maxComplexity = 50
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"within the limits", `{ foods { knownAs } tastes { name } }`, http.StatusOK},
+		{"too deep", `{ foods { country { name } } }`, http.StatusBadRequest},
+		{"too deep in a fragment", `{ food(id: 1) { ...F } } fragment F on Food { country { id } }`, http.StatusBadRequest},
+		{"too complex", `{ foods { id knownAs slug } countries { id name } tastes { id name } }`, http.StatusBadRequest},
+		{"introspection", `{ __schema { types { name fields { name type { name ofType { name } } } } } }`, http.StatusOK},
+		{"not valid", `{ foods { calories } }`, http.StatusBadRequest},
+		{"not parsed", `{ foods {`, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		status, resp := postGraphQL(t, app, "", e.query, nil)
+		if status != e.status {
+			t.Errorf("%s: expected %d, got %d %+v", e.name, e.status, status, resp.Errors)
+		}
+		if status == http.StatusBadRequest && len(resp.Errors) == 0 {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
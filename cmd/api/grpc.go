@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/food/pkg/foodpb"
+	"github.com/go-chi/chi/v5/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The gRPC server answers food.v1.FoodService, defined in proto/food/v1/food.proto, from the
+// same models as the HTTP routes. Reading is public, as GET /foods is; the changes need the
+// same token as /admin, sent as authorization metadata. Every call gets a request ID and is
+// logged as HTTP requests are, and runs with the client's deadline, or grpc.timeout if that
+// is sooner, which reaches the queries it makes through the context.
+
+// grpcAdminMethods are the calls which need a token
+var grpcAdminMethods = map[string]bool{
+	foodpb.FoodService_CreateFood_FullMethodName: true,
+	foodpb.FoodService_UpdateFood_FullMethodName: true,
+	foodpb.FoodService_DeleteFood_FullMethodName: true,
+}
+
+// grpcServer returns a gRPC server for the API, with server reflection so that tools such
+// as grpcurl can find the calls
+func (app *application) grpcServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		app.grpcAccessLog,
+		app.grpcDeadline,
+		app.grpcAuth,
+	))
+
+	foodpb.RegisterFoodServiceServer(srv, &foodService{app: app})
+	reflection.Register(srv)
+
+	return srv
+}
+
+// stopGRPC waits for the calls srv is answering to finish, and cancels them if they have
+// not when ctx is done
+func stopGRPC(ctx context.Context, srv *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		<-stopped
+		return ctx.Err()
+	}
+}
+
+// grpcAccessLog gives every call a request ID, taken from x-request-id metadata if it is
+// well formed, as RequestID does, and logs it once it has been answered, as AccessLog does.
+// A call which panics is answered with INTERNAL rather than stopping the server.
+func (app *application) grpcAccessLog(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	start := time.Now()
+
+	var id string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDHeader); len(values) > 0 {
+		id = values[0]
+	}
+	if !validRequestID.MatchString(id) {
+		if id, err = randomString(12); err != nil {
+			return nil, status.Error(codes.Internal, "internal server error")
+		}
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+
+	ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+	ctx = context.WithValue(ctx, requestInfoContextKey, &requestInfo{})
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			app.logger.ErrorContext(ctx, "gRPC call panicked", "panic", rec)
+			err = status.Error(codes.Internal, "internal server error")
+		}
+
+		code := status.Code(err)
+		level := slog.LevelInfo
+		if code == codes.Internal || code == codes.Unknown || code == codes.DataLoss {
+			level = slog.LevelError
+		}
+
+		app.logger.Log(ctx, level, "gRPC request",
+			"method", info.FullMethod,
+			"code", code.String(),
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	}()
+
+	return handler(ctx, req)
+}
+
+// grpcDeadline runs every call with a deadline: the client's, or grpc.timeout if that is
+// sooner or the client gave none
+func (app *application) grpcDeadline(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.config.grpc.timeout)
+	defer cancel()
+
+	return handler(ctx, req)
+}
+
+// grpcAuth authenticates a call which sends a token, as AuthTokenMiddleware does a request,
+// refusing it with UNAUTHENTICATED if the token is not valid. A call without one is let
+// through, without a user, unless it is one of grpcAdminMethods.
+func (app *application) grpcAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	values := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(values) == 0 {
+		if grpcAdminMethods[info.FullMethod] {
+			return nil, status.Error(codes.Unauthenticated, "authentication required")
+		}
+		return handler(ctx, req)
+	}
+
+	user, err := data.AuthenticateAuthorization(ctx, values[0], app.models.Token)
+	app.metrics.tokenValidation("grpc", err == nil)
+	if err != nil {
+		app.logger.DebugContext(ctx, "authentication failed", "reason", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid authentication credentials")
+	}
+
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok {
+		info.userID = user.ID
+	}
+
+	return handler(context.WithValue(ctx, userContextKey, user), req)
+}
+
+// grpcActor describes who made a call, and from where, for the audit log, as actor does for
+// a request
+func grpcActor(ctx context.Context) data.Actor {
+	actor := data.Actor{RequestID: middleware.GetReqID(ctx)}
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		actor.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(actor.IP); err == nil {
+			actor.IP = host
+		}
+	}
+
+	if user, ok := ctx.Value(userContextKey).(*data.User); ok {
+		actor.UserID = user.ID
+	}
+
+	return actor
+}
+
+// grpcError returns the status a call fails with for err, with the message errorJSON would
+// send, logging errors which are not the client's fault
+func (app *application) grpcError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "the call took too long")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "call cancelled")
+	}
+
+	shown, statusCode := clientError(err, http.StatusInternalServerError)
+
+	var code codes.Code
+	switch statusCode {
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusForbidden:
+		// the HTTP routes report duplicates and missing countries or tastes as 403
+		code = codes.FailedPrecondition
+	case http.StatusConflict:
+		code = codes.Aborted
+	default:
+		app.logger.ErrorContext(ctx, "gRPC call failed", "err", err)
+		return status.Error(codes.Internal, "internal server error")
+	}
+
+	return status.Error(code, shown.Error())
+}
+
+// foodService implements foodpb.FoodServiceServer
+type foodService struct {
+	foodpb.UnimplementedFoodServiceServer
+	app *application
+}
+
+func (s *foodService) ListFoods(ctx context.Context, req *foodpb.ListFoodsRequest) (*foodpb.ListFoodsResponse, error) {
+	foods, err := s.app.models.Food.Search(ctx, data.FoodFilter{
+		CountryID: int(req.GetCountryId()),
+		TasteID:   int(req.GetTasteId()),
+		Search:    req.GetSearch(),
+	})
+	if err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	// the tastes of every food are loaded in one query
+	ids := make([]int, len(foods))
+	for i, food := range foods {
+		ids[i] = food.ID
+	}
+	tastes, err := s.app.models.Taste.ForFoods(ctx, ids)
+	if err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	resp := &foodpb.ListFoodsResponse{Foods: make([]*foodpb.Food, len(foods))}
+	for i, food := range foods {
+		food.Tastes = tastes[food.ID]
+		resp.Foods[i] = foodMessage(food)
+	}
+
+	return resp, nil
+}
+
+func (s *foodService) GetFood(ctx context.Context, req *foodpb.GetFoodRequest) (*foodpb.Food, error) {
+	var food *data.Food
+	var err error
+
+	switch lookup := req.GetLookup().(type) {
+	case *foodpb.GetFoodRequest_Id:
+		food, err = s.app.models.Food.GetOneById(ctx, int(lookup.Id))
+	case *foodpb.GetFoodRequest_Slug:
+		food, err = s.app.models.Food.GetOneBySlug(ctx, lookup.Slug)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "give the id or the slug of the food")
+	}
+	if err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	return foodMessage(food), nil
+}
+
+func (s *foodService) ListCountries(ctx context.Context, req *foodpb.ListCountriesRequest) (*foodpb.ListCountriesResponse, error) {
+	countries, err := s.app.models.Country.All(ctx)
+	if err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	resp := &foodpb.ListCountriesResponse{Countries: make([]*foodpb.Country, len(countries))}
+	for i, country := range countries {
+		resp.Countries[i] = countryMessage(*country)
+	}
+
+	return resp, nil
+}
+
+func (s *foodService) ListTastes(ctx context.Context, req *foodpb.ListTastesRequest) (*foodpb.ListTastesResponse, error) {
+	tastes, err := s.app.models.Taste.All(ctx)
+	if err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	resp := &foodpb.ListTastesResponse{Tastes: make([]*foodpb.Taste, len(tastes))}
+	for i, taste := range tastes {
+		resp.Tastes[i] = tasteMessage(*taste)
+	}
+
+	return resp, nil
+}
+
+func (s *foodService) CreateFood(ctx context.Context, req *foodpb.CreateFoodRequest) (*foodpb.Food, error) {
+	if req.GetFood() == nil {
+		return nil, status.Error(codes.InvalidArgument, "food is required")
+	}
+
+	id, err := s.app.models.Food.Insert(ctx, foodInputRequest(req.GetFood()).food(), grpcActor(ctx))
+	if err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	return s.GetFood(ctx, &foodpb.GetFoodRequest{Lookup: &foodpb.GetFoodRequest_Id{Id: int32(id)}})
+}
+
+func (s *foodService) UpdateFood(ctx context.Context, req *foodpb.UpdateFoodRequest) (*foodpb.Food, error) {
+	if req.GetFood() == nil {
+		return nil, status.Error(codes.InvalidArgument, "food is required")
+	}
+
+	food := foodInputRequest(req.GetFood()).food()
+	food.ID = int(req.GetId())
+	food.Version = int(req.GetVersion())
+
+	if err := s.app.models.Food.Update(ctx, food, grpcActor(ctx)); err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	return s.GetFood(ctx, &foodpb.GetFoodRequest{Lookup: &foodpb.GetFoodRequest_Id{Id: req.GetId()}})
+}
+
+func (s *foodService) DeleteFood(ctx context.Context, req *foodpb.DeleteFoodRequest) (*foodpb.DeleteFoodResponse, error) {
+	if err := s.app.models.Food.DeleteByID(ctx, int(req.GetId()), grpcActor(ctx)); err != nil {
+		return nil, s.app.grpcError(ctx, err)
+	}
+
+	return &foodpb.DeleteFoodResponse{}, nil
+}
+
+// foodInputRequest returns the food described by a FoodInput, as a foodRequest, so that it
+// is read the same way as the body of POST /v1/foods. A FoodInput is the whole food, so
+// TasteIDs is never nil, and an update without taste_ids removes the food's tastes.
+func foodInputRequest(input *foodpb.FoodInput) foodRequest {
+	req := foodRequest{
+		KnownAs:     input.GetKnownAs(),
+		CountryID:   int(input.GetCountryId()),
+		MakeYear:    int(input.GetMakeYear()),
+		Description: input.GetDescription(),
+		TasteIDs:    []int{},
+	}
+	for _, id := range input.GetTasteIds() {
+		req.TasteIDs = append(req.TasteIDs, int(id))
+	}
+
+	return req
+}
+
+func foodMessage(food *data.Food) *foodpb.Food {
+	msg := &foodpb.Food{
+		Id:          int32(food.ID),
+		KnownAs:     food.KnownAs,
+		Slug:        food.Slug,
+		MakeYear:    int32(food.MakeYear),
+		Description: food.Description,
+		Country:     countryMessage(food.Country),
+		Tastes:      make([]*foodpb.Taste, len(food.Tastes)),
+		CreatedAt:   timestamppb.New(food.CreatedAt),
+		UpdatedAt:   timestamppb.New(food.UpdatedAt),
+		Version:     int32(food.Version),
+	}
+	for i, taste := range food.Tastes {
+		msg.Tastes[i] = tasteMessage(taste)
+	}
+
+	return msg
+}
+
+func countryMessage(country data.Country) *foodpb.Country {
+	return &foodpb.Country{Id: int32(country.ID), Name: country.CountryName}
+}
+
+func tasteMessage(taste data.Taste) *foodpb.Taste {
+	return &foodpb.Taste{Id: int32(taste.ID), Name: taste.Taste}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/food/pkg/foodpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCConn serves app's gRPC server over an in-memory connection, and returns a client
+// connection to it
+func newGRPCConn(t *testing.T, app *application) *grpc.ClientConn {
+	t.Helper()
+
+	ln := bufconn.Listen(1 << 20)
+	srv := app.grpcServer()
+	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// withToken returns ctx with token sent as the authorization metadata of calls made with it
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestGRPC_Read(t *testing.T) {
+	ctx := context.Background()
+	app := newMemoryApp(t)
+	tastes := &countingTastes{TasteStore: app.models.Taste}
+	app.models.Taste = tastes
+	client := foodpb.NewFoodServiceClient(newGRPCConn(t, app))
+
+	resp, err := client.ListFoods(ctx, &foodpb.ListFoodsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetFoods()) != 3 {
+		t.Fatalf("expected 3 foods, got %d", len(resp.GetFoods()))
+	}
+	for _, food := range resp.GetFoods() {
+		if food.GetCountry().GetName() == "" || len(food.GetTastes()) == 0 || food.GetCreatedAt().AsTime().IsZero() {
+			t.Errorf("expected the country, tastes and times of %s, got %v", food.GetKnownAs(), food)
+		}
+	}
+	if n := tastes.calls.Load(); n != 1 {
+		t.Errorf("expected the tastes of every food to be loaded at once, got %d loads", n)
+	}
+
+	resp, err = client.ListFoods(ctx, &foodpb.ListFoodsRequest{TasteId: 4, Search: "piz"})
+	if err != nil || len(resp.GetFoods()) != 1 || resp.GetFoods()[0].GetKnownAs() != "Pizza" {
+		t.Errorf("expected Pizza, got %v %v", resp.GetFoods(), err)
+	}
+
+	food, err := client.GetFood(ctx, &foodpb.GetFoodRequest{Lookup: &foodpb.GetFoodRequest_Slug{Slug: "ramen"}})
+	if err != nil || food.GetId() != 3 || food.GetCountry().GetName() != "Japan" || len(food.GetTastes()) != 1 {
+		t.Errorf("unexpected food %v: %v", food, err)
+	}
+
+	if _, err := client.GetFood(ctx, &foodpb.GetFoodRequest{Lookup: &foodpb.GetFoodRequest_Id{Id: 99}}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NOT_FOUND, got %v", err)
+	}
+	if _, err := client.GetFood(ctx, &foodpb.GetFoodRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected INVALID_ARGUMENT without an id or slug, got %v", err)
+	}
+
+	countries, err := client.ListCountries(ctx, &foodpb.ListCountriesRequest{})
+	if err != nil || len(countries.GetCountries()) != 3 {
+		t.Errorf("expected 3 countries, got %v %v", countries.GetCountries(), err)
+	}
+
+	all, err := client.ListTastes(ctx, &foodpb.ListTastesRequest{})
+	if err != nil || len(all.GetTastes()) != 5 || all.GetTastes()[0].GetName() == "" {
+		t.Errorf("expected 5 tastes, got %v %v", all.GetTastes(), err)
+	}
+}
+
+func TestGRPC_Admin(t *testing.T) {
+	ctx := context.Background()
+	app := newMemoryApp(t)
+	client := foodpb.NewFoodServiceClient(newGRPCConn(t, app))
+	input := &foodpb.FoodInput{KnownAs: "Burrito", CountryId: 3, MakeYear: 1900, TasteIds: []int32{1, 5}}
+
+	if _, err := client.CreateFood(ctx, &foodpb.CreateFoodRequest{Food: input}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected UNAUTHENTICATED without a token, got %v", err)
+	}
+
+	// a token which is not valid is refused, even where none is needed
+	if _, err := client.ListTastes(withToken(ctx, "not-a-token"), &foodpb.ListTastesRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected UNAUTHENTICATED for a bad token, got %v", err)
+	}
+
+	ctx = withToken(ctx, loggedIn(t, app, 1))
+	ctx = metadata.AppendToOutgoingContext(ctx, requestIDHeader, "grpc-test-1")
+
+	var header metadata.MD
+	food, err := client.CreateFood(ctx, &foodpb.CreateFoodRequest{Food: input}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if food.GetSlug() != "burrito" || food.GetVersion() != 1 || len(food.GetTastes()) != 2 {
+		t.Errorf("unexpected food %v", food)
+	}
+	if ids := header.Get(requestIDHeader); len(ids) != 1 || ids[0] != "grpc-test-1" {
+		t.Errorf("expected the request ID back, got %v", ids)
+	}
+
+	input.Description = "wrapped"
+	food, err = client.UpdateFood(ctx, &foodpb.UpdateFoodRequest{Id: food.GetId(), Version: 1, Food: input})
+	if err != nil || food.GetDescription() != "wrapped" || food.GetVersion() != 2 {
+		t.Fatalf("unexpected update %v: %v", food, err)
+	}
+	// the food is replaced whole, so tastes left out are removed
+	food, err = client.UpdateFood(ctx, &foodpb.UpdateFoodRequest{Id: food.GetId(), Version: 2, Food: &foodpb.FoodInput{KnownAs: "Burrito", CountryId: 3}})
+	if err != nil || len(food.GetTastes()) != 0 || food.GetVersion() != 3 {
+		t.Fatalf("expected the tastes to be removed, got %v: %v", food, err)
+	}
+	if _, err := client.UpdateFood(ctx, &foodpb.UpdateFoodRequest{Id: food.GetId(), Version: 1, Food: input}); status.Code(err) != codes.Aborted {
+		t.Errorf("expected ABORTED for a stale version, got %v", err)
+	}
+	if _, err := client.UpdateFood(ctx, &foodpb.UpdateFoodRequest{Id: 99, Version: 1, Food: input}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NOT_FOUND, got %v", err)
+	}
+
+	if _, err := client.DeleteFood(ctx, &foodpb.DeleteFoodRequest{Id: food.GetId()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetFood(ctx, &foodpb.GetFoodRequest{Lookup: &foodpb.GetFoodRequest_Id{Id: food.GetId()}}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NOT_FOUND for a deleted food, got %v", err)
+	}
+	if _, err := client.DeleteFood(ctx, &foodpb.DeleteFoodRequest{Id: food.GetId()}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NOT_FOUND deleting a deleted food, got %v", err)
+	}
+
+	// the changes are recorded as made by the logged in user, with the request ID
+	events, _, err := app.models.Audit.GetAll(context.Background(), data.AuditFilter{EntityType: "food", EntityID: int(food.GetId())}, 1, 10)
+	if err != nil || len(events) != 4 {
+		t.Fatalf("expected 4 changes, got %d: %v", len(events), err)
+	}
+	for _, e := range events {
+		if e.ActorID != 1 || e.RequestID != "grpc-test-1" {
+			t.Errorf("unexpected actor %d and request ID %q", e.ActorID, e.RequestID)
+		}
+	}
+}
+
+// slowTastes blocks until the context of a call is done, recording its deadline
+type slowTastes struct {
+	data.TasteStore
+	deadline chan time.Time
+}
+
+func (s *slowTastes) All(ctx context.Context) ([]*data.Taste, error) {
+	deadline, _ := ctx.Deadline()
+	s.deadline <- deadline
+
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGRPC_Deadline(t *testing.T) {
+	app := newMemoryApp(t)
+	tastes := &slowTastes{TasteStore: app.models.Taste, deadline: make(chan time.Time, 1)}
+	app.models.Taste = tastes
+	client := foodpb.NewFoodServiceClient(newGRPCConn(t, app))
+
+	// the client's deadline reaches the store; it is sent as a timeout, so arrives a little
+	// later than it was set
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	want, _ := ctx.Deadline()
+
+	if _, err := client.ListTastes(ctx, &foodpb.ListTastesRequest{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DEADLINE_EXCEEDED, got %v", err)
+	}
+	if got := <-tastes.deadline; got.IsZero() || got.Sub(want).Abs() > 25*time.Millisecond {
+		t.Errorf("expected the store to be given the deadline %v, got %v", want, got)
+	}
+
+	// without one, the call is given grpc.timeout
+	app.config.grpc.timeout = 20 * time.Millisecond
+	start := time.Now()
+
+	if _, err := client.ListTastes(context.Background(), &foodpb.ListTastesRequest{}); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("expected DEADLINE_EXCEEDED, got %v", err)
+	}
+	if got := <-tastes.deadline; got.IsZero() || got.Sub(start) > time.Second {
+		t.Errorf("expected a deadline of grpc.timeout, got %v", got.Sub(start))
+	}
+}
+
+func TestGRPC_Reflection(t *testing.T) {
+	conn := newGRPCConn(t, newMemoryApp(t))
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.CloseSend()
+
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		found = found || svc.GetName() == "food.v1.FoodService"
+	}
+	if !found {
+		t.Errorf("food.v1.FoodService is not listed: %v", resp.GetListServicesResponse())
+	}
+
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "food.v1.FoodService"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetFileDescriptorResponse().GetFileDescriptorProto()) == 0 {
+		t.Errorf("expected the descriptor of food.v1.FoodService, got %v", resp)
+	}
+}
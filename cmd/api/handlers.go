@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/food/internal/data"
@@ -14,8 +16,6 @@ import (
 	"github.com/mozillazg/go-slugify"
 )
 
-var staticPath = "./static/"
-
 // jsonResponse is the type used for generic JSON responses
 type jsonResponse struct {
 	Error   bool        `json:"error"`
@@ -25,27 +25,40 @@ type jsonResponse struct {
 
 type envelope map[string]interface{}
 
+// credentials is the JSON a user sends to log in
+type credentials struct {
+	UserName string `json:"email"`
+	Password string `json:"password"`
+}
+
+// tokenRequest is the JSON a client sends to present a plain text token
+type tokenRequest struct {
+	Token string `json:"token"`
+}
+
+// idRequest is the JSON a client sends to name a record by its id
+type idRequest struct {
+	ID int `json:"id"`
+}
+
 // Login is the handler used to attempt to log a user into the api
 func (app *application) Login(w http.ResponseWriter, r *http.Request) {
-	type credentials struct {
-		UserName string `json:"email"`
-		Password string `json:"password"`
-	}
-
 	var creds credentials
 	var payload jsonResponse
 
 	err := app.readJSON(w, r, &creds)
 	if err != nil {
-		app.errorLog.Println(err)
+		app.logger.DebugContext(r.Context(), "invalid login request", "err", err)
 		payload.Error = true
 		payload.Message = "invalid json supplied, or json missing entirely"
 		_ = app.writeJSON(w, http.StatusBadRequest, payload)
+		return
 	}
 
 	// look up the user by email
-	user, err := app.models.User.GetByEmail(creds.UserName)
+	user, err := app.models.User.GetByEmail(r.Context(), creds.UserName)
 	if err != nil {
+		app.metrics.login("password", loginInvalidCredentials)
 		app.errorJSON(w, errors.New("invalid username/password"))
 		return
 	}
@@ -53,47 +66,60 @@ func (app *application) Login(w http.ResponseWriter, r *http.Request) {
 	// validate the user's password
 	validPassword, err := user.PasswordMatches(creds.Password)
 	if err != nil || !validPassword {
+		app.metrics.login("password", loginInvalidCredentials)
 		app.errorJSON(w, errors.New("invalid username/password"))
 		return
 	}
 
 	// make sure user is active
 	if user.Active == 0 {
+		app.metrics.login("password", loginInactive)
 		app.errorJSON(w, errors.New("user is not active"))
 		return
 	}
 
+	if app.issueToken(w, r, user) {
+		app.metrics.login("password", loginSuccess)
+	} else {
+		app.metrics.login("password", loginError)
+	}
+}
+
+// issueToken generates and saves a new token for a user who has successfully logged in,
+// and sends it back to the client along with the user. It returns false if the token could
+// not be issued, in which case an error has been sent to the client.
+func (app *application) issueToken(w http.ResponseWriter, r *http.Request, user *data.User) bool {
 	// we have a valid user, so generate a token
-	token, err := app.models.Token.GenerateToken(user.ID, 24*time.Hour)
+	token, err := data.GenerateToken(user.ID, app.config.auth.tokenTTL)
 	if err != nil {
 		app.errorJSON(w, err)
-		return
+		return false
 	}
 
 	// save it to the database
-	err = app.models.Token.Insert(*token, *user)
+	err = app.models.Token.Insert(r.Context(), *token, *user)
 	if err != nil {
 		app.errorJSON(w, err)
-		return
+		return false
 	}
 
 	// send back a response
-	payload = jsonResponse{
+	payload := jsonResponse{
 		Error:   false,
 		Message: "logged in",
-		Data:    envelope{"token": token, "user": user},
+		Data:    envelope{"token": token, "user": newUserResponse(user)},
 	}
 
 	err = app.writeJSON(w, http.StatusOK, payload)
 	if err != nil {
-		app.errorLog.Println(err)
+		app.logger.ErrorContext(r.Context(), "could not write response", "err", err)
 	}
+
+	return true
 }
 
 func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		Token string `json:"token"`
-	}
+	var requestPayload tokenRequest
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
@@ -101,7 +127,7 @@ func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Token.DeleteByToken(requestPayload.Token)
+	err = app.models.Token.DeleteByToken(r.Context(), requestPayload.Token)
 	if err != nil {
 		app.errorJSON(w, errors.New("invalid json"))
 		return
@@ -119,95 +145,360 @@ func (app *application) Logout(w http.ResponseWriter, r *http.Request) {
 // handler should be protected in the routes file, and require that
 // the user have a valid token
 func (app *application) AllUsers(w http.ResponseWriter, r *http.Request) {
-	var users data.User
-	all, err := users.GetAll()
+	all, err := app.models.User.GetAll(r.Context())
 	if err != nil {
-		app.errorLog.Println(err)
+		app.logger.ErrorContext(r.Context(), "could not list users", "err", err)
+		app.errorJSON(w, errors.New("could not list users"), http.StatusInternalServerError)
 		return
 	}
 
 	payload := jsonResponse{
 		Error:   false,
 		Message: "success",
-		Data:    envelope{"users": all},
+		Data:    envelope{"users": newUserListResponse(all)},
 	}
 
 	app.writeJSON(w, http.StatusOK, payload)
 }
 
+// userRequest is the JSON a client sends to create or change a user
+type userRequest struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password"`
+	Active    int    `json:"active"`
+	Version   int    `json:"version"`
+}
+
+// user returns the user described by the request
+func (req userRequest) user() data.User {
+	return data.User{
+		ID:        req.ID,
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Password:  req.Password,
+		Active:    req.Active,
+	}
+}
+
 // EditUser saves a new user, or updates a user, in the database
 func (app *application) EditUser(w http.ResponseWriter, r *http.Request) {
-	var user data.User
-	err := app.readJSON(w, r, &user)
+	var requestPayload userRequest
+
+	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	if user.ID == 0 {
+	if requestPayload.ID == 0 {
 		// add user
-		if _, err := app.models.User.Insert(user); err != nil {
+		if _, err := app.models.User.Insert(r.Context(), requestPayload.user(), app.actor(r)); err != nil {
 			app.errorJSON(w, err)
 			return
 		}
-	} else {
+	} else if !app.updateUser(w, r, requestPayload) {
 		// editing user
-		u, err := app.models.User.GetOne(user.ID)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "Changes saved",
+	}
+
+	_ = app.writeJSON(w, http.StatusAccepted, payload)
+}
+
+// updateUser applies the changes in req to the user it names, setting a new password if it
+// has one. It returns false if the user could not be updated, in which case an error, or
+// the user as it is now if someone else changed it first, has been sent to the client.
+func (app *application) updateUser(w http.ResponseWriter, r *http.Request, req userRequest) bool {
+	version, ifMatch, err := app.requestedVersion(r, req.Version)
+	if err != nil {
+		app.errorJSON(w, err)
+		return false
+	}
+
+	u, err := app.models.User.GetOne(r.Context(), req.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return false
+	}
+
+	u.Email = req.Email
+	u.FirstName = req.FirstName
+	u.LastName = req.LastName
+	u.Active = req.Active
+	u.Version = version
+
+	err = app.models.User.Update(r.Context(), *u, app.actor(r))
+	if errors.Is(err, data.ErrEditConflict) {
+		current, err := app.models.User.GetOne(r.Context(), req.ID)
+		if err != nil {
+			app.errorJSON(w, err)
+			return false
+		}
+
+		app.editConflict(w, ifMatch, newUserResponse(current), current.Version)
+		return false
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return false
+	}
+
+	// if password != string, update password
+	if req.Password != "" {
+		err := app.models.User.ResetPassword(r.Context(), u.ID, req.Password, app.actor(r))
 		if err != nil {
 			app.errorJSON(w, err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetUser returns one user as JSON
+func (app *application) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	user, err := app.models.User.GetOne(r.Context(), userID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", versionETag(user.Version))
+
+	_ = app.writeJSON(w, http.StatusOK, newUserResponse(user), headers)
+}
+
+// Me returns the user who made the request as JSON
+func (app *application) Me(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  envelope{"user": newUserResponse(user)},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// updateMeRequest is the JSON a user sends to change their own details. A field left out is
+// left as it is.
+type updateMeRequest struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+	Email     *string `json:"email"`
+}
+
+// UpdateMe lets the user who made the request change their own name and email address. Any
+// field left out of the JSON is left as it is. A new email address only takes effect once the
+// user follows the link we send to it. Either the whole request is applied or none of it is:
+// the address is checked and the link sent before the name is saved, and the link is
+// withdrawn if saving the name fails.
+func (app *application) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	var requestPayload updateMeRequest
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	user := app.authenticatedUser(r)
+	changeEmail := requestPayload.Email != nil && *requestPayload.Email != user.Email
+
+	if changeEmail {
+		if *requestPayload.Email == "" {
+			app.errorJSON(w, errors.New("email cannot be empty"))
+			return
+		}
+		if !validEmail(*requestPayload.Email) {
+			app.errorJSON(w, errors.New("email must be an address such as name@example.com"))
 			return
 		}
+	}
 
-		u.Email = user.Email
-		u.FirstName = user.FirstName
-		u.LastName = user.LastName
-		u.Active = user.Active
+	message := "Changes saved"
 
-		if err := u.Update(); err != nil {
+	if changeEmail {
+		verification, err := data.GenerateEmailVerification(user.ID, *requestPayload.Email, app.config.auth.emailVerificationTTL)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+
+		err = app.models.EmailVerification.Insert(r.Context(), *verification)
+		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
 
-		// if password != string, update password
-		if user.Password != "" {
-			err := u.ResetPassword(user.Password)
-			if err != nil {
-				app.errorJSON(w, err)
-				return
+		err = app.mailer.Send(mailMessage{
+			To:      verification.Email,
+			Subject: "Confirm your new email address",
+			Body: fmt.Sprintf("Follow this link to confirm your new email address:\n\n%s/verify-email?token=%s\n",
+				app.config.frontendURL, verification.Token),
+		})
+		if err != nil {
+			app.logger.ErrorContext(r.Context(), "could not send verification email", "err", err)
+			app.withdrawEmailVerification(r, user.ID)
+			app.errorJSON(w, errors.New("could not send verification email"), http.StatusInternalServerError)
+			return
+		}
+
+		message = "Changes saved; check your inbox to confirm your new email address"
+	}
+
+	if requestPayload.FirstName != nil || requestPayload.LastName != nil {
+		if requestPayload.FirstName != nil {
+			user.FirstName = *requestPayload.FirstName
+		}
+		if requestPayload.LastName != nil {
+			user.LastName = *requestPayload.LastName
+		}
+
+		if err := app.models.User.Update(r.Context(), *user, app.actor(r)); err != nil {
+			if changeEmail {
+				app.withdrawEmailVerification(r, user.ID)
 			}
+			app.errorJSON(w, err)
+			return
 		}
 	}
 
 	payload := jsonResponse{
 		Error:   false,
-		Message: "Changes saved",
+		Message: message,
 	}
 
-	_ = app.writeJSON(w, http.StatusAccepted, payload)
+	_ = app.writeJSON(w, http.StatusOK, payload)
 }
 
-// GetUser returns one user as JSON
-func (app *application) GetUser(w http.ResponseWriter, r *http.Request) {
-	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+// withdrawEmailVerification deletes the verification just sent to the user with userID,
+// because the rest of their request failed, so that following the link changes nothing. A
+// failure is only logged: the link expires in any case.
+func (app *application) withdrawEmailVerification(r *http.Request, userID int) {
+	if err := app.models.EmailVerification.DeleteForUser(context.WithoutCancel(r.Context()), userID); err != nil {
+		app.logger.ErrorContext(r.Context(), "could not withdraw email verification", "err", err)
+	}
+}
+
+// changePasswordRequest is the JSON a user sends to change their own password
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangeMyPassword lets the user who made the request change their own password, provided they
+// know their current one. Every other session the user has is logged out.
+func (app *application) ChangeMyPassword(w http.ResponseWriter, r *http.Request) {
+	var requestPayload changePasswordRequest
+
+	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	user, err := app.models.User.GetOne(userID)
+	user := app.authenticatedUser(r)
+
+	validPassword, err := user.PasswordMatches(requestPayload.CurrentPassword)
+	if err != nil || !validPassword {
+		app.errorJSON(w, errors.New("current password is incorrect"))
+		return
+	}
+
+	if requestPayload.NewPassword == "" {
+		app.errorJSON(w, errors.New("new password cannot be empty"))
+		return
+	}
+
+	err = app.models.User.ResetPassword(r.Context(), user.ID, requestPayload.NewPassword, app.actor(r))
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	_ = app.writeJSON(w, http.StatusOK, user)
+	// AuthTokenMiddleware has already checked the header, so we know it is well formed
+	currentToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	err = app.models.Token.DeleteOtherTokensForUser(r.Context(), user.ID, currentToken)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "password changed",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
+
+// VerifyEmail accepts a JSON payload with the token sent by UpdateMe, and changes the
+// user's email address to the one the token was sent to
+func (app *application) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var requestPayload tokenRequest
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	verification, err := app.models.EmailVerification.GetByToken(r.Context(), requestPayload.Token)
+	if err != nil || verification.Expiry.Before(time.Now()) {
+		app.errorJSON(w, errors.New("invalid or expired verification token"))
+		return
+	}
+
+	user, err := app.models.User.GetOne(r.Context(), verification.UserID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// the request is not authenticated, but the token proves it was made by the user
+	actor := app.actor(r)
+	actor.UserID = user.ID
+
+	user.Email = verification.Email
+	err = app.models.User.Update(r.Context(), *user, actor)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	err = app.models.EmailVerification.DeleteForUser(r.Context(), user.ID)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "email address confirmed",
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
 }
 
 // DeleteUser delets a user from the users table by the id given in the supplied JSON file
 func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		ID int `json:"id"`
-	}
+	var requestPayload idRequest
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
@@ -215,7 +506,7 @@ func (app *application) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.User.DeleteByID(requestPayload.ID)
+	err = app.models.User.DeleteByID(r.Context(), requestPayload.ID, app.actor(r))
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -239,21 +530,21 @@ func (app *application) LogUserOutAndSetInactive(w http.ResponseWriter, r *http.
 		return
 	}
 
-	user, err := app.models.User.GetOne(userID)
+	user, err := app.models.User.GetOne(r.Context(), userID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
 	user.Active = 0
-	err = user.Update()
+	err = app.models.User.Update(r.Context(), *user, app.actor(r))
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
 	// delete tokens for user
-	err = app.models.Token.DeleteTokensForUser(userID)
+	err = app.models.Token.DeleteTokensForUser(r.Context(), userID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -270,9 +561,7 @@ func (app *application) LogUserOutAndSetInactive(w http.ResponseWriter, r *http.
 // ValidateToken accepts a JSON payload with a plain text token, and returns
 // true if that token is valid, or false if it is not, as a JSON response
 func (app *application) ValidateToken(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		Token string `json:"token"`
-	}
+	var requestPayload tokenRequest
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
@@ -281,7 +570,8 @@ func (app *application) ValidateToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	valid := false
-	valid, _ = app.models.Token.ValidToken(requestPayload.Token)
+	valid, _ = data.ValidToken(r.Context(), app.models.Token, requestPayload.Token)
+	app.metrics.tokenValidation("endpoint", valid)
 
 	payload := jsonResponse{
 		Error: false,
@@ -293,7 +583,7 @@ func (app *application) ValidateToken(w http.ResponseWriter, r *http.Request) {
 
 // AllFoods returns all foods as JSON
 func (app *application) AllFoods(w http.ResponseWriter, r *http.Request) {
-	foods, err := app.models.Food.GetAll()
+	foods, err := app.models.Food.GetAll(r.Context())
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -312,7 +602,7 @@ func (app *application) AllFoods(w http.ResponseWriter, r *http.Request) {
 func (app *application) OneFood(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 
-	food, err := app.models.Food.GetOneBySlug(slug)
+	food, err := app.models.Food.GetOneBySlug(r.Context(), slug)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -323,26 +613,28 @@ func (app *application) OneFood(w http.ResponseWriter, r *http.Request) {
 		Data:  food,
 	}
 
-	app.writeJSON(w, http.StatusOK, payload)
+	// only a single food has a Last-Modified: removing a food from a list would not change the list's
+	app.writeJSON(w, http.StatusOK, payload, lastModified(food.UpdatedAt, food.Country.UpdatedAt))
+}
+
+// countryOption is a country as an option of a select box in the front end
+type countryOption struct {
+	Value int    `json:"value"`
+	Text  string `json:"text"`
 }
 
 // CountriesAll returns a list of all countries consisting of country id and country name, as JSON
 func (app *application) CountriesAll(w http.ResponseWriter, r *http.Request) {
-	all, err := app.models.Country.All()
+	all, err := app.models.Country.All(r.Context())
 	if err != nil {
 		app.errorJSON(w, err)
 		return
 	}
 
-	type selectData struct {
-		Value int    `json:"value"`
-		Text  string `json:"text"`
-	}
-
-	var results []selectData
+	var results []countryOption
 
 	for _, x := range all {
-		country := selectData{
+		country := countryOption{
 			Value: x.ID,
 			Text:  x.CountryName,
 		}
@@ -358,17 +650,34 @@ func (app *application) CountriesAll(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, payload)
 }
 
+// foodRequest is the JSON a client sends to create or change a food
+type foodRequest struct {
+	ID           int    `json:"id"`
+	KnownAs      string `json:"known_as"`
+	CountryID    int    `json:"country_id"`
+	MakeYear     int    `json:"make_year"`
+	Description  string `json:"description"`
+	SampleBase64 string `json:"sample"`
+	TasteIDs     []int  `json:"taste_ids"`
+	Version      int    `json:"version"`
+}
+
+// food returns the food described by the request
+func (req foodRequest) food() data.Food {
+	return data.Food{
+		ID:          req.ID,
+		KnownAs:     req.KnownAs,
+		CountryID:   req.CountryID,
+		MakeYear:    req.MakeYear,
+		Description: req.Description,
+		Slug:        slugify.Slugify(req.KnownAs),
+		TasteIDs:    req.TasteIDs,
+	}
+}
+
 // EditFood accepts Food as JSON and makes DB calls to either insert or update Food
 func (app *application) EditFood(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		ID           int    `json:"id"`
-		KnownAs      string `json:"known_as"`
-		CountryID    int    `json:"country_id"`
-		MakeYear     int    `json:"make_year"`
-		Description  string `json:"description"`
-		SampleBase64 string `json:"sample"`
-		TasteIDs     []int  `json:"taste_ids"`
-	}
+	var requestPayload foodRequest
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
@@ -376,45 +685,32 @@ func (app *application) EditFood(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	food := data.Food{
-		ID:          requestPayload.ID,
-		KnownAs:     requestPayload.KnownAs,
-		CountryID:   requestPayload.CountryID,
-		MakeYear:    requestPayload.MakeYear,
-		Description: requestPayload.Description,
-		Slug:        slugify.Slugify(requestPayload.KnownAs),
-		TasteIDs:    requestPayload.TasteIDs,
-	}
+	food := requestPayload.food()
 
-	if len(requestPayload.SampleBase64) > 0 {
-		// we have a sample
-		decoded, err := base64.StdEncoding.DecodeString(requestPayload.SampleBase64)
+	var ifMatch bool
+	if food.ID != 0 {
+		food.Version, ifMatch, err = app.requestedVersion(r, requestPayload.Version)
 		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
+	}
 
-		// write image to /static/samples
-		if err := os.WriteFile(fmt.Sprintf("%s/samples/%s.jpg", staticPath, food.Slug), decoded, 0666); err != nil {
-			app.errorJSON(w, err)
-			return
-		}
+	if err := app.saveSample(food.Slug, requestPayload.SampleBase64); err != nil {
+		app.errorJSON(w, err)
+		return
 	}
 
 	if food.ID == 0 {
 		// adding a food
-		_, err := app.models.Food.Insert(food)
+		_, err := app.models.Food.Insert(r.Context(), food, app.actor(r))
 		if err != nil {
 			app.errorJSON(w, err)
 			return
 		}
-	} else {
+	} else if !app.updateFood(w, r, food, ifMatch) {
 		// updating a food
-		err := food.Update()
-		if err != nil {
-			app.errorJSON(w, err)
-			return
-		}
+		return
 	}
 
 	payload := jsonResponse{
@@ -425,6 +721,44 @@ func (app *application) EditFood(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusAccepted, payload)
 }
 
+// saveSample writes the base64 encoded sample image of the food with slug to
+// /static/samples, if there is one
+func (app *application) saveSample(slug, sampleBase64 string) error {
+	if len(sampleBase64) == 0 {
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(sampleBase64)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fmt.Sprintf("%s/samples/%s.jpg", app.config.staticPath, slug), decoded, 0666)
+}
+
+// updateFood saves changes to a food. It returns false if the food could not be updated, in
+// which case an error, or the food as it is now if someone else changed it first, has been
+// sent to the client.
+func (app *application) updateFood(w http.ResponseWriter, r *http.Request, food data.Food, ifMatch bool) bool {
+	err := app.models.Food.Update(r.Context(), food, app.actor(r))
+	if errors.Is(err, data.ErrEditConflict) {
+		current, err := app.models.Food.GetOneById(r.Context(), food.ID)
+		if err != nil {
+			app.errorJSON(w, err)
+			return false
+		}
+
+		app.editConflict(w, ifMatch, current, current.Version)
+		return false
+	}
+	if err != nil {
+		app.errorJSON(w, err)
+		return false
+	}
+
+	return true
+}
+
 // FoodByID returns one food as JSON, by ID
 func (app *application) FoodByID(w http.ResponseWriter, r *http.Request) {
 	foodID, err := strconv.Atoi(chi.URLParam(r, "id"))
@@ -433,7 +767,7 @@ func (app *application) FoodByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	food, err := app.models.Food.GetOneById(foodID)
+	food, err := app.models.Food.GetOneById(r.Context(), foodID)
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -444,14 +778,15 @@ func (app *application) FoodByID(w http.ResponseWriter, r *http.Request) {
 		Data:  food,
 	}
 
-	app.writeJSON(w, http.StatusOK, payload)
+	headers := http.Header{}
+	headers.Set("ETag", versionETag(food.Version))
+
+	app.writeJSON(w, http.StatusOK, payload, headers)
 }
 
 // DeleteFood accepts an ID and calls DB to delete one Food
 func (app *application) DeleteFood(w http.ResponseWriter, r *http.Request) {
-	var requestPayload struct {
-		ID int `json:"id"`
-	}
+	var requestPayload idRequest
 
 	err := app.readJSON(w, r, &requestPayload)
 	if err != nil {
@@ -459,7 +794,7 @@ func (app *application) DeleteFood(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Food.DeleteByID(requestPayload.ID)
+	err = app.models.Food.DeleteByID(r.Context(), requestPayload.ID, app.actor(r))
 	if err != nil {
 		app.errorJSON(w, err)
 		return
@@ -473,3 +808,68 @@ func (app *application) DeleteFood(w http.ResponseWriter, r *http.Request) {
 	app.writeJSON(w, http.StatusOK, payload)
 
 }
+
+// AuditLog returns one page of the audit log as JSON, newest first. The log can be filtered
+// by entity type and id, by the id of the user who made the change, and by time; for example
+// /admin/audit?entity=food&entity_id=1&actor=2&since=2022-01-01T00:00:00Z&page=1&page_size=50
+func (app *application) AuditLog(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	filter := data.AuditFilter{
+		EntityType: qs.Get("entity"),
+	}
+
+	var err error
+	var page, pageSize int
+
+	ints := []struct {
+		key string
+		def int
+		dst *int
+	}{
+		{"entity_id", 0, &filter.EntityID},
+		{"actor", 0, &filter.ActorID},
+		{"page", 1, &page},
+		{"page_size", 50, &pageSize},
+	}
+
+	for _, x := range ints {
+		*x.dst, err = app.readInt(qs, x.key, x.def)
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+	}
+
+	if page < 1 || pageSize < 1 || pageSize > 100 {
+		app.errorJSON(w, errors.New("page must be at least 1, and page_size between 1 and 100"))
+		return
+	}
+
+	if since := qs.Get("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			app.errorJSON(w, errors.New("since must be an RFC 3339 timestamp"))
+			return
+		}
+	}
+
+	events, total, err := app.models.Audit.GetAll(r.Context(), filter, page, pageSize)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	payload := jsonResponse{
+		Error:   false,
+		Message: "success",
+		Data: envelope{
+			"events":    events,
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		},
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, payload)
+}
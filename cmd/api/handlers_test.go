@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/food/internal/data"
+	"github.com/go-chi/chi/v5"
+	"github.com/graphql-go/graphql"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestApplication_AllUsers(t *testing.T) {
 	// create some mock rows, and add one row
-	var mockedRows = mockedDB.NewRows([]string{"id", "email", "first_name", "last_name", "password", "active", "created_at", "updated_at", "has_token"})
-	mockedRows.AddRow("1", "me@here.com", "Jack", "Smith", "abc123", "1", time.Now(), time.Now(), "0")
+	var mockedRows = mockedDB.NewRows([]string{"id", "email", "first_name", "last_name", "active", "created_at", "updated_at", "version", "has_token"})
+	mockedRows.AddRow("1", "me@here.com", "Jack", "Smith", "1", time.Now(), time.Now(), "1", "0")
 
 	// tell mock what queries we expect
 	mockedDB.ExpectQuery("select \\\\* ").WillReturnRows(mockedRows)
@@ -28,3 +39,303 @@ func TestApplication_AllUsers(t *testing.T) {
 		t.Error("AllUsers returned wrong status code of", rr.Code)
 	}
 }
+
+// TestApplication_NoPasswordHashLeaks calls the handlers which read users straight from the
+// database, with it returning a real bcrypt hash, and makes sure the hash never reaches the
+// client. TestRoutes_NoPasswordHashLeaks checks every route and GraphQL field.
+func TestApplication_NoPasswordHashLeaks(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &data.User{ID: 1, Email: "me@here.com", FirstName: "Jack", LastName: "Smith", Password: string(hash), Active: 1}
+
+	tests := []struct {
+		name    string
+		expect  func(mock sqlmock.Sqlmock)
+		handler func(app *application, w http.ResponseWriter, r *http.Request)
+		request *http.Request
+	}{
+		{
+			name: "Login",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("from users where email").
+					WillReturnRows(userRows().AddRow(1, "me@here.com", "Jack", "Smith", string(hash), 1, time.Now(), time.Now(), 1))
+				mock.ExpectExec("delete from tokens").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("insert into tokens").WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			handler: (*application).Login,
+			request: httptest.NewRequest("POST", "/users/login", strings.NewReader(`{"email": "me@here.com", "password": "secret"}`)),
+		},
+		{
+			name: "AllUsers",
+			expect: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "user_active", "created_at", "updated_at", "version", "has_token"})
+				mock.ExpectQuery("from users order by last_name").
+					WillReturnRows(rows.AddRow(1, "me@here.com", "Jack", "Smith", 1, time.Now(), time.Now(), 1, true))
+			},
+			handler: (*application).AllUsers,
+			request: httptest.NewRequest("GET", "/admin/users", nil),
+		},
+		{
+			name: "GetUser",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("from users where id").
+					WillReturnRows(userRows().AddRow(1, "me@here.com", "Jack", "Smith", string(hash), 1, time.Now(), time.Now(), 1))
+			},
+			handler: (*application).GetUser,
+			request: requestWithURLParam(httptest.NewRequest("GET", "/admin/users/get/1", nil), "id", "1"),
+		},
+		{
+			name:    "Me",
+			expect:  func(mock sqlmock.Sqlmock) {},
+			handler: (*application).Me,
+			request: meRequest("GET", "/me", "", user),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, mock := newMockedApp(t)
+			tt.expect(mock)
+
+			rr := httptest.NewRecorder()
+			tt.handler(app, rr, tt.request)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("%s returned wrong status code of %d: %s", tt.name, rr.Code, rr.Body.String())
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+
+			body := rr.Body.String()
+			if strings.Contains(body, string(hash)) || strings.Contains(body, "$2a$") || strings.Contains(body, `"password"`) {
+				t.Errorf("%s leaked a password hash: %s", tt.name, body)
+			}
+		})
+	}
+
+	// and in case a handler ever sends a data.User directly
+	out, _ := json.Marshal(user)
+	if strings.Contains(string(out), "$2a$") {
+		t.Error("data.User marshals its password hash")
+	}
+}
+
+// leaksPassword reports whether body, a response which returns users, holds a password or its
+// hash. Any response may describe a password, as /openapi.json does, but none may hold a hash.
+func leaksPassword(body string, returnsUsers bool) bool {
+	return strings.Contains(body, "$2a$") || returnsUsers && strings.Contains(body, `"password"`)
+}
+
+// TestRoutes_NoPasswordHashLeaks sends a request to every route, and asks every GraphQL field
+// which returns users, with the memory store holding users with real bcrypt hashes, and makes
+// sure no hash reaches the client. The requests listed must get the status given, so that the
+// routes which return users are seen to return them; every other route is called without a
+// body. A GraphQL field which returns users must have a query here, or the test fails.
+func TestRoutes_NoPasswordHashLeaks(t *testing.T) {
+	type leakRequest struct {
+		target  string
+		body    string
+		headers map[string]string
+		status  int
+		setup   func(t *testing.T, app *application, token string)
+	}
+
+	// a user is changed first, so that the audit log has users in it
+	changeBob := func(t *testing.T, app *application, token string) {
+		rr := serve(app, token, "PUT", "/v1/users/2", `{"email": "bob@example.com", "first_name": "Robert", "active": 1, "version": 1}`, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("could not change bob: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	requests := map[string]leakRequest{
+		"POST /users/login":    {body: `{"email": "alice@example.com", "password": "alice-password"}`, status: http.StatusOK},
+		"GET /me":              {status: http.StatusOK},
+		"PATCH /me":            {body: `{"first_name": "Alicia"}`, status: http.StatusOK},
+		"GET /v1/users":        {status: http.StatusOK},
+		"POST /v1/users":       {body: `{"email": "dave@example.com", "first_name": "Dave", "password": "dave-password", "active": 1}`, status: http.StatusCreated},
+		"GET /v1/users/{id}":   {target: "/v1/users/2", status: http.StatusOK},
+		"PUT /v1/users/{id}":   {target: "/v1/users/2", body: `{"email": "bob@example.com", "first_name": "Robert", "active": 1, "version": 1}`, status: http.StatusOK},
+		"PATCH /v1/users/{id}": {target: "/v1/users/2", body: `{"first_name": "Robert"}`, headers: map[string]string{"Content-Type": mergePatchType, "If-Match": `"1"`}, status: http.StatusOK},
+		// a stale version is answered with the user as they are now
+		"POST /admin/users/save":    {body: `{"id": 2, "email": "bob@example.com", "first_name": "Robert", "active": 1, "version": 9}`, status: http.StatusConflict},
+		"GET /admin/users":          {status: http.StatusOK},
+		"GET /admin/users/get/{id}": {target: "/admin/users/get/2", status: http.StatusOK},
+		"GET /admin/audit":          {target: "/admin/audit?entity=user", status: http.StatusOK, setup: changeBob},
+	}
+
+	routes := map[string]bool{}
+	_ = chi.Walk(testApp.routes().(chi.Router), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes[method+" "+route] = true
+		return nil
+	})
+
+	for key := range requests {
+		if !routes[key] {
+			t.Errorf("%s is checked, but there is no such route", key)
+		}
+	}
+
+	for key := range routes {
+		t.Run(key, func(t *testing.T) {
+			method, route, _ := strings.Cut(key, " ")
+			req, listed := requests[key]
+			if req.target == "" {
+				req.target = strings.NewReplacer("{id}", "3", "{slug}", "ramen", "*", "").Replace(route)
+			}
+
+			app := newMemoryApp(t)
+			token := loggedIn(t, app, 1)
+			if req.setup != nil {
+				req.setup(t, app, token)
+			}
+
+			rr := serve(app, token, method, req.target, req.body, req.headers)
+			if listed && rr.Code != req.status {
+				t.Fatalf("expected %d, got %d: %s", req.status, rr.Code, rr.Body.String())
+			}
+			if leaksPassword(rr.Body.String(), listed) {
+				t.Errorf("leaked a password hash: %s", rr.Body.String())
+			}
+		})
+	}
+
+	// a user who signs in through an identity provider for the first time
+	t.Run("first single sign-on", func(t *testing.T) {
+		idp := newFakeIdP(t)
+		app := newMemoryApp(t)
+		useIdP(t, app, idp, true)
+
+		rr := oidcLogin(t, app, idp, "sub-8", "dave@here.com")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if leaksPassword(rr.Body.String(), true) {
+			t.Errorf("leaked a password hash: %s", rr.Body.String())
+		}
+	})
+
+	var fields []string
+	for name := range userType.Fields() {
+		fields = append(fields, name)
+	}
+	selection := "{ " + strings.Join(fields, " ") + " }"
+
+	queries := map[string]string{
+		"me":         `{ me %s }`,
+		"users":      `{ users %s }`,
+		"user":       `{ user(id: 2) %s }`,
+		"createUser": `mutation { createUser(input: {email: "dave@example.com", password: "dave-password", active: true}) %s }`,
+		"updateUser": `mutation { updateUser(id: 2, version: 1, input: {email: "bob@example.com", firstName: "Robert", active: true}) %s }`,
+	}
+
+	schema := newGraphQLSchema()
+	for _, root := range []*graphql.Object{schema.QueryType(), schema.MutationType()} {
+		for name, field := range root.Fields() {
+			if graphql.GetNamed(field.Type) != userType {
+				continue
+			}
+
+			t.Run("graphql "+name, func(t *testing.T) {
+				query, ok := queries[name]
+				if !ok {
+					t.Fatalf("%s returns users, but has no query here", name)
+				}
+
+				app := newMemoryApp(t)
+				_, resp := postGraphQL(t, app, loggedIn(t, app, 1), fmt.Sprintf(query, selection), nil)
+				if len(resp.Errors) > 0 || resp.field(name) == "null" {
+					t.Fatalf("unexpected response %s %+v", resp.Data[name], resp.Errors)
+				}
+				if leaksPassword(string(resp.Data[name]), true) {
+					t.Errorf("leaked a password hash: %s", resp.Data[name])
+				}
+			})
+		}
+	}
+}
+
+// requestWithURLParam adds a chi URL parameter to a request, as the router would
+func requestWithURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+// TestApplication_CancelledRequests makes sure that queries stop when the client goes away
+// or the request runs out of time, and that we say which happened
+func TestApplication_CancelledRequests(t *testing.T) {
+	app, _ := newMockedApp(t)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"client went away", cancelled, statusClientClosedRequest},
+		{"deadline passed", expired, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/foods", nil).WithContext(tt.ctx)
+		app.AllFoods(rr, req)
+
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.status, rr.Code)
+		}
+	}
+}
+
+// fakeFoods is a FoodStore holding foods in memory, by slug. Methods a test does not
+// need are left to the embedded nil interface, and panic if called.
+type fakeFoods struct {
+	data.FoodStore
+	foods map[string]*data.Food
+}
+
+func (f fakeFoods) GetOneBySlug(ctx context.Context, slug string) (*data.Food, error) {
+	food, ok := f.foods[slug]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return food, nil
+}
+
+func TestApplication_OneFood(t *testing.T) {
+	app := testApp
+	app.models.Food = fakeFoods{foods: map[string]*data.Food{
+		"hamburger": {ID: 1, KnownAs: "Hamburger", Slug: "hamburger"},
+	}}
+
+	rr := httptest.NewRecorder()
+	app.OneFood(rr, requestWithURLParam(httptest.NewRequest("GET", "/foods/hamburger", nil), "slug", "hamburger"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("OneFood returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var payload struct {
+		Data data.Food `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data.KnownAs != "Hamburger" {
+		t.Errorf("expected Hamburger, got %q", payload.Data.KnownAs)
+	}
+
+	rr = httptest.NewRecorder()
+	app.OneFood(rr, requestWithURLParam(httptest.NewRequest("GET", "/foods/pizza", nil), "slug", "pizza"))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("OneFood returned wrong status code of %d for a missing food", rr.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+// readinessCheckTimeout is the longest any one readiness check may take
+const readinessCheckTimeout = 2 * time.Second
+
+// readinessCheck returns an error if some part of the application is not able to serve
+// requests. It must give up when ctx is done.
+type readinessCheck func(ctx context.Context) error
+
+// health tracks whether we are ready to receive traffic: we are ready once we are serving,
+// until shutdown begins, as long as every registered check passes
+type health struct {
+	ready atomic.Bool
+
+	mu     sync.Mutex
+	names  []string
+	checks map[string]readinessCheck
+}
+
+func newHealth() *health {
+	return &health{checks: make(map[string]readinessCheck)}
+}
+
+// register adds a readiness check. Subsystems register their own checks when they start;
+// registering a name again replaces the earlier check.
+func (h *health) register(name string, check readinessCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// check runs every registered check at the same time, and returns the result of each,
+// keyed by name: "ok", or the error
+func (h *health) check(ctx context.Context) (map[string]string, bool) {
+	h.mu.Lock()
+	names := append([]string(nil), h.names...)
+	checks := make([]readinessCheck, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.Unlock()
+
+	errs := make([]error, len(checks))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check readinessCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+
+			errs[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	results := make(map[string]string, len(names))
+	ok := true
+	for i, name := range names {
+		results[name] = "ok"
+		if errs[i] != nil {
+			results[name] = errs[i].Error()
+			ok = false
+		}
+	}
+
+	return results, ok
+}
+
+// registerReadinessChecks registers the checks for the database db, its schema and the
+// static files directory. There is no database to check when db is nil, as it is for the
+// memory storage backend.
+func (app *application) registerReadinessChecks(db *sql.DB) {
+	if db != nil {
+		app.health.register("database", func(ctx context.Context) error {
+			return data.Ping(ctx, db)
+		})
+		app.health.register("migrations", func(ctx context.Context) error {
+			return data.CheckSchemaVersion(ctx, db)
+		})
+	}
+	app.health.register("static", func(ctx context.Context) error {
+		return checkWritable(filepath.Join(app.config.staticPath, "samples"))
+	})
+}
+
+// checkWritable returns an error unless we can create files in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// Healthz reports that the process is alive and able to answer requests
+func (app *application) Healthz(w http.ResponseWriter, r *http.Request) {
+	_ = app.writeJSON(w, http.StatusOK, envelope{"status": "ok"})
+}
+
+// Readyz reports whether we are ready to receive traffic, along with the result of each
+// readiness check. It starts reporting not ready as soon as shutdown begins.
+func (app *application) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !app.health.ready.Load() {
+		_ = app.writeJSON(w, http.StatusServiceUnavailable, envelope{"status": "not ready", "error": "shutting down"})
+		return
+	}
+
+	checks, ok := app.health.check(r.Context())
+	if !ok {
+		_ = app.writeJSON(w, http.StatusServiceUnavailable, envelope{"status": "not ready", "checks": checks})
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, envelope{"status": "ready", "checks": checks})
+}
+
+// buildInfo describes the running binary
+type buildInfo struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	BuildTime string `json:"build_time"`
+	Modified  bool   `json:"modified"`
+	GoVersion string `json:"go_version"`
+}
+
+// readBuildInfo returns what the Go toolchain recorded about the build. The revision and
+// build time are only known when the binary was built from a git checkout.
+func readBuildInfo() (buildInfo, error) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return buildInfo{}, errors.New("build information is not available")
+	}
+
+	b := buildInfo{
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.BuildTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+
+	return b, nil
+}
+
+// Version returns the version of the running binary
+func (app *application) Version(w http.ResponseWriter, r *http.Request) {
+	info, err := readBuildInfo()
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	_ = app.writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/food/internal/data"
+)
+
+func TestApplication_Readyz(t *testing.T) {
+	db, mock := newMockedDB(t)
+	app := testApp
+	app.models = data.NewPostgres(db)
+	app.health = newHealth()
+	app.config.staticPath = t.TempDir()
+	if err := os.Mkdir(filepath.Join(app.config.staticPath, "samples"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	app.registerReadinessChecks(db)
+
+	// not ready until we are serving
+	rr := httptest.NewRecorder()
+	app.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readyz reported ready before serving, status code %d", rr.Code)
+	}
+
+	app.health.ready.Store(true)
+
+	mock.ExpectQuery("from schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(data.ExpectedSchemaVersion, false))
+
+	rr = httptest.NewRecorder()
+	app.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Readyz returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// a schema which is behind, and a check registered by another subsystem, both fail
+	mock.ExpectQuery("from schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(data.ExpectedSchemaVersion-1, false))
+	app.health.register("mailer", func(ctx context.Context) error {
+		return errors.New("mail server unreachable")
+	})
+
+	rr = httptest.NewRecorder()
+	app.Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Readyz returned wrong status code of %d", rr.Code)
+	}
+	for _, want := range []string{"schema is at version", "mail server unreachable", `"database": "ok"`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected %q in %s", want, rr.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExpectedSchemaVersion(t *testing.T) {
+	files, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatal("no migrations found")
+	}
+
+	newest := 0
+	for _, f := range files {
+		version, _ := strconv.Atoi(regexp.MustCompile(`^\d+`).FindString(filepath.Base(f)))
+		if version > newest {
+			newest = version
+		}
+	}
+
+	if newest != data.ExpectedSchemaVersion {
+		t.Errorf("newest migration is %d but data.ExpectedSchemaVersion is %d", newest, data.ExpectedSchemaVersion)
+	}
+}
+
+func TestApplication_HealthzAndVersion(t *testing.T) {
+	rr := httptest.NewRecorder()
+	testApp.Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Error("Healthz returned wrong status code of", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	testApp.Version(rr, httptest.NewRequest("GET", "/version", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatal("Version returned wrong status code of", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"go_version": "go`) {
+		t.Errorf("Version did not report the Go version: %s", rr.Body.String())
+	}
+}
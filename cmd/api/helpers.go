@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
 	"strings"
+
+	"github.com/food/internal/data"
 )
 
 // readJSON tries to read the body of a request and converts it into JSON
@@ -27,7 +34,24 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, data in
 	return nil
 }
 
-// writeJSON takes a response status code and aribitrary data and writes a json response to the client
+// readInt reads an integer from the query string qs, returning def if key is not present
+func (app *application) readInt(qs url.Values, key string, def int) (int, error) {
+	s := qs.Get(key)
+	if s == "" {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+
+	return i, nil
+}
+
+// writeJSON takes a response status code and aribitrary data and writes a json response to the client.
+// On a route wrapped in Cacheable, a successful response is tagged, and answered with 304 Not
+// Modified if the client already has it.
 func (app *application) writeJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
 	var output []byte
 
@@ -52,6 +76,12 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
+	if cw, ok := w.(*cacheableWriter); ok && status == http.StatusOK && cw.notModified(output) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
 	w.WriteHeader(status)
 	_, err := w.Write(output)
 	if err != nil {
@@ -61,6 +91,10 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data interf
 	return nil
 }
 
+// statusClientClosedRequest is the non-standard status, used by nginx among others, for
+// a request the client gave up on before we could answer it
+const statusClientClosedRequest = 499
+
 // errorJSON takes an error, and optionally a response status code, and generates and sends
 // a json error response
 func (app *application) errorJSON(w http.ResponseWriter, err error, status ...int) error {
@@ -70,21 +104,7 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 		statusCode = status[0]
 	}
 
-	var customErr error
-
-	switch {
-	case strings.Contains(err.Error(), "SQLSTATE 23505"):
-		customErr = errors.New("duplicate value violates unique constraint")
-		statusCode = http.StatusForbidden
-	case strings.Contains(err.Error(), "SQLSTATE 22001"):
-		customErr = errors.New("the value you are trying to insert is too large")
-		statusCode = http.StatusForbidden
-	case strings.Contains(err.Error(), "SQLSTATE 23503"):
-		customErr = errors.New("foreign key violation")
-		statusCode = http.StatusForbidden
-	default:
-		customErr = err
-	}
+	customErr, statusCode := clientError(err, statusCode)
 
 	var payload jsonResponse
 	payload.Error = true
@@ -94,3 +114,96 @@ func (app *application) errorJSON(w http.ResponseWriter, err error, status ...in
 
 	return nil
 }
+
+// clientError returns the error to show the client for err, which hides the details of
+// errors from the database, and the status to send with it, which is statusCode unless err
+// calls for a particular one
+func clientError(err error, statusCode int) (error, int) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the client went away, so nobody will see this; the status is for our logs
+		return errors.New("request cancelled"), statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return errors.New("the request took too long; please try again"), http.StatusServiceUnavailable
+	case errors.Is(err, data.ErrDuplicate), strings.Contains(err.Error(), "SQLSTATE 23505"):
+		return errors.New("duplicate value violates unique constraint"), http.StatusForbidden
+	case strings.Contains(err.Error(), "SQLSTATE 22001"):
+		return errors.New("the value you are trying to insert is too large"), http.StatusForbidden
+	case errors.Is(err, data.ErrForeignKey), strings.Contains(err.Error(), "SQLSTATE 23503"):
+		return errors.New("foreign key violation"), http.StatusForbidden
+	case errors.Is(err, data.ErrEditConflict):
+		return errors.New("the record was changed by someone else; please reload it and try again"), http.StatusConflict
+	case errors.Is(err, errPreconditionRequired):
+		return err, http.StatusPreconditionRequired
+	case errors.Is(err, errUnsupportedPatch):
+		return err, http.StatusUnsupportedMediaType
+	case errors.Is(err, errPatchFailed):
+		return err, http.StatusUnprocessableEntity
+	}
+
+	return err, statusCode
+}
+
+// errPreconditionRequired is returned by requestedVersion when an update does not say which
+// version of the record it is based on
+var errPreconditionRequired = errors.New("updates must give the version they are based on, in If-Match or as version")
+
+// versionETag returns the entity tag for version of a record, as sent by the routes which
+// return one record for editing, and expected back in If-Match
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// requestedVersion returns the version of a record that an update is based on: the one in
+// the If-Match header if there is one, and otherwise bodyVersion, the version given in the
+// request's JSON. ifMatch reports whether If-Match was used. An If-Match which is not the
+// ETag of any version returns -1, which never matches.
+func (app *application) requestedVersion(r *http.Request, bodyVersion int) (version int, ifMatch bool, err error) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if bodyVersion == 0 {
+			return 0, false, errPreconditionRequired
+		}
+		return bodyVersion, false, nil
+	}
+
+	unquoted, err := strconv.Unquote(strings.TrimSpace(header))
+	if err != nil {
+		return -1, true, nil
+	}
+	version, err = strconv.Atoi(unquoted)
+	if err != nil {
+		return -1, true, nil
+	}
+
+	return version, true, nil
+}
+
+// editConflict tells the client that the record they tried to update has changed since they
+// read it, and sends the record as it is now, current, at version, so that they can merge
+// their changes into it. A failed If-Match is 412 Precondition Failed; a stale version in
+// the body is 409 Conflict.
+func (app *application) editConflict(w http.ResponseWriter, ifMatch bool, current interface{}, version int) {
+	status := http.StatusConflict
+	if ifMatch {
+		status = http.StatusPreconditionFailed
+	}
+
+	payload := jsonResponse{
+		Error:   true,
+		Message: "the record was changed by someone else since you read it",
+		Data:    current,
+	}
+
+	headers := http.Header{}
+	headers.Set("ETag", versionETag(version))
+
+	_ = app.writeJSON(w, status, payload, headers)
+}
+
+// validEmail reports whether email is a bare address, such as name@example.com, with no
+// display name or angle brackets
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
+}
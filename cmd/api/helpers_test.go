@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/food/internal/data"
 )
 
 func Test_readJSON(t *testing.T) {
@@ -81,4 +85,17 @@ func Test_errorJSON(t *testing.T) {
 			t.Error(customErr)
 		}
 	}
+
+	// every storage backend reports duplicates the same way
+	rr = httptest.NewRecorder()
+	_ = testApp.errorJSON(rr, fmt.Errorf("%w: users_email_key", data.ErrDuplicate))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "duplicate value violates unique constraint") {
+		t.Errorf("unexpected response to a duplicate: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	_ = testApp.errorJSON(rr, fmt.Errorf("could not save tastes: %w", fmt.Errorf("%w: FOREIGN KEY constraint failed", data.ErrForeignKey)))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "foreign key violation") {
+		t.Errorf("unexpected response to a foreign key violation: %d %s", rr.Code, rr.Body.String())
+	}
 }
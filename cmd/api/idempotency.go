@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key we accept, which is as long as the
+// database column
+const maxIdempotencyKeyLength = 255
+
+// replayedHeaders are the response headers saved with an idempotent response, and sent again
+// when it is replayed. Headers such as X-Request-Id are set afresh for every request.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// notKeptContextKey is where Idempotent looks to see whether a response it would otherwise
+// save has been marked with dontKeepResponse
+const notKeptContextKey = contextKey("idempotency-not-kept")
+
+// dontKeepResponse stops Idempotent saving the response to the request with ctx, so that a
+// retry is handled again. It is for a response which reports a failure on our side without a
+// 5xx status, such as a GraphQL answer to a mutation which could not be saved.
+func dontKeepResponse(ctx context.Context) {
+	if notKept, ok := ctx.Value(notKeptContextKey).(*atomic.Bool); ok {
+		notKept.Store(true)
+	}
+}
+
+// Idempotent lets clients safely retry a POST, by sending an Idempotency-Key header which is
+// unique to what they are trying to do. The first request with a key is handled as usual,
+// and its response saved; a retry with the same key and the same body gets the saved
+// response, with an Idempotent-Replayed header, instead of being handled again. Reusing a
+// key for a different request is refused with 422, and retrying while the first request is
+// still being handled with 409. Keys belong to the user who sent them, and are forgotten
+// after idempotency.ttl.
+//
+// A response with a 5xx status, or marked with dontKeepResponse, is not saved, so that the
+// client can retry. Idempotent must
+// come after AuthTokenMiddleware; requests without a key, or without a user, are handled as
+// usual.
+func (app *application) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		user := app.authenticatedUser(r)
+		if r.Method != http.MethodPost || key == "" || user == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			app.errorJSON(w, errors.New("Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+		if err != nil {
+			app.errorJSON(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		scope := "user:" + strconv.Itoa(user.ID)
+		hash := requestHash(r, body)
+
+		saved, err := app.models.Idempotency.Get(ctx, scope, key)
+		switch {
+		case err == nil:
+			app.replay(w, saved, hash)
+			return
+		case !errors.Is(err, sql.ErrNoRows):
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		err = app.models.Idempotency.Start(ctx, data.IdempotentRequest{
+			Scope:       scope,
+			Key:         key,
+			RequestHash: hash,
+			Expiry:      time.Now().Add(app.config.idempotency.ttl),
+		})
+		if errors.Is(err, data.ErrDuplicate) {
+			// another request with the key started since we looked
+			app.errorJSON(w, errors.New("a request with this Idempotency-Key is still being handled"), http.StatusConflict)
+			return
+		} else if err != nil {
+			app.errorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		// the response is saved, or the key forgotten, even if the client has gone away
+		ctx = context.WithoutCancel(ctx)
+		finished := false
+		defer func() {
+			if !finished {
+				// the handler panicked, or its response is not to be kept: forget the key,
+				// so that a retry is handled again
+				if err := app.models.Idempotency.Delete(ctx, scope, key); err != nil {
+					app.logger.ErrorContext(ctx, "could not forget idempotency key", "err", err)
+				}
+			}
+		}()
+
+		var out bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&out)
+		notKept := new(atomic.Bool)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), notKeptContextKey, notKept)))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError || status == statusClientClosedRequest || notKept.Load() {
+			return
+		}
+
+		response := data.IdempotentRequest{
+			Scope:  scope,
+			Key:    key,
+			Status: status,
+			Header: make(map[string][]string),
+			Body:   out.Bytes(),
+		}
+		for _, name := range replayedHeaders {
+			if values := ww.Header().Values(name); len(values) > 0 {
+				response.Header[name] = values
+			}
+		}
+
+		if err := app.models.Idempotency.Finish(ctx, response); err != nil {
+			app.logger.ErrorContext(ctx, "could not save idempotent response", "err", err)
+			return
+		}
+		finished = true
+	})
+}
+
+// replay answers a retry with the response saved for the first request with its key
+func (app *application) replay(w http.ResponseWriter, saved *data.IdempotentRequest, hash []byte) {
+	if !bytes.Equal(saved.RequestHash, hash) {
+		app.errorJSON(w, errors.New("this Idempotency-Key was already used for a different request"), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if saved.Status == 0 {
+		w.Header().Set("Retry-After", "1")
+		app.errorJSON(w, errors.New("a request with this Idempotency-Key is still being handled"), http.StatusConflict)
+		return
+	}
+
+	for name, values := range saved.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(saved.Status)
+	w.Write(saved.Body)
+}
+
+// requestHash identifies a request made with an Idempotency-Key, so that a retry can be told
+// apart from a different request reusing the key
+func requestHash(r *http.Request, body []byte) []byte {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return h.Sum(nil)
+}
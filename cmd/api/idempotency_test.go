@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+func TestIdempotent(t *testing.T) {
+	app := newMemoryApp(t)
+	handler := app.Idempotent(http.HandlerFunc(app.EditFood))
+
+	post := func(key, body string, user *data.User) *httptest.ResponseRecorder {
+		req := meRequest("POST", "/admin/foods/save", body, user)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	countFoods := func() int {
+		foods, err := app.models.Food.GetAll(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(foods)
+	}
+
+	admin := testUser(t, "secret")
+	tacos := `{"id": 0, "known_as": "Fish Tacos", "country_id": 3, "make_year": 1950, "description": "tacos"}`
+
+	first := post("key-1", tacos, admin)
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", first.Code, first.Body.String())
+	}
+
+	// a retry gets the same response, and creates nothing
+	retry := post("key-1", tacos, admin)
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response again, got %d: %s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected headers on the replayed response: %v", retry.Header())
+	}
+	if n := countFoods(); n != 4 {
+		t.Errorf("expected 4 foods after a retry, got %d", n)
+	}
+
+	// the key cannot be reused for something else
+	if rr := post("key-1", `{"id": 0, "known_as": "Burrito", "country_id": 3, "make_year": 1900}`, admin); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a key reused with a different body, got %d", rr.Code)
+	}
+
+	// keys belong to a user
+	other := testUser(t, "secret")
+	other.ID = 2
+	if rr := post("key-1", `{"id": 0, "known_as": "Burrito", "country_id": 3, "make_year": 1900}`, other); rr.Code != http.StatusAccepted || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected another user's key to be handled as new, got %d %v", rr.Code, rr.Header())
+	}
+
+	// without a key, every request is handled
+	post("", tacos, admin)
+	if rr := post("", tacos, admin); rr.Code != http.StatusForbidden {
+		t.Errorf("expected a second food with the same slug to be refused, got %d", rr.Code)
+	}
+
+	// a retry while the first request is still being handled
+	err := app.models.Idempotency.Start(context.Background(), data.IdempotentRequest{
+		Scope:       "user:1",
+		Key:         "key-2",
+		RequestHash: requestHash(meRequest("POST", "/admin/foods/save", tacos, admin), []byte(tacos)),
+		Expiry:      time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := post("key-2", tacos, admin); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a request in progress, got %d", rr.Code)
+	}
+}
+
+func TestIdempotent_ServerErrors(t *testing.T) {
+	app := newMemoryApp(t)
+
+	calls := 0
+	handler := app.Idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			app.errorJSON(w, context.DeadlineExceeded)
+			return
+		}
+		app.writeJSON(w, http.StatusCreated, jsonResponse{Message: "created"})
+	}))
+
+	for range 3 {
+		req := meRequest("POST", "/admin/users/save", `{}`, testUser(t, "secret"))
+		req.Header.Set("Idempotency-Key", "key-1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the 503 was not kept, so the first retry was handled, and the second replayed
+	if calls != 2 {
+		t.Errorf("expected the handler to be called twice, got %d", calls)
+	}
+}
+
+func TestIdempotent_GraphQL(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	post := func(key, query string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(graphqlRequest{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return serve(app, token, "POST", "/graphql", string(body), map[string]string{"Idempotency-Key": key})
+	}
+
+	// a retried mutation is made once
+	create := `mutation { createFood(input: {knownAs: "Fish Tacos", countryId: 3, makeYear: 1950, description: "tacos"}) { id } }`
+	first := post("key-1", create)
+	retry := post("key-1", create)
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response again, got %v: %s", retry.Header(), retry.Body.String())
+	}
+	if foods, _ := app.models.Food.GetAll(context.Background()); len(foods) != 4 {
+		t.Errorf("expected 4 foods after a retry, got %d", len(foods))
+	}
+
+	// an answer reporting that a field failed on our side is not kept
+	app.models.Taste = &flakyTastes{TasteStore: app.models.Taste}
+	query := `{ foods { id tastes { id } } }`
+	if rr := post("key-2", query); !strings.Contains(rr.Body.String(), "internal server error") {
+		t.Fatalf("expected the tastes to fail, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post("key-2", query); rr.Header().Get("Idempotent-Replayed") != "" || strings.Contains(rr.Body.String(), "errors") {
+		t.Errorf("expected the retry to be handled again, got %v: %s", rr.Header(), rr.Body.String())
+	}
+}
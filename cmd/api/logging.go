@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestIDHeader is the header we read a request ID from, and write it back to
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID matches request IDs we are willing to accept from clients; anything else
+// is replaced, so that clients cannot write arbitrary text into our logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:/-]{1,128}$`)
+
+// sensitiveKeys are the log attributes which are never written out
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie"}
+
+// newLogger returns a logger writing to w at level: JSON in production, and text, which is
+// easier to read, in development. Attributes with sensitive names are scrubbed, and the
+// request, trace and user IDs stored in a context are added to every record logged with it.
+func newLogger(w io.Writer, env, level string) *slog.Logger {
+	var lvl slog.Level
+	_ = lvl.UnmarshalText([]byte(level))
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: scrubAttr,
+	}
+
+	var h slog.Handler
+	if env == "development" {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(contextHandler{h})
+}
+
+// scrubAttr replaces the value of any attribute with a sensitive name
+func scrubAttr(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return slog.String(a.Key, "[REDACTED]")
+		}
+	}
+	return a
+}
+
+// contextHandler adds the request ID, the trace ID and the authenticated user's ID, when
+// the context passed to the logger has them, to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := middleware.GetReqID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok && info.userID != 0 {
+		r.AddAttrs(slog.Int("user_id", info.userID))
+	}
+
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestInfoContextKey is the context key for the requestInfo of the current request
+const requestInfoContextKey = contextKey("request info")
+
+// requestInfo collects details about a request, for logging, as it passes through the
+// middleware. It is shared by every context derived from the request's, so middleware
+// further down the chain, such as AuthTokenMiddleware, can fill it in.
+type requestInfo struct {
+	userID int
+}
+
+// setLoggedUser records the ID of the user who made the request, for the logs
+func setLoggedUser(r *http.Request, id int) {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok {
+		info.userID = id
+	}
+}
+
+// RequestID gives every request an ID, which is added to our logs and the audit log, and
+// returned to the client in the X-Request-ID header. An ID supplied by the client, or by a
+// proxy in front of us, in the same header is used if it is well formed, so that a request
+// can be followed from one service to the next.
+func (app *application) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			var err error
+			id, err = randomString(12)
+			if err != nil {
+				app.errorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), middleware.RequestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AccessLog logs every request once it has been served. We log the route pattern rather
+// than the path, and never the query string or headers, so tokens and other secrets sent
+// by clients stay out of the logs.
+func (app *application) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, &requestInfo{})
+		r = r.WithContext(ctx)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		app.logger.Log(ctx, level, "request",
+			"method", r.Method,
+			"route", route,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+		)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestApplication_RequestID(t *testing.T) {
+	var seen string
+	handler := testApp.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.GetReqID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"honored", "abc-123.def", true},
+		{"replaced when malformed", "bad id\nwith newline", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/foods", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			returned := rr.Header().Get(requestIDHeader)
+			if returned == "" || returned != seen {
+				t.Fatalf("request ID %q was not propagated, handler saw %q", returned, seen)
+			}
+			if (returned == tt.incoming) != tt.keep {
+				t.Errorf("incoming request ID %q, returned %q", tt.incoming, returned)
+			}
+		})
+	}
+}
+
+func TestApplication_AccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	app := testApp
+	app.logger = newLogger(&buf, "production", "info")
+
+	mux := chi.NewRouter()
+	mux.Use(app.RequestID)
+	mux.Use(app.AccessLog)
+	mux.Get("/foods/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		setLoggedUser(r, 7)
+		app.logger.InfoContext(r.Context(), "login", "password", "hunter2", "token", "ABCDEF")
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest("GET", "/foods/hamburger?token=ABCDEF", nil)
+	req.Header.Set(requestIDHeader, "req-1")
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two log lines, got:\n%s", buf.String())
+	}
+
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "ABCDEF") {
+		t.Errorf("a secret was logged:\n%s", buf.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"msg":        "request",
+		"method":     "GET",
+		"route":      "/foods/{slug}",
+		"status":     float64(200),
+		"bytes":      float64(5),
+		"request_id": "req-1",
+		"user_id":    float64(7),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("expected %s to be %v in access log, got %v", k, v, entry[k])
+		}
+	}
+	if _, ok := entry["duration_ms"]; !ok {
+		t.Error("access log does not record the duration")
+	}
+}
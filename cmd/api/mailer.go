@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// mailMessage is a plain text email
+type mailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// mailSender is anything which can deliver a mailMessage. In production this is an
+// smtpMailer; tests substitute their own.
+type mailSender interface {
+	Send(msg mailMessage) error
+}
+
+// smtpMailer sends mail through an SMTP server, such as the mailhog instance
+// in docker-compose.yml
+type smtpMailer struct {
+	host string
+	port int
+	from string
+}
+
+// Send delivers msg through the SMTP server
+func (m *smtpMailer) Send(msg mailMessage) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	addr := fmt.Sprintf("%s:%d", m.host, m.port)
+	return smtp.SendMail(addr, nil, m.from, []string{msg.To}, []byte(b.String()))
+}
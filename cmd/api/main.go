@@ -1,69 +1,259 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/food/internal/data"
 	"github.com/food/internal/driver"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
-// config is the type for all application configuration
-type config struct {
-	port int // what port do we want the web server to listen on
-}
-
 // application is the type for all data we want to share with the
 // various parts of our application. We will share this information in most
 // cases by using this type as the receiver for functions
 type application struct {
 	config      config
-	infoLog     *log.Logger
-	errorLog    *log.Logger
+	logger      *slog.Logger
 	models      data.Models
 	environment string
+	oidc        *oidcAuth
+	mailer      mailSender
+	health      *health
+	workers     *workers
+	metrics     *metrics
 }
 
-// main is the main entry point for our application
+// main is the main entry point for our application. Run with "config print" as the first
+// arguments to print the effective configuration instead of starting the server.
 func main() {
-	var cfg config
-	cfg.port = 8081
+	args := os.Args[1:]
+	if len(args) >= 2 && args[0] == "config" && args[1] == "print" {
+		os.Exit(printConfig(os.Stdout, os.Stderr, args[2:], os.LookupEnv))
+	}
+
+	cfg, _, err := loadConfig(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		newConfigFlags(&config{}).PrintDefaults()
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	logger := newLogger(os.Stdout, cfg.env, cfg.logLevel)
+	slog.SetDefault(logger)
 
-	dsn := os.Getenv("DSN")
-	environment := os.Getenv("ENV")
+	shutdownTracing, err := setupTracing(context.Background(), cfg.tracing)
+	if err != nil {
+		fatal(logger, "cannot set up tracing", err)
+	}
 
-	db, err := driver.ConnectPostgres(dsn)
+	store, err := openStorage(context.Background(), cfg, logger)
 	if err != nil {
-		log.Fatal("Cannot connect to database")
+		fatal(logger, "cannot open storage", err)
 	}
-	defer db.SQL.Close()
+	defer store.close()
 
 	app := &application{
 		config:      cfg,
-		infoLog:     infoLog,
-		errorLog:    errorLog,
-		models:      data.New(db.SQL),
-		environment: environment,
+		logger:      logger,
+		models:      store.models,
+		environment: cfg.env,
+		mailer:      &smtpMailer{host: cfg.smtp.host, port: cfg.smtp.port, from: cfg.smtp.from},
+		health:      newHealth(),
+		workers:     &workers{},
+		metrics:     newMetrics(store.db, store.replicaDBs()...),
+	}
+
+	if cfg.oidc.issuer != "" {
+		app.oidc, err = newOIDCAuth(context.Background(), cfg.oidc, http.DefaultClient)
+		if err != nil {
+			fatal(logger, "cannot discover OpenID Connect provider", err)
+		}
+	}
+
+	if cfg.foodCache.maxEntries > 0 {
+		foods := data.NewCachedFoods(app.models.Food, cfg.foodCache.ttl, cfg.foodCache.maxEntries)
+		app.models.Food = foods
+		app.metrics.foodCache(foods.Stats)
+	}
+
+	app.registerReadinessChecks(store.db)
+	app.workers.every("purge expired tokens", time.Hour, app.purgeExpiredTokens)
+	if store.replicas != nil {
+		app.workers.every("check read replicas", cfg.db.replicaCheckInterval, func(ctx context.Context) {
+			store.replicas.Check(ctx)
+		})
 	}
 
-	err = app.serve()
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.port))
 	if err != nil {
-		log.Fatal(err)
+		fatal(logger, "cannot listen", err)
+	}
+
+	var grpcLn net.Listener
+	if cfg.grpc.port > 0 {
+		grpcLn, err = net.Listen("tcp", fmt.Sprintf(":%d", cfg.grpc.port))
+		if err != nil {
+			fatal(logger, "cannot listen for gRPC", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = app.serve(ctx, ln, grpcLn)
+
+	// the last spans are only exported once the server has finished with them
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdown.timeout)
+	defer cancel()
+	if terr := shutdownTracing(flushCtx); terr != nil {
+		logger.Error("could not flush traces", "err", terr)
+	}
+
+	if err != nil {
+		store.close()
+		fatal(logger, "server stopped", err)
 	}
 }
 
-// serve starts the web server
-func (app *application) serve() error {
-	app.infoLog.Println("API listening on port", app.config.port)
+// storage is what openStorage opened
+type storage struct {
+	models   data.Models
+	db       *sql.DB          // the database behind models, or nil for the memory backend
+	replicas *data.ReplicaSet // read replicas of db, or nil if there are none
+}
+
+// replicaDBs returns the read replicas of db, if there are any
+func (s storage) replicaDBs() []*sql.DB {
+	if s.replicas == nil {
+		return nil
+	}
+
+	return s.replicas.Replicas()
+}
 
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", app.config.port),
-		Handler: app.routes(),
+// close closes the databases behind the models
+func (s storage) close() {
+	if s.replicas != nil {
+		s.replicas.Close()
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+}
+
+// openStorage opens the storage backend chosen in cfg
+func openStorage(ctx context.Context, cfg config, logger *slog.Logger) (storage, error) {
+	opts := []data.Option{data.WithQueryTimeout(cfg.db.timeout), data.WithLogger(logger)}
+
+	pool := driver.PoolConfig{
+		MaxOpenConns:    cfg.db.maxOpenConns,
+		MaxIdleConns:    cfg.db.maxIdleConns,
+		ConnMaxLifetime: cfg.db.connMaxLifetime,
+	}
+
+	switch cfg.storage {
+	case "memory":
+		var seed data.Seed
+		if cfg.seedFile != "" {
+			var err error
+			seed, err = data.LoadSeed(cfg.seedFile)
+			if err != nil {
+				return storage{}, err
+			}
+		}
+
+		models, err := data.NewMemory(seed)
+		if err != nil {
+			return storage{}, err
+		}
+
+		logger.Warn("using memory storage; nothing will be saved when the server stops")
+		return storage{models: models}, nil
+
+	case "sqlite":
+		db, err := driver.ConnectSQLite(cfg.sqlitePath, pool)
+		if err != nil {
+			return storage{}, fmt.Errorf("opening sqlite database: %w", err)
+		}
+		logger.Info("opened sqlite database", "path", cfg.sqlitePath)
+
+		return storage{models: data.NewSQL(db.SQL, driver.SQLiteError, opts...), db: db.SQL}, nil
+	}
+
+	retry := driver.RetryConfig{
+		Attempts:   cfg.db.connectAttempts,
+		Backoff:    cfg.db.connectBackoff,
+		MaxBackoff: cfg.db.connectMaxBackoff,
+	}
+
+	db, err := driver.ConnectPostgres(ctx, cfg.db.DSN(), pool, retry)
+	if err != nil {
+		return storage{}, fmt.Errorf("connecting to database: %w", err)
+	}
+	logger.Info("connected to database")
+
+	if len(cfg.db.replicas) == 0 {
+		return storage{models: data.NewPostgres(db.SQL, opts...), db: db.SQL}, nil
+	}
+
+	var replicas []*sql.DB
+	for _, dsn := range cfg.db.replicas {
+		replica, err := driver.OpenPostgres(dsn, pool)
+		if err != nil {
+			for _, r := range replicas {
+				r.Close()
+			}
+			db.SQL.Close()
+			return storage{}, fmt.Errorf("opening read replica: %w", err)
+		}
+		replicas = append(replicas, replica.SQL)
+	}
+
+	set := data.NewReplicaSet(db.SQL, replicas...)
+	models := data.NewPostgresWithReplicas(set, opts...)
+	logger.Info("using read replicas", "count", len(replicas), "healthy", set.Check(ctx))
+
+	return storage{models: models, db: db.SQL, replicas: set}, nil
+}
+
+// fatal logs err and exits
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// printConfig implements "config print": it writes the effective configuration to stdout,
+// and returns the exit status, which is non-zero if the configuration is invalid
+func printConfig(stdout, stderr io.Writer, args []string, lookupEnv func(string) (string, bool)) int {
+	_, fs, err := loadConfig(args, lookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		fs.SetOutput(stderr)
+		fs.PrintDefaults()
+		return 0
+	}
+
+	if werr := writeConfig(stdout, fs); werr != nil {
+		fmt.Fprintln(stderr, werr)
+		return 1
+	}
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
 	}
 
-	return srv.ListenAndServe()
+	return 0
 }
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds our Prometheus metrics. Labels only ever take a small, fixed set of values:
+// requests are labelled by route pattern, never by path, so slugs and IDs cannot create a
+// new time series per value, and by method only if it is a standard one.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	logins           *prometheus.CounterVec
+	tokenValidations *prometheus.CounterVec
+}
+
+// login results, for the result label of foodapi_logins_total
+const (
+	loginSuccess            = "success"
+	loginInvalidCredentials = "invalid_credentials"
+	loginInactive           = "inactive"
+	loginError              = "error"
+)
+
+// newMetrics creates and registers our metrics, along with the Go runtime and process
+// metrics and, when db is not nil, the connection pool statistics of db and of each of its
+// read replicas, labelled pool="primary" and pool="replica-0" and so on
+func newMetrics(db *sql.DB, replicas ...*sql.DB) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "foodapi_http_requests_total",
+			Help: "HTTP requests served, by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "foodapi_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by method and route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "foodapi_logins_total",
+			Help: "Login attempts, by method (password or oidc) and result.",
+		}, []string{"method", "result"}),
+
+		tokenValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "foodapi_token_validations_total",
+			Help: "Token validations, by source (middleware or endpoint) and result (valid or invalid).",
+		}, []string{"source", "result"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.logins,
+		m.tokenValidations,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	if db != nil {
+		m.dbStats("primary", db)
+	}
+	for i, replica := range replicas {
+		m.dbStats("replica-"+strconv.Itoa(i), replica)
+	}
+
+	return m
+}
+
+// dbStats registers the connection pool statistics of db, labelled with the pool's name
+func (m *metrics) dbStats(pool string, db *sql.DB) {
+	prometheus.WrapRegistererWith(prometheus.Labels{"pool": pool}, m.registry).
+		MustRegister(collectors.NewDBStatsCollector(db, "foodapi"))
+}
+
+// metricMethod returns method as a label value. The standard methods are kept, and any
+// other, which a client may make up, is counted as OTHER.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
+
+// login counts a login attempt
+func (m *metrics) login(method, result string) {
+	m.logins.WithLabelValues(method, result).Inc()
+}
+
+// tokenValidation counts a token validation
+func (m *metrics) tokenValidation(source string, valid bool) {
+	result := "invalid"
+	if valid {
+		result = "valid"
+	}
+	m.tokenValidations.WithLabelValues(source, result).Inc()
+}
+
+// foodCache registers metrics for the food cache, read from stats when they are scraped
+func (m *metrics) foodCache(stats func() data.CacheStats) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "foodapi_food_cache_hits_total",
+			Help: "Food reads answered from the in-process cache.",
+		}, func() float64 { return float64(stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "foodapi_food_cache_misses_total",
+			Help: "Food reads not answered from the in-process cache, including those which waited for another read.",
+		}, func() float64 { return float64(stats().Misses) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "foodapi_food_cache_evictions_total",
+			Help: "Entries dropped from the food cache to make room for others.",
+		}, func() float64 { return float64(stats().Evictions) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "foodapi_food_cache_entries",
+			Help: "Foods and lists of foods in the in-process cache.",
+		}, func() float64 { return float64(stats().Entries) }),
+	)
+}
+
+// handler serves the metrics in the Prometheus exposition format
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Metrics counts and times every request, by route pattern and status
+func (app *application) Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		// requests which match no route are counted together, whatever their path
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		method := metricMethod(r.Method)
+		app.metrics.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		app.metrics.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/food/internal/data"
+)
+
+func TestApplication_Metrics(t *testing.T) {
+	app, mock := newMockedApp(t)
+	replica, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	app.metrics = newMetrics(testDB, replica)
+	app.metrics.foodCache(func() data.CacheStats { return data.CacheStats{Hits: 3, Entries: 2} })
+	routes := app.routes()
+
+	mock.ExpectQuery("from foods f").WithArgs("hamburger").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("from users where email").WillReturnError(sql.ErrNoRows)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/foods/hamburger", nil),
+		httptest.NewRequest("GET", "/no/such/page/42", nil),
+		httptest.NewRequest("POST", "/users/login", strings.NewReader(`{"email": "me@here.com", "password": "wrong"}`)),
+		httptest.NewRequest("GET", "/admin/users", nil),
+		httptest.NewRequest("BREW", "/foods", nil),
+	} {
+		routes.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatal("/metrics returned wrong status code of", rr.Code)
+	}
+	body := rr.Body.String()
+
+	for _, want := range []string{
+		`foodapi_http_requests_total{method="GET",route="/foods/{slug}",status="400"} 1`,
+		`foodapi_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`foodapi_http_request_duration_seconds_count{method="GET",route="/foods/{slug}"} 1`,
+		`foodapi_logins_total{method="password",result="invalid_credentials"} 1`,
+		`foodapi_token_validations_total{result="invalid",source="middleware"} 1`,
+		`foodapi_http_requests_total{method="OTHER",route="unmatched",status="405"} 1`,
+		`go_sql_max_open_connections{db_name="foodapi",pool="primary"}`,
+		`go_sql_max_open_connections{db_name="foodapi",pool="replica-0"}`,
+		`foodapi_food_cache_hits_total 3`,
+		`foodapi_food_cache_entries 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in metrics", want)
+		}
+	}
+
+	// paths must never become label values
+	for _, leak := range []string{"hamburger", "/no/such/page", "BREW"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("metrics contain the path %s", leak)
+		}
+	}
+}
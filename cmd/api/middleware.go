@@ -1,11 +1,26 @@
 package main
 
-import "net/http"
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/food/internal/data"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// contextKey is the type for values we store in a request's context
+type contextKey string
+
+// userContextKey is the context key for the user who made an authenticated request
+const userContextKey = contextKey("user")
 
 func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := app.models.Token.AuthenticateToken(r)
+		user, err := data.AuthenticateToken(r, app.models.Token)
+		app.metrics.tokenValidation("middleware", err == nil)
 		if err != nil {
+			app.logger.DebugContext(r.Context(), "authentication failed", "reason", err)
 			payload := jsonResponse{
 				Error:   true,
 				Message: "invalid authentication credentials",
@@ -14,6 +29,34 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 			_ = app.writeJSON(w, http.StatusUnauthorized, payload)
 			return
 		}
-		next.ServeHTTP(w, r)
+
+		setLoggedUser(r, user.ID)
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authenticatedUser returns the user stored in the request context by AuthTokenMiddleware
+func (app *application) authenticatedUser(r *http.Request) *data.User {
+	user, _ := r.Context().Value(userContextKey).(*data.User)
+	return user
+}
+
+// actor describes who made a request, and from where, for the audit log
+func (app *application) actor(r *http.Request) data.Actor {
+	actor := data.Actor{
+		IP:        r.RemoteAddr,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		actor.IP = host
+	}
+
+	if user := app.authenticatedUser(r); user != nil {
+		actor.UserID = user.ID
+	}
+
+	return actor
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/food/internal/data"
+	"golang.org/x/oauth2"
+)
+
+// pendingLoginTTL is how long a user has to complete a login at the identity provider
+const pendingLoginTTL = 10 * time.Minute
+
+// oidcAuth holds everything needed to log users in through an external OpenID Connect
+// identity provider, using the authorization code flow with PKCE
+type oidcAuth struct {
+	issuer        string
+	client        *http.Client
+	verifier      *oidc.IDTokenVerifier
+	oauth2        oauth2.Config
+	autoProvision bool
+	logins        *pendingLogins
+}
+
+// oidcClaims are the claims we read from the ID token issued by the identity provider
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+// newOIDCAuth discovers the identity provider described by cfg and returns an oidcAuth
+// ready to use. All calls to the provider are made using client.
+func newOIDCAuth(ctx context.Context, cfg oidcConfig, client *http.Client) (*oidcAuth, error) {
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, client), cfg.issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcAuth{
+		issuer:   cfg.issuer,
+		client:   client,
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.clientID}),
+		oauth2: oauth2.Config{
+			ClientID:     cfg.clientID,
+			ClientSecret: cfg.clientSecret,
+			RedirectURL:  cfg.redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		autoProvision: cfg.autoProvision,
+		logins:        newPendingLogins(),
+	}, nil
+}
+
+// exchange trades an authorization code for tokens, and returns the verified claims
+// from the ID token
+func (a *oidcAuth) exchange(ctx context.Context, code string, login pendingLogin) (*oidcClaims, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, a.client)
+
+	token, err := a.oauth2.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+
+	idToken, err := a.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if idToken.Nonce != login.nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims oidcClaims
+	err = idToken.Claims(&claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+// pendingLogin is a login which has been sent to the identity provider, but not yet completed
+type pendingLogin struct {
+	verifier string
+	nonce    string
+	expiry   time.Time
+}
+
+// pendingLogins stores pending logins by their state parameter. They are kept in memory, so
+// the callback which completes a login must reach the instance which started it: with more
+// than one instance, the load balancer must send a user back to the same one.
+type pendingLogins struct {
+	mu     sync.Mutex
+	logins map[string]pendingLogin
+}
+
+func newPendingLogins() *pendingLogins {
+	return &pendingLogins{logins: make(map[string]pendingLogin)}
+}
+
+// add stores a pending login, and clears out any which have expired
+func (p *pendingLogins) add(state string, login pendingLogin) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for k, v := range p.logins {
+		if v.expiry.Before(now) {
+			delete(p.logins, k)
+		}
+	}
+
+	p.logins[state] = login
+}
+
+// take removes and returns the pending login for state. A state can only be used once.
+func (p *pendingLogins) take(state string) (pendingLogin, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	login, ok := p.logins[state]
+	if !ok {
+		return pendingLogin{}, false
+	}
+	delete(p.logins, state)
+
+	if login.expiry.Before(time.Now()) {
+		return pendingLogin{}, false
+	}
+
+	return login, true
+}
+
+// randomString returns a url safe random string built from n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// OIDCLogin starts a single sign-on login by redirecting the user to the identity provider
+func (app *application) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.errorJSON(w, errors.New("single sign-on is not configured"), http.StatusNotFound)
+		return
+	}
+
+	state, err := randomString(16)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := randomString(16)
+	if err != nil {
+		app.errorJSON(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	verifier := oauth2.GenerateVerifier()
+
+	app.oidc.logins.add(state, pendingLogin{
+		verifier: verifier,
+		nonce:    nonce,
+		expiry:   time.Now().Add(pendingLoginTTL),
+	})
+
+	url := app.oidc.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// OIDCCallback completes a single sign-on login. The identity provider redirects the user here
+// with an authorization code, which we exchange for an ID token; the identity in that token is
+// mapped to a user, and we issue our own token exactly as Login does.
+func (app *application) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if app.oidc == nil {
+		app.errorJSON(w, errors.New("single sign-on is not configured"), http.StatusNotFound)
+		return
+	}
+
+	if msg := r.URL.Query().Get("error"); msg != "" {
+		app.metrics.login("oidc", loginInvalidCredentials)
+		app.errorJSON(w, errors.New("identity provider returned an error: "+msg), http.StatusUnauthorized)
+		return
+	}
+
+	login, ok := app.oidc.logins.take(r.URL.Query().Get("state"))
+	if !ok {
+		app.metrics.login("oidc", loginInvalidCredentials)
+		app.errorJSON(w, errors.New("invalid or expired login state"), http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := app.oidc.exchange(r.Context(), r.URL.Query().Get("code"), login)
+	if err != nil {
+		app.logger.WarnContext(r.Context(), "single sign-on identity could not be verified", "err", err)
+		app.metrics.login("oidc", loginInvalidCredentials)
+		app.errorJSON(w, errors.New("could not verify identity"), http.StatusUnauthorized)
+		return
+	}
+
+	user, err := app.userForIdentity(r.Context(), claims, app.actor(r))
+	if err != nil {
+		app.metrics.login("oidc", loginInvalidCredentials)
+		app.errorJSON(w, err, http.StatusUnauthorized)
+		return
+	}
+
+	// make sure user is active
+	if user.Active == 0 {
+		app.metrics.login("oidc", loginInactive)
+		app.errorJSON(w, errors.New("user is not active"), http.StatusUnauthorized)
+		return
+	}
+
+	if app.issueToken(w, r, user) {
+		app.metrics.login("oidc", loginSuccess)
+	} else {
+		app.metrics.login("oidc", loginError)
+	}
+}
+
+// userForIdentity finds the user linked to the identity in claims. If no user is linked yet,
+// we link the user with the same (verified) email address, creating that user first when
+// just-in-time provisioning is enabled. A user created this way is recorded in the audit
+// log against actor.
+func (app *application) userForIdentity(ctx context.Context, claims *oidcClaims, actor data.Actor) (*data.User, error) {
+	user, err := app.models.Identity.GetUser(ctx, app.oidc.issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errors.New("identity provider did not supply a verified email address")
+	}
+
+	user, err = app.models.User.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows) && app.oidc.autoProvision:
+		// the password is random and never given out, so this user can only log in
+		// through the identity provider
+		password, err := randomString(32)
+		if err != nil {
+			return nil, err
+		}
+
+		user = &data.User{
+			Email:     claims.Email,
+			FirstName: claims.GivenName,
+			LastName:  claims.FamilyName,
+			Password:  password,
+			Active:    1,
+		}
+
+		id, err := app.models.User.Insert(ctx, *user, actor)
+		if err != nil {
+			return nil, err
+		}
+
+		// read back what was saved, such as the version and when it was created
+		user, err = app.models.User.GetOne(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, errors.New("no user is associated with this identity")
+	default:
+		return nil, err
+	}
+
+	err = app.models.Identity.Insert(ctx, data.Identity{
+		UserID:  user.ID,
+		Issuer:  app.oidc.issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/coreos/go-oidc/v3/oidc/oidctest"
+	"github.com/food/internal/data"
+)
+
+const testClientID = "food-api"
+
+// fakeIdP is an in-process OpenID Connect identity provider. Discovery and keys are served
+// by oidctest; we add just enough of a token endpoint to complete an authorization code
+// exchange with PKCE.
+type fakeIdP struct {
+	*httptest.Server
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]fakeAuthorization
+}
+
+// fakeAuthorization is what the identity provider remembers about an issued code
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+	subject   string
+	email     string
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdP{
+		key:   key,
+		codes: make(map[string]fakeAuthorization),
+	}
+
+	discovery := &oidctest.Server{
+		PublicKeys: []oidctest.PublicKey{
+			{PublicKey: key.Public(), KeyID: "test-key", Algorithm: oidc.RS256},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", idp.token)
+	mux.Handle("/", discovery)
+
+	idp.Server = httptest.NewServer(mux)
+	discovery.SetIssuer(idp.URL)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// authorize plays the part of the user logging in at the identity provider. It takes the
+// redirect issued by OIDCLogin, and returns the query string the provider would send back
+// to our callback.
+func (idp *fakeIdP) authorize(t *testing.T, location, subject, email string) url.Values {
+	u, err := url.Parse(location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected S256 code challenge, got %q", q.Get("code_challenge_method"))
+	}
+
+	code := fmt.Sprintf("code-%d", len(idp.codes))
+
+	idp.mu.Lock()
+	idp.codes[code] = fakeAuthorization{
+		challenge: q.Get("code_challenge"),
+		nonce:     q.Get("nonce"),
+		subject:   subject,
+		email:     email,
+	}
+	idp.mu.Unlock()
+
+	return url.Values{"code": {code}, "state": {q.Get("state")}}
+}
+
+// token is the identity provider's token endpoint
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm()
+
+	idp.mu.Lock()
+	auth, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(hash[:]) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":            idp.URL,
+		"aud":            testClientID,
+		"sub":            auth.subject,
+		"email":          auth.email,
+		"email_verified": true,
+		"given_name":     "Jack",
+		"family_name":    "Smith",
+		"nonce":          auth.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     oidctest.SignIDToken(idp.key, "test-key", oidc.RS256, string(claims)),
+	})
+}
+
+// newOIDCTestApp returns a copy of testApp with single sign-on pointed at idp, and a fresh
+// sql mock
+func newOIDCTestApp(t *testing.T, idp *fakeIdP, autoProvision bool) (*application, sqlmock.Sqlmock) {
+	app, mock := newMockedApp(t)
+	useIdP(t, app, idp, autoProvision)
+
+	return app, mock
+}
+
+// useIdP points app's single sign-on at idp
+func useIdP(t *testing.T, app *application, idp *fakeIdP, autoProvision bool) {
+	var err error
+	app.oidc, err = newOIDCAuth(context.Background(), oidcConfig{
+		issuer:        idp.URL,
+		clientID:      testClientID,
+		clientSecret:  "secret",
+		redirectURL:   "http://localhost:8081/users/oidc/callback",
+		autoProvision: autoProvision,
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// oidcLogin runs a complete login through the fake identity provider, and returns the
+// response from our callback
+func oidcLogin(t *testing.T, app *application, idp *fakeIdP, subject, email string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/oidc/login", nil)
+	app.OIDCLogin(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("OIDCLogin returned wrong status code of %d", rr.Code)
+	}
+
+	callback := idp.authorize(t, rr.Header().Get("Location"), subject, email)
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/users/oidc/callback?"+callback.Encode(), nil)
+	app.OIDCCallback(rr, req)
+
+	return rr
+}
+
+func userRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "email", "first_name", "last_name", "password", "user_active", "created_at", "updated_at", "version"})
+}
+
+func TestApplication_OIDCLogin_LinkedUser(t *testing.T) {
+	idp := newFakeIdP(t)
+	app, mock := newOIDCTestApp(t, idp, false)
+
+	mock.ExpectQuery("from user_identities").
+		WithArgs(idp.URL, "sub-1").
+		WillReturnRows(userRows().AddRow(1, "me@here.com", "Jack", "Smith", "", 1, time.Now(), time.Now(), 1))
+	mock.ExpectExec("delete from tokens").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into tokens").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := oidcLogin(t, app, idp, "sub-1", "me@here.com")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("OIDCCallback returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var payload struct {
+		Data struct {
+			Token data.Token `json:"token"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+	if len(payload.Data.Token.Token) != 26 {
+		t.Errorf("expected a token in the response, got %q", payload.Data.Token.Token)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplication_OIDCLogin_Provisioning(t *testing.T) {
+	idp := newFakeIdP(t)
+	app, mock := newOIDCTestApp(t, idp, true)
+
+	mock.ExpectQuery("from user_identities").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("from users where email").WithArgs("new@here.com").WillReturnError(sql.ErrNoRows)
+	mock.ExpectBegin()
+	mock.ExpectQuery("insert into users").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec("insert into audit_events").
+		WithArgs(nil, "create", "user", 7, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("from users where id").WithArgs(7).
+		WillReturnRows(userRows().AddRow(7, "new@here.com", "New", "User", "", 1, created, created, 1))
+	mock.ExpectExec("insert into user_identities").
+		WithArgs(7, idp.URL, "sub-7", "new@here.com", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("delete from tokens").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into tokens").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rr := oidcLogin(t, app, idp, "sub-7", "new@here.com")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("OIDCCallback returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// the new user is returned as saved, not as it was built
+	var payload struct {
+		Data struct {
+			User struct {
+				Version   int       `json:"version"`
+				CreatedAt time.Time `json:"created_at"`
+			} `json:"user"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data.User.Version != 1 || !payload.Data.User.CreatedAt.Equal(created) {
+		t.Errorf("expected the user as saved, got %+v", payload.Data.User)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplication_OIDCLogin_DeletedUser(t *testing.T) {
+	idp := newFakeIdP(t)
+	app := newMemoryApp(t)
+	useIdP(t, app, idp, true)
+
+	if rr := oidcLogin(t, app, idp, "sub-8", "dave@here.com"); rr.Code != http.StatusOK {
+		t.Fatalf("OIDCCallback returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+	user, err := app.models.User.GetByEmail(context.Background(), "dave@here.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := serve(app, loggedIn(t, app, 1), "DELETE", "/v1/users/"+strconv.Itoa(user.ID), "", nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("could not delete the user: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// the account is provisioned again, rather than refused for the deleted user's identity
+	if rr := oidcLogin(t, app, idp, "sub-8", "dave@here.com"); rr.Code != http.StatusOK {
+		t.Fatalf("OIDCCallback returned wrong status code of %d: %s", rr.Code, rr.Body.String())
+	}
+	again, err := app.models.User.GetByEmail(context.Background(), "dave@here.com")
+	if err != nil || again.ID == user.ID {
+		t.Errorf("expected a new user, got %+v: %v", again, err)
+	}
+}
+
+func TestApplication_OIDCLogin_UnknownUser(t *testing.T) {
+	idp := newFakeIdP(t)
+	app, mock := newOIDCTestApp(t, idp, false)
+
+	mock.ExpectQuery("from user_identities").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("from users where email").WillReturnError(sql.ErrNoRows)
+
+	rr := oidcLogin(t, app, idp, "sub-2", "stranger@here.com")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected unknown user to be rejected, got status code %d", rr.Code)
+	}
+}
+
+func TestApplication_OIDCCallback_BadState(t *testing.T) {
+	idp := newFakeIdP(t)
+	app, _ := newOIDCTestApp(t, idp, false)
+
+	// a state we never issued must be rejected, as must reusing one
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/users/oidc/callback?code=abc&state=forged", nil)
+	app.OIDCCallback(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected forged state to be rejected, got status code %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/users/oidc/login", nil)
+	app.OIDCLogin(rr, req)
+	callback := idp.authorize(t, rr.Header().Get("Location"), "sub-1", "me@here.com")
+
+	// tamper with the code, so PKCE verification fails at the identity provider
+	callback.Set("code", callback.Get("code")+"x")
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/users/oidc/callback?"+callback.Encode(), nil)
+	app.OIDCCallback(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected unknown code to be rejected, got status code %d", rr.Code)
+	}
+}
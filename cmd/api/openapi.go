@@ -0,0 +1,511 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/food/internal/data"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// apiOperation describes one route in the OpenAPI document. Request and response bodies are
+// given as values of the Go types the handler reads and writes, and their schemas are
+// generated from those types, so that the document cannot drift from the code.
+type apiOperation struct {
+	method      string
+	path        string // the route, as given to chi
+	id          string
+	tag         string
+	summary     string
+	auth        bool // needs a bearer token
+	retryable   bool // takes an Idempotency-Key, although it does not need a token
+	deprecated  bool
+	ifMatch     bool // takes the version it changes in If-Match
+	query       []apiParam
+	request     interface{} // the JSON body, or a patchOf for PATCH; nil for none
+	status      int         // of a successful response
+	response    interface{} // an enveloped, a media, or a value sent as it is; nil for none
+	description string      // of the successful response
+}
+
+// apiParam is a query parameter
+type apiParam struct {
+	name        string
+	typ         string
+	description string
+}
+
+// enveloped is a response body which is a jsonResponse, holding data, if it is not nil
+type enveloped struct {
+	data interface{}
+}
+
+// fields describes a JSON object built from a map, such as an envelope, by its fields
+type fields map[string]interface{}
+
+// media is a response body which is not JSON, of the given media type
+type media string
+
+// patchOf is the body of a PATCH, which is a JSON Merge Patch or a JSON Patch of doc
+type patchOf struct {
+	doc interface{}
+}
+
+// apiOperations lists every route in routes(). A test checks that the two agree.
+func apiOperations() []apiOperation {
+	var (
+		message   = enveloped{}
+		food      = enveloped{data.Food{}}
+		loggedIn  = enveloped{fields{"token": data.Token{}, "user": userResponse{}}}
+		foodsList = enveloped{fields{"foods": []data.Food{}}}
+		usersList = enveloped{fields{"users": []userListResponse{}}}
+	)
+
+	return []apiOperation{
+		{method: "GET", path: "/healthz", id: "healthz", tag: "operations", summary: "Report that the server is alive",
+			status: 200, response: fields{"status": ""}},
+		{method: "GET", path: "/readyz", id: "readyz", tag: "operations", summary: "Report whether the server is ready for traffic, with the result of each check",
+			status: 200, response: fields{"status": "", "checks": map[string]string{}, "error": ""}},
+		{method: "GET", path: "/version", id: "version", tag: "operations", summary: "Describe the running build",
+			status: 200, response: buildInfo{}},
+		{method: "GET", path: "/metrics", id: "metrics", tag: "operations", summary: "Prometheus metrics",
+			status: 200, response: media("text/plain")},
+		{method: "GET", path: "/openapi.json", id: "openapi", tag: "operations", summary: "This document",
+			status: 200, response: media("application/json")},
+		{method: "GET", path: "/docs", id: "docs", tag: "operations", summary: "Browse this document",
+			status: 200, response: media("text/html")},
+
+		{method: "POST", path: "/users/login", id: "login", tag: "auth", summary: "Log in with an email address and password",
+			request: credentials{}, status: 200, response: loggedIn},
+		{method: "POST", path: "/users/logout", id: "logout", tag: "auth", summary: "Log out, deleting the token",
+			request: tokenRequest{}, status: 200, response: message},
+		{method: "GET", path: "/users/oidc/login", id: "oidcLogin", tag: "auth", summary: "Start logging in through the single sign-on provider",
+			status: 302, description: "Redirect to the identity provider"},
+		{method: "GET", path: "/users/oidc/callback", id: "oidcCallback", tag: "auth", summary: "Finish logging in through the single sign-on provider",
+			query: []apiParam{
+				{"code", "string", "authorization code from the identity provider"},
+				{"state", "string", "state given to the identity provider by oidcLogin"},
+			},
+			status: 200, response: loggedIn},
+		{method: "POST", path: "/validate-token", id: "validateToken", tag: "auth", summary: "Report whether a token is valid",
+			request: tokenRequest{}, status: 200, response: enveloped{true}},
+		{method: "POST", path: "/users/verify-email", id: "verifyEmail", tag: "auth", summary: "Confirm a new email address with the token sent to it",
+			request: tokenRequest{}, status: 200, response: message},
+
+		{method: "GET", path: "/foods", id: "listFoodsLegacy", tag: "foods", summary: "List foods",
+			status: 200, response: foodsList},
+		{method: "GET", path: "/foods/{slug}", id: "getFoodBySlug", tag: "foods", summary: "Get a food by its slug",
+			status: 200, response: food},
+
+		{method: "GET", path: "/me", id: "getMe", tag: "me", summary: "Get the logged in user", auth: true,
+			status: 200, response: enveloped{fields{"user": userResponse{}}}},
+		{method: "PATCH", path: "/me", id: "updateMe", tag: "me", summary: "Change your name or email address; a new address takes effect once verified", auth: true,
+			request: updateMeRequest{}, status: 200, response: message},
+		{method: "POST", path: "/me/password", id: "changeMyPassword", tag: "me", summary: "Change your password, logging out every other session", auth: true,
+			request: changePasswordRequest{}, status: 200, response: message},
+
+		{method: "GET", path: "/v1/foods", id: "listFoods", tag: "foods", summary: "List foods",
+			status: 200, response: foodsList},
+		{method: "POST", path: "/v1/foods", id: "createFood", tag: "foods", summary: "Create a food", auth: true,
+			request: foodRequest{}, status: 201, response: food},
+		{method: "GET", path: "/v1/foods/{id}", id: "getFood", tag: "foods", summary: "Get a food, with its version as the ETag",
+			status: 200, response: food},
+		{method: "PUT", path: "/v1/foods/{id}", id: "replaceFood", tag: "foods", summary: "Replace a food", auth: true, ifMatch: true,
+			request: foodRequest{}, status: 200, response: food},
+		{method: "PATCH", path: "/v1/foods/{id}", id: "patchFood", tag: "foods", summary: "Patch a food", auth: true, ifMatch: true,
+			request: patchOf{foodDocument{}}, status: 200, response: food},
+		{method: "DELETE", path: "/v1/foods/{id}", id: "deleteFood", tag: "foods", summary: "Delete a food", auth: true,
+			status: 204},
+
+		{method: "GET", path: "/v1/users", id: "listUsers", tag: "users", summary: "List users", auth: true,
+			status: 200, response: usersList},
+		{method: "POST", path: "/v1/users", id: "createUser", tag: "users", summary: "Create a user", auth: true,
+			request: userRequest{}, status: 201, response: userResponse{}},
+		{method: "GET", path: "/v1/users/{id}", id: "getUser", tag: "users", summary: "Get a user, with its version as the ETag", auth: true,
+			status: 200, response: userResponse{}},
+		{method: "PUT", path: "/v1/users/{id}", id: "replaceUser", tag: "users", summary: "Replace a user", auth: true, ifMatch: true,
+			request: userRequest{}, status: 200, response: userResponse{}},
+		{method: "PATCH", path: "/v1/users/{id}", id: "patchUser", tag: "users", summary: "Patch a user", auth: true, ifMatch: true,
+			request: patchOf{userDocument{}}, status: 200, response: userResponse{}},
+		{method: "DELETE", path: "/v1/users/{id}", id: "deleteUser", tag: "users", summary: "Delete a user", auth: true,
+			status: 204},
+
+		{method: "POST", path: "/graphql", id: "graphql", tag: "graphql", summary: "Run a GraphQL query; a token is needed for users and changes, and is refused with 401 if it is not valid. A request with a token may send an Idempotency-Key.", retryable: true,
+			request: graphqlRequest{}, status: 200, response: fields{"data": map[string]interface{}{}, "errors": []gqlerrors.FormattedError{}},
+			description: "The data asked for, with the errors of any fields which could not be resolved"},
+
+		{method: "GET", path: "/admin/users", id: "listUsersLegacy", tag: "users", summary: "List users", auth: true, deprecated: true,
+			status: 200, response: usersList},
+		{method: "POST", path: "/admin/users/save", id: "saveUserLegacy", tag: "users", summary: "Create a user, if id is 0, or update one", auth: true, deprecated: true, ifMatch: true,
+			request: userRequest{}, status: 202, response: message},
+		{method: "GET", path: "/admin/users/get/{id}", id: "getUserLegacy", tag: "users", summary: "Get a user", auth: true, deprecated: true,
+			status: 200, response: userResponse{}},
+		{method: "POST", path: "/admin/users/delete", id: "deleteUserLegacy", tag: "users", summary: "Delete a user", auth: true, deprecated: true,
+			request: idRequest{}, status: 200, response: message},
+		{method: "POST", path: "/admin/log-user-out/{id}", id: "logUserOut", tag: "users", summary: "Log a user out everywhere, and make them inactive", auth: true,
+			status: 202, response: message},
+
+		{method: "POST", path: "/admin/foods/save", id: "saveFoodLegacy", tag: "foods", summary: "Create a food, if id is 0, or update one", auth: true, deprecated: true, ifMatch: true,
+			request: foodRequest{}, status: 202, response: message},
+		{method: "POST", path: "/admin/foods/delete", id: "deleteFoodLegacy", tag: "foods", summary: "Delete a food", auth: true, deprecated: true,
+			request: idRequest{}, status: 200, response: message},
+		{method: "GET", path: "/admin/foods/{id}", id: "getFoodLegacy", tag: "foods", summary: "Get a food", auth: true, deprecated: true,
+			status: 200, response: food},
+		{method: "GET", path: "/admin/countries/all", id: "listCountries", tag: "foods", summary: "List the countries a food may come from", auth: true,
+			status: 200, response: enveloped{[]countryOption{}}},
+
+		{method: "GET", path: "/admin/audit", id: "auditLog", tag: "audit", summary: "Page through the audit log, newest first", auth: true,
+			query: []apiParam{
+				{"entity", "string", "only events for this kind of record, such as food or user"},
+				{"entity_id", "integer", "only events for the record with this id"},
+				{"actor", "integer", "only events caused by the user with this id"},
+				{"since", "string", "only events since this RFC 3339 time"},
+				{"page", "integer", "page number, from 1"},
+				{"page_size", "integer", "events per page, up to 100"},
+			},
+			status: 200, response: enveloped{fields{"events": []data.AuditEvent{}, "page": 0, "page_size": 0, "total": 0}}},
+
+		{method: "GET", path: "/static/*", id: "staticFile", tag: "static", summary: "A static file, such as a food's sample image",
+			status: 200, response: media("application/octet-stream")},
+		{method: "HEAD", path: "/static/*", id: "staticFileHead", tag: "static", summary: "The headers of a static file",
+			status: 200},
+	}
+}
+
+// openAPIPath turns a chi route into an OpenAPI path: a trailing wildcard becomes {path}
+func openAPIPath(route string) string {
+	if strings.HasSuffix(route, "/*") {
+		return strings.TrimSuffix(route, "*") + "{path}"
+	}
+
+	return route
+}
+
+// pathParam matches the parameters in a route
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openAPI returns the OpenAPI 3.1 document describing every route
+func (app *application) openAPI() map[string]interface{} {
+	b := &openAPIBuilder{schemas: map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type":        "object",
+			"description": "Every error has this shape, whatever the route",
+			"properties": map[string]interface{}{
+				"error":   map[string]interface{}{"type": "boolean", "const": true},
+				"message": map[string]interface{}{"type": "string"},
+			},
+		},
+		"JSONPatch": map[string]interface{}{
+			"type":        "array",
+			"description": "A JSON Patch, as described by RFC 6902",
+			"items": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"op", "path"},
+				"properties": map[string]interface{}{
+					"op":    map[string]interface{}{"enum": []string{"add", "remove", "replace", "move", "copy", "test"}},
+					"path":  map[string]interface{}{"type": "string"},
+					"from":  map[string]interface{}{"type": "string"},
+					"value": map[string]interface{}{},
+				},
+			},
+		},
+	}}
+
+	paths := map[string]interface{}{}
+	for _, op := range apiOperations() {
+		path := openAPIPath(op.path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.method)] = b.operation(op, path)
+	}
+
+	version := "dev"
+	if info, err := readBuildInfo(); err == nil {
+		version = info.Version
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "food-api",
+			"version":     version,
+			"description": "Every JSON response, apart from a few noted here, is an envelope with error, message and data fields.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"responses": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"description": "The request failed",
+					"content":     jsonContent(ref("Error")),
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// openAPIBuilder builds the parts of the OpenAPI document, collecting the schemas of the
+// named types it meets as components
+type openAPIBuilder struct {
+	schemas map[string]interface{}
+}
+
+// operation returns the OpenAPI operation object for op, found at path
+func (b *openAPIBuilder) operation(op apiOperation, path string) map[string]interface{} {
+	o := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"tags":        []string{op.tag},
+	}
+	if op.deprecated {
+		o["deprecated"] = true
+	}
+	if op.auth {
+		o["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+
+	var params []interface{}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		typ := "string"
+		if m[1] == "id" {
+			typ = "integer"
+		}
+		params = append(params, parameter(m[1], "path", typ, "", true))
+	}
+	for _, q := range op.query {
+		params = append(params, parameter(q.name, "query", q.typ, q.description, false))
+	}
+	if op.ifMatch {
+		params = append(params, parameter("If-Match", "header", "string", `the version the change is based on, as "<version>"; or give it as version in the body`, false))
+	}
+	if (op.auth || op.retryable) && op.method == "POST" {
+		params = append(params, parameter("Idempotency-Key", "header", "string", "makes a retry of the request return the first response, instead of being handled again", false))
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	switch body := op.request.(type) {
+	case nil:
+	case patchOf:
+		doc := b.schemaOf(body.doc)
+		o["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				mergePatchType:     map[string]interface{}{"schema": doc},
+				jsonPatchType:      map[string]interface{}{"schema": ref("JSONPatch")},
+				"application/json": map[string]interface{}{"schema": doc},
+			},
+		}
+	default:
+		o["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(b.schemaOf(body)),
+		}
+	}
+
+	success := map[string]interface{}{"description": op.description}
+	if op.description == "" {
+		success["description"] = http.StatusText(op.status)
+	}
+	switch body := op.response.(type) {
+	case nil:
+	case media:
+		success["content"] = map[string]interface{}{string(body): map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	case enveloped:
+		success["content"] = jsonContent(b.envelope(body.data))
+	default:
+		success["content"] = jsonContent(b.schemaOf(body))
+	}
+	if op.status == http.StatusCreated {
+		success["headers"] = map[string]interface{}{
+			"Location": map[string]interface{}{"description": "URL of what was created", "schema": map[string]interface{}{"type": "string"}},
+		}
+	}
+
+	o["responses"] = map[string]interface{}{
+		strconv.Itoa(op.status): success,
+		"default":               map[string]interface{}{"$ref": "#/components/responses/Error"},
+	}
+
+	return o
+}
+
+// envelope returns the schema of a jsonResponse holding data
+func (b *openAPIBuilder) envelope(data interface{}) map[string]interface{} {
+	props := map[string]interface{}{
+		"error":   map[string]interface{}{"type": "boolean", "const": false},
+		"message": map[string]interface{}{"type": "string"},
+	}
+	if data != nil {
+		props["data"] = b.schemaOf(data)
+	}
+
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+// schemaOf returns the schema of v, which is a value of a Go type, or fields
+func (b *openAPIBuilder) schemaOf(v interface{}) map[string]interface{} {
+	if f, ok := v.(fields); ok {
+		props := map[string]interface{}{}
+		for name, value := range f {
+			props[name] = b.schemaOf(value)
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+
+	return b.schema(reflect.TypeOf(v))
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema returns the JSON Schema of what encoding/json makes of a value of type t. Named
+// structs become components, and are referred to.
+func (b *openAPIBuilder) schema(t reflect.Type) map[string]interface{} {
+	if t == nil || t == rawMessageType {
+		return map[string]interface{}{}
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+
+		name := componentName(t)
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]interface{}{} // in case t refers to itself
+			b.schemas[name] = b.object(t)
+		}
+		return ref(name)
+	}
+
+	return map[string]interface{}{}
+}
+
+// object returns the schema of a struct, with a property for each field encoding/json writes
+func (b *openAPIBuilder) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	b.addFields(t, props)
+
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (b *openAPIBuilder) addFields(t reflect.Type, props map[string]interface{}) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// the fields of an embedded struct are written as if they were t's own
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.addFields(f.Type, props)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+	}
+}
+
+// componentName is the name of the component for a named type, such as UserResponse for
+// userResponse
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+func parameter(name, in, typ, description string, required bool) map[string]interface{} {
+	p := map[string]interface{}{
+		"name":     name,
+		"in":       in,
+		"required": required,
+		"schema":   map[string]interface{}{"type": typ},
+	}
+	if description != "" {
+		p["description"] = description
+	}
+
+	return p
+}
+
+// OpenAPI returns the OpenAPI document describing every route
+func (app *application) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, app.openAPI())
+}
+
+// docsPage shows the OpenAPI document with Redoc, which the browser loads from its CDN
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>food-api</title>
+</head>
+<body>
+<redoc spec-url="/openapi.json"></redoc>
+<script src="https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// Docs shows the OpenAPI document as a web page
+func (app *application) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, docsPage)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Test_OpenAPI_CoversRoutes fails when a route is added without describing it in
+// apiOperations, or an operation is described which has no route
+func Test_OpenAPI_CoversRoutes(t *testing.T) {
+	routes := map[string]bool{}
+	_ = chi.Walk(testApp.routes().(chi.Router), func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		routes[method+" "+route] = true
+		return nil
+	})
+
+	described := map[string]bool{}
+	for _, op := range apiOperations() {
+		key := op.method + " " + op.path
+		if described[key] {
+			t.Errorf("%s is described twice", key)
+		}
+		described[key] = true
+
+		if !routes[key] {
+			t.Errorf("%s is described, but there is no such route", key)
+		}
+	}
+
+	for key := range routes {
+		if !described[key] {
+			t.Errorf("%s has no entry in apiOperations, so is missing from /openapi.json", key)
+		}
+	}
+}
+
+func Test_OpenAPI(t *testing.T) {
+	app := newMemoryApp(t)
+
+	rr := serve(app, "", "GET", "/openapi.json", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("expected OpenAPI 3.1.0, got %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/v1/foods/{id}"]["patch"]; !ok {
+		t.Error("PATCH /v1/foods/{id} is missing")
+	}
+	if _, ok := doc.Paths["/static/{path}"]["get"]; !ok {
+		t.Error("the static files are missing")
+	}
+
+	// the body of the legacy save is the fields of foodRequest
+	food, _ := doc.Components.Schemas["FoodRequest"].(map[string]interface{})
+	props, _ := food["properties"].(map[string]interface{})
+	for _, name := range []string{"id", "known_as", "country_id", "taste_ids", "sample", "version"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("FoodRequest has no %s: %v", name, food)
+		}
+	}
+
+	// every reference is to a schema in the document
+	for _, ref := range strings.Split(rr.Body.String(), `"$ref": "#/components/schemas/`)[1:] {
+		name, _, _ := strings.Cut(ref, `"`)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("there is no schema %s", name)
+		}
+	}
+
+	rr = serve(app, "", "GET", "/docs", "", nil)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") || !strings.Contains(rr.Body.String(), "/openapi.json") {
+		t.Errorf("unexpected docs page: %d %v", rr.Code, rr.Header())
+	}
+}
+
+func Test_OpenAPI_Schema(t *testing.T) {
+	b := &openAPIBuilder{schemas: map[string]interface{}{}}
+
+	// the fields of an embedded struct are the struct's own
+	b.schemaOf(userListResponse{})
+	list, _ := b.schemas["UserListResponse"].(map[string]interface{})
+	props, _ := list["properties"].(map[string]interface{})
+	if _, ok := props["has_token"]; !ok {
+		t.Errorf("has_token is missing: %v", props)
+	}
+	if _, ok := props["email"]; !ok {
+		t.Errorf("the fields of userResponse are missing: %v", props)
+	}
+
+	// fields which are never sent are left out
+	b.schemaOf(credentials{})
+	creds, _ := b.schemas["Credentials"].(map[string]interface{})
+	if props, _ := creds["properties"].(map[string]interface{}); len(props) != 2 {
+		t.Errorf("unexpected credentials: %v", props)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// The media types of the patches PATCH accepts: a JSON Merge Patch (RFC 7396), which gives
+// the fields to change, with null for the ones to clear, and a JSON Patch (RFC 6902), which
+// lists operations. Plain JSON is taken as a merge patch.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+var (
+	// errUnsupportedPatch is returned by applyPatch for a body which is not a patch we know
+	errUnsupportedPatch = fmt.Errorf("PATCH must send %s or %s", mergePatchType, jsonPatchType)
+
+	// errPatchFailed is returned by applyPatch for a well formed patch which cannot be
+	// applied, such as one which removes a field that is not there, or whose test fails
+	errPatchFailed = errors.New("the patch could not be applied")
+)
+
+// foodDocument is the part of a food a PATCH may change, which the patch is applied to. The
+// version is left at 0, so that, as with a full save, the client has to give the one it
+// read, in If-Match or by setting /version.
+type foodDocument struct {
+	KnownAs     string `json:"known_as"`
+	CountryID   int    `json:"country_id"`
+	MakeYear    int    `json:"make_year"`
+	Description string `json:"description"`
+	TasteIDs    []int  `json:"taste_ids"`
+	Version     int    `json:"version"`
+}
+
+// userDocument is the part of a user a PATCH may change. A password is only ever set by a
+// full save, so that a PATCH is saved in one update.
+type userDocument struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Active    int    `json:"active"`
+	Version   int    `json:"version"`
+}
+
+// applyPatch applies the patch in the body of r to doc, and returns the result. The result
+// must still be a valid document: a patch which adds a field the document does not have, or
+// gives a field a value of the wrong type, is refused.
+func applyPatch[T foodDocument | userDocument](w http.ResponseWriter, r *http.Request, doc T) (T, error) {
+	var result T
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mergePatchType && mediaType != jsonPatchType && mediaType != "application/json" {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		return result, errUnsupportedPatch
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+	if err != nil {
+		return result, err
+	}
+
+	current, err := json.Marshal(doc)
+	if err != nil {
+		return result, err
+	}
+
+	var patched []byte
+	if mediaType == jsonPatchType {
+		ops, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return result, err
+		}
+
+		patched, err = ops.Apply(current)
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", errPatchFailed, err)
+		}
+	} else {
+		patched, err = jsonpatch.MergePatch(current, patch)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&result)
+	return result, err
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+// noTastes checks that a patched food has no tastes left
+func noTastes(t *testing.T, food foodDocument) {
+	if food.KnownAs != "Ramen" || len(food.TasteIDs) != 0 {
+		t.Errorf("expected Ramen without tastes, got %+v", food)
+	}
+}
+
+func TestPatchFood(t *testing.T) {
+	// Ramen is food 3: country 1, made in 1910, and umami
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+		check       func(t *testing.T, food foodDocument)
+	}{
+		{
+			name:        "merge patch",
+			contentType: mergePatchType,
+			patch:       `{"description": "noodles", "taste_ids": [1, 4], "version": 1}`,
+			status:      http.StatusOK,
+			check: func(t *testing.T, food foodDocument) {
+				if food.KnownAs != "Ramen" || food.Description != "noodles" || len(food.TasteIDs) != 2 {
+					t.Errorf("unexpected food %+v", food)
+				}
+			},
+		},
+		{
+			name:        "merge patch clears a field with null",
+			contentType: mergePatchType + "; charset=utf-8",
+			patch:       `{"make_year": null, "version": 1}`,
+			status:      http.StatusOK,
+			check: func(t *testing.T, food foodDocument) {
+				if food.KnownAs != "Ramen" || food.MakeYear != 0 {
+					t.Errorf("unexpected food %+v", food)
+				}
+			},
+		},
+		{
+			name:        "json patch",
+			contentType: jsonPatchType,
+			patch: `[
+				{"op": "replace", "path": "/version", "value": 1},
+				{"op": "test", "path": "/known_as", "value": "Ramen"},
+				{"op": "replace", "path": "/known_as", "value": "Shoyu Ramen"},
+				{"op": "add", "path": "/taste_ids/-", "value": 4}
+			]`,
+			status: http.StatusOK,
+			check: func(t *testing.T, food foodDocument) {
+				if food.KnownAs != "Shoyu Ramen" || !slices.Equal(food.TasteIDs, []int{4, 1}) || food.MakeYear != 1910 {
+					t.Errorf("unexpected food %+v", food)
+				}
+			},
+		},
+		{
+			name:        "merge patch removes the tastes with an empty list",
+			contentType: mergePatchType,
+			patch:       `{"taste_ids": [], "version": 1}`,
+			status:      http.StatusOK,
+			check:       noTastes,
+		},
+		{
+			name:        "merge patch removes the tastes with null",
+			contentType: mergePatchType,
+			patch:       `{"taste_ids": null, "version": 1}`,
+			status:      http.StatusOK,
+			check:       noTastes,
+		},
+		{
+			name:        "json patch removes the tastes",
+			contentType: jsonPatchType,
+			patch:       `[{"op": "replace", "path": "/version", "value": 1}, {"op": "remove", "path": "/taste_ids"}]`,
+			status:      http.StatusOK,
+			check:       noTastes,
+		},
+		{
+			name:        "json patch whose test fails",
+			contentType: jsonPatchType,
+			patch:       `[{"op": "test", "path": "/known_as", "value": "Pizza"}, {"op": "remove", "path": "/description"}]`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "json patch of a missing field",
+			contentType: jsonPatchType,
+			patch:       `[{"op": "remove", "path": "/nope"}]`,
+			status:      http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "field the document does not have",
+			contentType: mergePatchType,
+			patch:       `{"sample": "aGVsbG8=", "version": 1}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "value of the wrong type",
+			contentType: mergePatchType,
+			patch:       `{"make_year": "old", "version": 1}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			name:        "no version",
+			contentType: mergePatchType,
+			patch:       `{"description": "noodles"}`,
+			status:      http.StatusPreconditionRequired,
+		},
+		{
+			name:        "unknown media type",
+			contentType: "text/plain",
+			patch:       `{"description": "noodles", "version": 1}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newMemoryApp(t)
+			token := loggedIn(t, app, 1)
+
+			rr := serve(app, token, "PATCH", "/v1/foods/3", tt.patch, map[string]string{"Content-Type": tt.contentType})
+			if rr.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusUnsupportedMediaType && rr.Header().Get("Accept-Patch") == "" {
+				t.Error("expected an Accept-Patch header")
+			}
+
+			if tt.check != nil {
+				var payload struct {
+					Data foodDocument `json:"data"`
+				}
+				if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, payload.Data)
+			}
+
+			if rr.Code != http.StatusOK {
+				// nothing was saved
+				rr := serve(app, token, "GET", "/v1/foods/3", "", nil)
+				if rr.Header().Get("ETag") != `"1"` {
+					t.Errorf("a refused patch changed the food: %s", rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestPatchFood_Cached(t *testing.T) {
+	app := newMemoryApp(t)
+	store := app.models.Food
+	app.models.Food = data.NewCachedFoods(store, time.Minute, 10)
+	token := loggedIn(t, app, 1)
+
+	// Ramen is cached at version 1, then changed by another instance
+	if rr := serve(app, token, "GET", "/v1/foods/3", "", nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	food, err := store.GetOneById(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	food.Description = "changed elsewhere"
+	if err := store.Update(context.Background(), *food, data.Actor{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a patch of the version it was cached at is refused, with the food as it is now
+	rr := serve(app, token, "PATCH", "/v1/foods/3", `{"make_year": 1911}`,
+		map[string]string{"Content-Type": mergePatchType, "If-Match": `"1"`})
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 412 at version 2, got %d %s: %s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+
+	// a patch of the version it is at keeps the other change
+	rr = serve(app, token, "PATCH", "/v1/foods/3", `{"make_year": 1911}`,
+		map[string]string{"Content-Type": mergePatchType, "If-Match": `"2"`})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var payload struct {
+		Data foodDocument `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data.Description != "changed elsewhere" || payload.Data.MakeYear != 1911 {
+		t.Errorf("unexpected food %+v", payload.Data)
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	rr := serve(app, token, "PATCH", "/v1/users/2", `[{"op": "replace", "path": "/active", "value": 0}, {"op": "replace", "path": "/version", "value": 1}]`,
+		map[string]string{"Content-Type": jsonPatchType})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if u := decodeUser(t, rr); u.Active != 0 || u.FirstName != "Bob" || u.Email != "bob@example.com" {
+		t.Errorf("unexpected user %+v", u)
+	}
+
+	// a password is only set by a full save
+	rr = serve(app, token, "PATCH", "/v1/users/2", `{"password": "new-password"}`,
+		map[string]string{"Content-Type": mergePatchType, "If-Match": `"2"`})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a patched password to be refused, got %d", rr.Code)
+	}
+
+	// a patch meant for another version is refused as stale, before it is found not to apply
+	rr = serve(app, token, "PATCH", "/v1/users/2", `[{"op": "test", "path": "/first_name", "value": "Robert"}]`,
+		map[string]string{"Content-Type": jsonPatchType, "If-Match": `"1"`})
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 412 at version 2, got %d %s: %s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "$2a$") {
+		t.Error("the conflict returned the password hash")
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/go-chi/chi/v5"
+)
+
+// The /v1 routes treat foods and users as resources, each with its own URL: POST to the
+// collection creates one, and GET, PUT, PATCH and DELETE on /v1/foods/{id} or /v1/users/{id}
+// read, replace, patch and remove it. A missing resource is answered with 404 Not Found.
+
+// legacyRoutesDeprecated is when the /admin routes replaced by /v1 were deprecated
+var legacyRoutesDeprecated = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// Deprecated returns middleware for a route kept only for old clients. Responses carry the
+// Deprecation header of RFC 9745, the Sunset header of RFC 8594, set by legacy.sunset, and
+// a link to successor, the route which replaces it.
+func (app *application) Deprecated(successor string) func(http.Handler) http.Handler {
+	sunset, _ := time.Parse(time.DateOnly, app.config.legacySunset)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", "@"+strconv.FormatInt(legacyRoutesDeprecated.Unix(), 10))
+			h.Set("Sunset", sunset.Format(http.TimeFormat))
+			h.Add("Link", "<"+successor+`>; rel="successor-version"`)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// resourceError sends err to the client as errorJSON does, except that a missing resource is
+// answered with 404 Not Found
+func (app *application) resourceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		app.errorJSON(w, errors.New("not found"), http.StatusNotFound)
+		return
+	}
+
+	app.errorJSON(w, err)
+}
+
+// resourceID reads the id of the resource a request is for from its URL
+func (app *application) resourceID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.errorJSON(w, errors.New("id must be an integer"))
+		return 0, false
+	}
+
+	return id, true
+}
+
+// sendFood sends the food with id, as it is stored, with its version as the ETag
+func (app *application) sendFood(w http.ResponseWriter, r *http.Request, id, status int, headers http.Header) {
+	food, err := app.models.Food.GetOneById(r.Context(), id)
+	if err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	headers.Set("ETag", versionETag(food.Version))
+
+	payload := jsonResponse{
+		Error: false,
+		Data:  food,
+	}
+
+	app.writeJSON(w, status, payload, headers)
+}
+
+// ShowFood returns one food as JSON, by ID
+func (app *application) ShowFood(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	app.sendFood(w, r, id, http.StatusOK, http.Header{})
+}
+
+// CreateFood adds the food given as JSON, and returns it with 201 Created, along with its URL
+// in Location
+func (app *application) CreateFood(w http.ResponseWriter, r *http.Request) {
+	var requestPayload foodRequest
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	food := requestPayload.food()
+	food.ID = 0
+
+	if err := app.saveSample(food.Slug, requestPayload.SampleBase64); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	id, err := app.models.Food.Insert(r.Context(), food, app.actor(r))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", "/v1/foods/"+strconv.Itoa(id))
+
+	app.sendFood(w, r, id, http.StatusCreated, headers)
+}
+
+// ReplaceFood replaces the food with the one given as JSON. Anything left out of the JSON is
+// cleared. Like EditFood, it must say which version of the food it replaces.
+func (app *application) ReplaceFood(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := app.models.Food.GetOneById(r.Context(), id); err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	var requestPayload foodRequest
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// tastes left out are cleared like everything else, rather than left alone as nil is
+	if requestPayload.TasteIDs == nil {
+		requestPayload.TasteIDs = []int{}
+	}
+
+	requestPayload.ID = id
+	app.changeFood(w, r, requestPayload)
+}
+
+// PatchFood applies a JSON Merge Patch or a JSON Patch to a food, and saves the result as a
+// full save would. Like EditFood, it must say which version of the food it changes.
+func (app *application) PatchFood(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	// the patch is applied to the food as it is stored, not as it may be cached, so that it
+	// does not undo changes made by another instance
+	current, err := data.Uncached(app.models.Food).GetOneById(r.Context(), id)
+	if err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	// a patch meant for another version is refused before it is applied
+	if version, ifMatch, _ := app.requestedVersion(r, current.Version); ifMatch && version != current.Version {
+		app.editConflict(w, true, current, current.Version)
+		return
+	}
+
+	doc, err := applyPatch(w, r, foodDocument{
+		KnownAs:     current.KnownAs,
+		CountryID:   current.CountryID,
+		MakeYear:    current.MakeYear,
+		Description: current.Description,
+		TasteIDs:    append([]int{}, current.TasteIDs...),
+	})
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	// the patched document is the whole food, so tastes it no longer has are removed
+	if doc.TasteIDs == nil {
+		doc.TasteIDs = []int{}
+	}
+
+	app.changeFood(w, r, foodRequest{
+		ID:          id,
+		KnownAs:     doc.KnownAs,
+		CountryID:   doc.CountryID,
+		MakeYear:    doc.MakeYear,
+		Description: doc.Description,
+		TasteIDs:    doc.TasteIDs,
+		Version:     doc.Version,
+	})
+}
+
+// changeFood saves the food described by requestPayload in place of the stored one, and
+// returns it as it is now
+func (app *application) changeFood(w http.ResponseWriter, r *http.Request, requestPayload foodRequest) {
+	food := requestPayload.food()
+
+	var ifMatch bool
+	var err error
+	food.Version, ifMatch, err = app.requestedVersion(r, requestPayload.Version)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if err := app.saveSample(food.Slug, requestPayload.SampleBase64); err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	if !app.updateFood(w, r, food, ifMatch) {
+		return
+	}
+
+	app.sendFood(w, r, food.ID, http.StatusOK, http.Header{})
+}
+
+// RemoveFood deletes a food, and answers with 204 No Content
+func (app *application) RemoveFood(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.models.Food.DeleteByID(r.Context(), id, app.actor(r)); err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendUser sends the user with id, with its version as the ETag
+func (app *application) sendUser(w http.ResponseWriter, r *http.Request, id, status int, headers http.Header) {
+	user, err := app.models.User.GetOne(r.Context(), id)
+	if err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	headers.Set("ETag", versionETag(user.Version))
+
+	app.writeJSON(w, status, newUserResponse(user), headers)
+}
+
+// ShowUser returns one user as JSON, by ID
+func (app *application) ShowUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	app.sendUser(w, r, id, http.StatusOK, http.Header{})
+}
+
+// CreateUser adds the user given as JSON, and returns it with 201 Created, along with its URL
+// in Location
+func (app *application) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var requestPayload userRequest
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	user := requestPayload.user()
+	user.ID = 0
+
+	id, err := app.models.User.Insert(r.Context(), user, app.actor(r))
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	headers := http.Header{}
+	headers.Set("Location", "/v1/users/"+strconv.Itoa(id))
+
+	app.sendUser(w, r, id, http.StatusCreated, headers)
+}
+
+// ReplaceUser replaces the user with the one given as JSON. Anything left out of the JSON,
+// apart from the password, which is only changed if one is given, is cleared. Like EditUser,
+// it must say which version of the user it replaces.
+func (app *application) ReplaceUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := app.models.User.GetOne(r.Context(), id); err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	var requestPayload userRequest
+
+	err := app.readJSON(w, r, &requestPayload)
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	requestPayload.ID = id
+	if !app.updateUser(w, r, requestPayload) {
+		return
+	}
+
+	app.sendUser(w, r, id, http.StatusOK, http.Header{})
+}
+
+// PatchUser applies a JSON Merge Patch or a JSON Patch to a user, and saves the result as a
+// full save would. Like EditUser, it must say which version of the user it changes.
+func (app *application) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	// the patch is applied to the user as it is stored on the primary, as PatchFood's is, so
+	// that it does not undo a change a replica has not seen yet
+	current, err := app.models.User.GetOne(r.Context(), id)
+	if err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	// a patch meant for another version is refused before it is applied
+	if version, ifMatch, _ := app.requestedVersion(r, current.Version); ifMatch && version != current.Version {
+		app.editConflict(w, true, newUserResponse(current), current.Version)
+		return
+	}
+
+	doc, err := applyPatch(w, r, userDocument{
+		Email:     current.Email,
+		FirstName: current.FirstName,
+		LastName:  current.LastName,
+		Active:    current.Active,
+	})
+	if err != nil {
+		app.errorJSON(w, err)
+		return
+	}
+
+	ok = app.updateUser(w, r, userRequest{
+		ID:        id,
+		Email:     doc.Email,
+		FirstName: doc.FirstName,
+		LastName:  doc.LastName,
+		Active:    doc.Active,
+		Version:   doc.Version,
+	})
+	if !ok {
+		return
+	}
+
+	app.sendUser(w, r, id, http.StatusOK, http.Header{})
+}
+
+// RemoveUser deletes a user, and answers with 204 No Content
+func (app *application) RemoveUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.resourceID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.models.User.DeleteByID(r.Context(), id, app.actor(r)); err != nil {
+		app.resourceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
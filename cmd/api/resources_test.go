@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+// loggedIn returns a token for the user with id, saved in app's storage
+func loggedIn(t *testing.T, app *application, id int) string {
+	t.Helper()
+
+	user, err := app.models.User.GetOne(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := data.GenerateToken(id, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.models.Token.Insert(context.Background(), *token, *user); err != nil {
+		t.Fatal(err)
+	}
+
+	return token.Token
+}
+
+// serve sends a request through app's routes, as the user with token
+func serve(app *application, token, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestV1_Foods(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	rr := serve(app, token, "POST", "/v1/foods", `{"known_as": "Burrito", "country_id": 3, "make_year": 1900, "description": "wrapped"}`, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	location := rr.Header().Get("Location")
+	if location != "/v1/foods/4" || rr.Header().Get("ETag") != `"1"` {
+		t.Fatalf("unexpected headers %v", rr.Header())
+	}
+
+	if rr := serve(app, "", "GET", location, "", nil); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Burrito") {
+		t.Fatalf("could not read the new food: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// PATCH changes only what it is given, but must say which version it changes
+	patch := `{"description": "wrapped in a tortilla"}`
+	mergePatch := map[string]string{"Content-Type": mergePatchType}
+	if rr := serve(app, token, "PATCH", location, patch, mergePatch); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without a version, got %d", rr.Code)
+	}
+	rr = serve(app, token, "PATCH", location, patch, map[string]string{"Content-Type": mergePatchType, "If-Match": `"1"`})
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 200 with ETag \"2\", got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "Burrito") || !strings.Contains(body, "wrapped in a tortilla") {
+		t.Errorf("PATCH did not keep the fields it was not given: %s", body)
+	}
+
+	// PUT replaces the whole food
+	rr = serve(app, token, "PUT", location, `{"known_as": "Burrito", "country_id": 3, "make_year": 1900, "version": 2}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "tortilla") {
+		t.Errorf("PUT kept a field it was not given: %s", rr.Body.String())
+	}
+	if rr := serve(app, token, "PUT", location, `{"known_as": "Burrito", "country_id": 3, "version": 2}`, nil); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a stale version, got %d", rr.Code)
+	}
+
+	if rr := serve(app, token, "DELETE", location, "", nil); rr.Code != http.StatusNoContent || rr.Body.Len() != 0 {
+		t.Errorf("expected an empty 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, method := range []string{"GET", "PATCH", "PUT", "DELETE"} {
+		if rr := serve(app, token, method, location, `{}`, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for a deleted food, got %d", method, rr.Code)
+		}
+	}
+
+	if rr := serve(app, "", "POST", "/v1/foods", `{"known_as": "Burrito"}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", rr.Code)
+	}
+	if rr := serve(app, "", "GET", "/v1/foods/tacos", "", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an id which is not a number, got %d", rr.Code)
+	}
+}
+
+func TestV1_ReplaceFoodClearsTastes(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	// Ramen, food 3, is umami
+	rr := serve(app, token, "PUT", "/v1/foods/3", `{"known_as": "Ramen", "country_id": 1, "make_year": 1910, "version": 1}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	food, err := app.models.Food.GetOneById(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(food.Tastes) != 0 || len(food.TasteIDs) != 0 {
+		t.Errorf("PUT without taste_ids kept the tastes %+v", food.Tastes)
+	}
+}
+
+func TestV1_Users(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	rr := serve(app, token, "POST", "/v1/users", `{"email": "dave@example.com", "first_name": "Dave", "last_name": "Green", "password": "dave-password", "active": 1}`, nil)
+	if rr.Code != http.StatusCreated || rr.Header().Get("Location") != "/v1/users/4" {
+		t.Fatalf("expected 201 with a Location, got %d %v: %s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "password") {
+		t.Errorf("the response has the password: %s", rr.Body.String())
+	}
+
+	rr = serve(app, token, "PATCH", "/v1/users/4", `{"last_name": "Brown", "version": 1}`, map[string]string{"Content-Type": mergePatchType})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if u := decodeUser(t, rr); u.FirstName != "Dave" || u.LastName != "Brown" || u.Active != 1 {
+		t.Errorf("PATCH did not keep the fields it was not given: %+v", u)
+	}
+
+	rr = serve(app, token, "PUT", "/v1/users/4", `{"email": "dave@example.com", "first_name": "David", "version": 2}`, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if u := decodeUser(t, rr); u.FirstName != "David" || u.LastName != "" || u.Active != 0 {
+		t.Errorf("PUT kept a field it was not given: %+v", u)
+	}
+
+	if rr := serve(app, token, "DELETE", "/v1/users/4", "", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := serve(app, token, "GET", "/v1/users/4", "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted user, got %d", rr.Code)
+	}
+}
+
+// decodeUser reads the user in a response
+func decodeUser(t *testing.T, rr *httptest.ResponseRecorder) userResponse {
+	t.Helper()
+
+	var u userResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestDeprecated(t *testing.T) {
+	app := newMemoryApp(t)
+	token := loggedIn(t, app, 1)
+
+	rr := serve(app, token, "GET", "/admin/foods/1", "", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the old route to keep working, got %d", rr.Code)
+	}
+
+	h := rr.Header()
+	if h.Get("Deprecation") != "@1792281600" || h.Get("Sunset") != "Fri, 30 Apr 2027 00:00:00 GMT" || h.Get("Link") != `</v1/foods>; rel="successor-version"` {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	if rr := serve(app, token, "GET", "/admin/countries/all", "", nil); rr.Header().Get("Deprecation") != "" {
+		t.Error("a route which is not deprecated has a Deprecation header")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+// userResponse is the representation of a user that we send to clients. It is copied from
+// data.User field by field, so that password hashes, and any other internal fields users
+// gain in future, never leave the server.
+type userResponse struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name,omitempty"`
+	LastName  string    `json:"last_name,omitempty"`
+	Active    int       `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+// userListResponse is the representation of a user in the list sent by AllUsers
+type userListResponse struct {
+	userResponse
+	HasToken bool `json:"has_token"`
+}
+
+// newUserResponse builds the response for one user
+func newUserResponse(u *data.User) userResponse {
+	return userResponse{
+		ID:        u.ID,
+		Email:     u.Email,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Active:    u.Active,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Version:   u.Version,
+	}
+}
+
+// newUserListResponse builds the response for a list of users
+func newUserListResponse(users []*data.User) []userListResponse {
+	results := make([]userListResponse, 0, len(users))
+
+	for _, u := range users {
+		results = append(results, userListResponse{
+			userResponse: newUserResponse(u),
+			HasToken:     u.HasToken,
+		})
+	}
+
+	return results
+}
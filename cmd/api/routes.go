@@ -10,45 +10,110 @@ import (
 
 func (app *application) routes() http.Handler {
 	mux := chi.NewRouter()
+	mux.Use(app.RequestID)
+	mux.Use(app.Tracing)
+	mux.Use(app.AccessLog)
+	mux.Use(app.Metrics)
 	mux.Use(middleware.Recoverer)
 	mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins:   app.config.cors.allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-None-Match", "If-Modified-Since", "If-Match", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Link", "ETag", "Last-Modified", "Location", "Idempotent-Replayed", "Deprecation", "Sunset"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	mux.Get("/healthz", app.Healthz)
+	mux.Get("/readyz", app.Readyz)
+	mux.Get("/version", app.Version)
+	mux.Method("GET", "/metrics", app.metrics.handler())
+
+	// the API described in OpenAPI, as JSON and as a web page
+	mux.Get("/openapi.json", app.OpenAPI)
+	mux.Get("/docs", app.Docs)
+
 	mux.Post("/users/login", app.Login)
 	mux.Post("/users/logout", app.Logout)
+	mux.Get("/users/oidc/login", app.OIDCLogin)
+	mux.Get("/users/oidc/callback", app.OIDCCallback)
 
-	mux.Get("/foods", app.AllFoods)
-	mux.Get("/foods/{slug}", app.OneFood)
+	mux.With(app.Cacheable(app.config.cache.foods)).Get("/foods", app.AllFoods)
+	mux.With(app.Cacheable(app.config.cache.food)).Get("/foods/{slug}", app.OneFood)
 
 	mux.Post("/validate-token", app.ValidateToken)
+	mux.Post("/users/verify-email", app.VerifyEmail)
+
+	// routes for the logged in user
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.AuthTokenMiddleware)
+		mux.Use(app.Idempotent)
+
+		mux.Get("/me", app.Me)
+		mux.Patch("/me", app.UpdateMe)
+		mux.Post("/me/password", app.ChangeMyPassword)
+	})
+
+	// version 1 of the API, where foods and users are resources with their own URLs
+	mux.Route("/v1", func(mux chi.Router) {
+		mux.With(app.Cacheable(app.config.cache.foods)).Get("/foods", app.AllFoods)
+		mux.Get("/foods/{id}", app.ShowFood)
+
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.AuthTokenMiddleware)
+			mux.Use(app.Idempotent)
+
+			mux.Post("/foods", app.CreateFood)
+			mux.Put("/foods/{id}", app.ReplaceFood)
+			mux.Patch("/foods/{id}", app.PatchFood)
+			mux.Delete("/foods/{id}", app.RemoveFood)
+
+			mux.Get("/users", app.AllUsers)
+			mux.Post("/users", app.CreateUser)
+			mux.Get("/users/{id}", app.ShowUser)
+			mux.Put("/users/{id}", app.ReplaceUser)
+			mux.Patch("/users/{id}", app.PatchUser)
+			mux.Delete("/users/{id}", app.RemoveUser)
+		})
+	})
+
+	// GraphQL, where reading foods is public, and everything else needs a token
+	mux.With(app.OptionalAuthTokenMiddleware, app.Idempotent).Post("/graphql", app.GraphQL)
 
 	mux.Route("/admin", func(mux chi.Router) {
 		mux.Use(app.AuthTokenMiddleware)
+		mux.Use(app.Idempotent)
+
+		// admin user routes, deprecated in favour of /v1/users
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.Deprecated("/v1/users"))
 
-		// admin user routes
-		mux.Get("/users", app.AllUsers)
-		mux.Post("/users/save", app.EditUser)
-		mux.Get("/users/get/{id}", app.GetUser)
-		mux.Post("/users/delete", app.DeleteUser)
+			mux.Get("/users", app.AllUsers)
+			mux.Post("/users/save", app.EditUser)
+			mux.Get("/users/get/{id}", app.GetUser)
+			mux.Post("/users/delete", app.DeleteUser)
+		})
 		mux.Post("/log-user-out/{id}", app.LogUserOutAndSetInactive)
 
-		// admin food routes
-		mux.Get("/countries/all", app.CountriesAll)
-		mux.Post("/foods/save", app.EditFood)
-		mux.Post("/foods/delete", app.DeleteFood)
-		mux.Get("/foods/{id}", app.FoodByID)
+		// admin food routes, deprecated in favour of /v1/foods
+		mux.Group(func(mux chi.Router) {
+			mux.Use(app.Deprecated("/v1/foods"))
+
+			mux.Post("/foods/save", app.EditFood)
+			mux.Post("/foods/delete", app.DeleteFood)
+			mux.Get("/foods/{id}", app.FoodByID)
+		})
+		mux.With(app.Cacheable(app.config.cache.countries)).Get("/countries/all", app.CountriesAll)
 
+		// audit log
+		mux.Get("/audit", app.AuditLog)
 	})
 
 	// static files
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	fileServer := http.FileServer(http.Dir(app.config.staticPath))
+	static := http.StripPrefix("/static", fileServer)
+	mux.Get("/static/*", static.ServeHTTP)
+	mux.Head("/static/*", static.ServeHTTP)
 
 	return mux
 }
@@ -18,6 +18,16 @@ func Test_Routes_Exist(t *testing.T) {
 	routeExists(t, chiRoutes, "/admin/users/save")
 	routeExists(t, chiRoutes, "/admin/users")
 	routeExists(t, chiRoutes, "/admin/users/delete")
+	routeExists(t, chiRoutes, "/me")
+	routeExists(t, chiRoutes, "/me/password")
+	routeExists(t, chiRoutes, "/healthz")
+	routeExists(t, chiRoutes, "/readyz")
+	routeExists(t, chiRoutes, "/version")
+	routeExists(t, chiRoutes, "/metrics")
+	routeExists(t, chiRoutes, "/v1/foods")
+	routeExists(t, chiRoutes, "/v1/foods/{id}")
+	routeExists(t, chiRoutes, "/v1/users")
+	routeExists(t, chiRoutes, "/v1/users/{id}")
 }
 
 func routeExists(t *testing.T, routes chi.Router, route string) {
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// serve runs the web server on ln, and the gRPC server on grpcLn unless it is nil, until
+// ctx is cancelled, which main does on SIGINT or SIGTERM, and then shuts down gracefully:
+//
+//  1. /readyz starts reporting not ready, and we wait shutdown.delay so that load
+//     balancers stop sending us new requests
+//  2. the listeners are closed, and in-flight requests and calls are given until
+//     shutdown.timeout to finish, after which their contexts, and so their queries, are
+//     cancelled
+//  3. background workers are stopped, newest first, within the same deadline
+//
+// Closing the database pool, once serve returns, is left to the caller.
+func (app *application) serve(ctx context.Context, ln, grpcLn net.Listener) error {
+	// requests are given a context which is cancelled if they are still running when the
+	// shutdown deadline passes, so that their queries are cancelled too
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	srv := &http.Server{
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+		Handler:           app.routes(),
+		ReadTimeout:       app.config.http.readTimeout,
+		ReadHeaderTimeout: app.config.http.readHeaderTimeout,
+		WriteTimeout:      app.config.http.writeTimeout,
+		IdleTimeout:       app.config.http.idleTimeout,
+		ErrorLog:          slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+	app.logger.Info("API listening", "addr", ln.Addr().String())
+
+	var grpcSrv *grpc.Server
+	if grpcLn != nil {
+		grpcSrv = app.grpcServer()
+		go func() {
+			serveErr <- grpcSrv.Serve(grpcLn)
+		}()
+		app.logger.Info("gRPC listening", "addr", grpcLn.Addr().String())
+	}
+
+	app.health.ready.Store(true)
+
+	select {
+	case err := <-serveErr:
+		app.health.ready.Store(false)
+		srv.Close()
+		if grpcSrv != nil {
+			grpcSrv.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	app.health.ready.Store(false)
+	app.logger.Info("shutting down; no longer ready")
+	time.Sleep(app.config.shutdown.delay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.config.shutdown.timeout)
+	defer cancel()
+
+	app.logger.Info("draining connections")
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		app.logger.Error("could not drain all connections", "err", err)
+		cancelRequests()
+	}
+
+	if grpcSrv != nil {
+		if gerr := stopGRPC(shutdownCtx, grpcSrv); gerr != nil {
+			app.logger.Error("could not finish all gRPC calls", "err", gerr)
+			err = errors.Join(err, gerr)
+		}
+	}
+
+	app.logger.Info("stopping background workers")
+	if werr := app.workers.stop(shutdownCtx); werr != nil {
+		app.logger.Error("could not stop all background workers", "err", werr)
+		err = errors.Join(err, werr)
+	}
+
+	if err == nil {
+		app.logger.Info("shut down cleanly")
+	}
+
+	return err
+}
+
+// workers are long running background tasks, which are stopped when the server shuts down
+type workers struct {
+	mu      sync.Mutex
+	running []*worker
+}
+
+type worker struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// start runs fn in the background. The context passed to fn is cancelled when the worker is
+// stopped, and fn should return promptly when it is.
+func (w *workers) start(name string, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wk := &worker{name: name, cancel: cancel, done: make(chan struct{})}
+
+	w.mu.Lock()
+	w.running = append(w.running, wk)
+	w.mu.Unlock()
+
+	go func() {
+		defer close(wk.done)
+		fn(ctx)
+	}()
+}
+
+// every starts a worker which calls fn once per interval until it is stopped
+func (w *workers) every(name string, interval time.Duration, fn func(ctx context.Context)) {
+	w.start(name, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	})
+}
+
+// stop stops every worker in the reverse of the order they were started, waiting for each
+// to finish before stopping the next, until ctx expires
+func (w *workers) stop(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	running := w.running
+	w.running = nil
+	w.mu.Unlock()
+
+	for i := len(running) - 1; i >= 0; i-- {
+		wk := running[i]
+		wk.cancel()
+
+		select {
+		case <-wk.done:
+		case <-ctx.Done():
+			return errors.New("timed out waiting for worker " + wk.name)
+		}
+	}
+
+	return nil
+}
+
+// purgeExpiredTokens deletes expired login tokens, email verifications and idempotency keys
+func (app *application) purgeExpiredTokens(ctx context.Context) {
+	if n, err := app.models.Token.DeleteExpired(ctx); err != nil {
+		app.logger.ErrorContext(ctx, "could not purge expired tokens", "err", err)
+	} else if n > 0 {
+		app.logger.InfoContext(ctx, "purged expired tokens", "count", n)
+	}
+
+	if _, err := app.models.EmailVerification.DeleteExpired(ctx); err != nil {
+		app.logger.ErrorContext(ctx, "could not purge expired email verifications", "err", err)
+	}
+
+	if _, err := app.models.Idempotency.DeleteExpired(ctx); err != nil {
+		app.logger.ErrorContext(ctx, "could not purge expired idempotency keys", "err", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestApplication_ServeGracefulShutdown(t *testing.T) {
+	app, mock := newMockedApp(t)
+	app.health = newHealth()
+	app.workers = &workers{}
+	app.config.shutdown.delay = 200 * time.Millisecond
+	app.config.shutdown.timeout = 5 * time.Second
+
+	// workers are stopped newest first, and only once requests have drained
+	var stopped []string
+	app.workers.start("first", func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = append(stopped, "first")
+	})
+	app.workers.start("second", func(ctx context.Context) {
+		<-ctx.Done()
+		stopped = append(stopped, "second")
+	})
+
+	// a slow request, which will still be in flight when we start shutting down
+	mock.ExpectQuery("from foods f").WillDelayFor(500 * time.Millisecond).WillReturnRows(foodRows())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- app.serve(ctx, ln, nil)
+	}()
+
+	waitForStatus(t, base+"/readyz", http.StatusOK)
+
+	slow := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(base + "/foods")
+		if err != nil {
+			t.Error(err)
+			slow <- 0
+			return
+		}
+		resp.Body.Close()
+		slow <- resp.StatusCode
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	// during the shutdown delay we still answer, but report not ready
+	waitForStatus(t, base+"/readyz", http.StatusServiceUnavailable)
+
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("in-flight request was cut off, status code %d", code)
+	}
+
+	if err := <-served; err != nil {
+		t.Errorf("serve returned an error: %s", err)
+	}
+
+	if len(stopped) != 2 || stopped[0] != "second" || stopped[1] != "first" {
+		t.Errorf("workers were stopped in the wrong order: %v", stopped)
+	}
+
+	if _, err := http.Get(base + "/readyz"); err == nil {
+		t.Error("server is still accepting connections after shutdown")
+	}
+}
+
+// waitForStatus polls url until it returns status, failing the test after a second
+func waitForStatus(t *testing.T, url string, status int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == status {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("%s did not return status %d", url, status)
+}
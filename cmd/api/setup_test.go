@@ -1,31 +1,85 @@
 package main
 
 import (
+	"database/sql"
 	"log"
 	"os"
 	"testing"
 
 	"github.com/food/internal/data"
+	"github.com/food/internal/data/storetest"
 
 	"github.com/DATA-DOG/go-sqlmock"
 )
 
 var testApp application
+var testDB *sql.DB
 var mockedDB sqlmock.Sqlmock
 
 func TestMain(m *testing.M) {
-	testDB, myMock, _ := sqlmock.New()
+	db, myMock, _ := sqlmock.New()
+	testDB = db
 	mockedDB = myMock
 
 	defer testDB.Close()
 
+	cfg, _, err := loadConfig([]string{"-env=development"}, noEnv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	testApp = application{
-		config:      config{},
-		infoLog:     log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime),
-		errorLog:    log.New(os.Stdout, "Error\t", log.Ldate|log.Ltime),
-		models:      data.New(testDB),
+		config:      cfg,
+		logger:      newLogger(os.Stdout, cfg.env, cfg.logLevel),
+		models:      data.NewPostgres(testDB),
 		environment: "development",
+		health:      newHealth(),
+		workers:     &workers{},
+		metrics:     newMetrics(testDB),
 	}
 
 	os.Exit(m.Run())
 }
+
+// noEnv is a lookupEnv for loadConfig which finds no environment variables
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+// newMockedDB returns a fresh sql mock, closed when the test ends
+func newMockedDB(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db, mock
+}
+
+// newMockedApp returns a copy of testApp backed by a fresh sql mock, so that a test can set
+// its own expectations without interference from other tests
+func newMockedApp(t *testing.T) (*application, sqlmock.Sqlmock) {
+	db, mock := newMockedDB(t)
+
+	app := testApp
+	app.models = data.NewPostgres(db)
+
+	return &app, mock
+}
+
+// newMemoryApp returns a copy of testApp backed by memory storage, holding the foods and
+// users in storetest.Seed
+func newMemoryApp(t *testing.T) *application {
+	models, err := data.NewMemory(storetest.Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := testApp
+	app.models = models
+
+	return &app
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestApplication_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := newTracerProvider(sdktrace.WithSyncer(exporter))
+
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	defer otel.SetTextMapPropagator(otel.GetTextMapPropagator())
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	app, mock := newMockedApp(t)
+	mock.ExpectQuery("from foods f").WillReturnError(sql.ErrNoRows)
+
+	// the client is already part of a trace
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/foods/hamburger", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+
+	span := spans[0]
+	if span.Name != "GET /foods/{slug}" {
+		t.Errorf("expected the span to be named after the route, got %s", span.Name)
+	}
+	if span.SpanKind != trace.SpanKindServer {
+		t.Errorf("expected a server span, got %s", span.SpanKind)
+	}
+	if span.SpanContext.TraceID().String() != traceID || span.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span did not continue the client's trace: %s, parent %s", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+
+	found := false
+	for _, a := range span.Attributes {
+		if a.Key == "http.response.status_code" && a.Value.AsInt64() == int64(rr.Code) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("span does not record the status code %d: %v", rr.Code, span.Attributes)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestApplication_EditFood_Versions(t *testing.T) {
+	app := newMemoryApp(t)
+	admin := testUser(t, "secret")
+
+	edit := func(body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := meRequest("POST", "/admin/foods/save", body, admin)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+
+		rr := httptest.NewRecorder()
+		app.EditFood(rr, req)
+		return rr
+	}
+
+	// FoodByID gives the version to send back
+	rr := httptest.NewRecorder()
+	app.FoodByID(rr, requestWithURLParam(httptest.NewRequest("GET", "/admin/foods/3", nil), "id", "3"))
+	if etag := rr.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	body := func(description, version string) string {
+		return fmt.Sprintf(`{"id": 3, "known_as": "Ramen", "country_id": 1, "make_year": 1910, "description": %q%s}`, description, version)
+	}
+
+	if rr := edit(body("noodles", ""), nil); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without a version, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := edit(body("noodles", ""), map[string]string{"If-Match": `"1"`}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected an update at the current version to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// a second admin, still working from version 1, is told what changed
+	for _, tt := range []struct {
+		name    string
+		body    string
+		headers map[string]string
+		status  int
+	}{
+		{"stale If-Match", body("broth", ""), map[string]string{"If-Match": `"1"`}, http.StatusPreconditionFailed},
+		{"weak If-Match", body("broth", ""), map[string]string{"If-Match": `W/"2"`}, http.StatusPreconditionFailed},
+		{"stale version", body("broth", `, "version": 1`), nil, http.StatusConflict},
+	} {
+		rr := edit(tt.body, tt.headers)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+
+		var payload struct {
+			Data struct {
+				Description string `json:"description"`
+				Version     int    `json:"version"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Data.Description != "noodles" || payload.Data.Version != 2 || rr.Header().Get("ETag") != `"2"` {
+			t.Errorf("%s: expected the current food at version 2, got %+v %q", tt.name, payload.Data, rr.Header().Get("ETag"))
+		}
+	}
+
+	if rr := edit(body("broth", `, "version": 2`), nil); rr.Code != http.StatusAccepted {
+		t.Errorf("expected an update at the current version to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestApplication_EditUser_Versions(t *testing.T) {
+	app := newMemoryApp(t)
+	admin := testUser(t, "secret")
+
+	edit := func(body, ifMatch string) *httptest.ResponseRecorder {
+		req := meRequest("POST", "/admin/users/save", body, admin)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+
+		rr := httptest.NewRecorder()
+		app.EditUser(rr, req)
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	app.GetUser(rr, requestWithURLParam(httptest.NewRequest("GET", "/admin/users/get/2", nil), "id", "2"))
+	if etag := rr.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	bob := `{"id": 2, "email": "bob@example.com", "first_name": "Robert", "last_name": "Jones", "active": 1}`
+
+	if rr := edit(bob, ""); rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without a version, got %d", rr.Code)
+	}
+	if rr := edit(bob, `"1"`); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected an update at the current version to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = edit(bob, `"1"`)
+	if rr.Code != http.StatusPreconditionFailed || !strings.Contains(rr.Body.String(), `"first_name": "Robert"`) {
+		t.Errorf("expected 412 with the current user, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "$2a$") {
+		t.Error("the conflict response contains a password hash")
+	}
+}
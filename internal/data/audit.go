@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx, so that a query can be run either on
+// its own or as part of a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn inside a transaction on the primary, committing if fn succeeds and rolling
+// back otherwise
+func (s sqlDB) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			s.logger.ErrorContext(ctx, "could not roll back transaction", "err", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Actor identifies who made a change, and from where, for the audit log. A zero UserID
+// means the change was made by the system rather than by a user.
+type Actor struct {
+	UserID    int
+	IP        string
+	RequestID string
+}
+
+// AuditEvent is one entry in the audit log. For updates, Before and After hold only the
+// fields which changed; for creates After holds the new row, and for deletes Before holds
+// the full row as it was.
+type AuditEvent struct {
+	ID         int             `json:"id"`
+	ActorID    int             `json:"actor_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int             `json:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows down the events returned by AuditStore.GetAll. Zero values match everything.
+type AuditFilter struct {
+	EntityType string
+	EntityID   int
+	ActorID    int
+	Since      time.Time
+}
+
+// record writes an audit event as part of tx. before and after may be nil.
+func (a Actor) record(ctx context.Context, tx *sql.Tx, action, entityType string, entityID int, before, after interface{}) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	var actorID sql.NullInt64
+	if a.UserID != 0 {
+		actorID = sql.NullInt64{Int64: int64(a.UserID), Valid: true}
+	}
+
+	stmt := `insert into audit_events (actor_id, action, entity_type, entity_id, before, after, ip, request_id, created_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = tx.ExecContext(ctx, stmt,
+		actorID,
+		action,
+		entityType,
+		entityID,
+		beforeJSON,
+		afterJSON,
+		a.IP,
+		a.RequestID,
+		time.Now(),
+	)
+
+	return err
+}
+
+// auditJSON marshals v for storage in a jsonb column. Nil and empty maps are stored as NULL.
+func auditJSON(v interface{}) (interface{}, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Map && reflect.ValueOf(v).Len() == 0) {
+		return nil, nil
+	}
+
+	return json.Marshal(v)
+}
+
+// auditDiff compares two snapshots of the same entity, and returns only the fields which differ
+func auditDiff(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	changedBefore := make(map[string]interface{})
+	changedAfter := make(map[string]interface{})
+
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			changedBefore[k] = before[k]
+			changedAfter[k] = v
+		}
+	}
+
+	return changedBefore, changedAfter
+}
+
+// GetAll returns one page of audit events matching filter, newest first, along with the
+// total number of matching events
+func (s *sqlAudit) GetAll(ctx context.Context, filter AuditFilter, page, pageSize int) ([]*AuditEvent, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var where []string
+	var args []interface{}
+
+	if filter.EntityType != "" {
+		args = append(args, filter.EntityType)
+		where = append(where, fmt.Sprintf("entity_type = $%d", len(args)))
+	}
+	if filter.EntityID != 0 {
+		args = append(args, filter.EntityID)
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(args)))
+	}
+	if filter.ActorID != 0 {
+		args = append(args, filter.ActorID)
+		where = append(where, fmt.Sprintf("actor_id = $%d", len(args)))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		where = append(where, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+
+	from := "from audit_events"
+	if len(where) > 0 {
+		from += " where " + strings.Join(where, " and ")
+	}
+	filterArgs := args
+
+	query := `select id, actor_id, action, entity_type, entity_id, before, after, ip, request_id, created_at,
+		count(*) over () as total
+		` + from
+
+	args = append(args, pageSize, (page-1)*pageSize)
+	query += fmt.Sprintf(" order by created_at desc, id desc limit $%d offset $%d", len(args)-1, len(args))
+
+	rows, err := s.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var events []*AuditEvent
+	var total int
+
+	for rows.Next() {
+		var event AuditEvent
+		var actorID sql.NullInt64
+		var before, after []byte
+
+		err := rows.Scan(
+			&event.ID,
+			&actorID,
+			&event.Action,
+			&event.EntityType,
+			&event.EntityID,
+			&before,
+			&after,
+			&event.IP,
+			&event.RequestID,
+			&event.CreatedAt,
+			&total,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		event.ActorID = int(actorID.Int64)
+		event.Before = before
+		event.After = after
+
+		events = append(events, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// a page past the end has no rows to carry the total, so it is counted on its own
+	if len(events) == 0 && page > 1 {
+		err := s.read.QueryRowContext(ctx, "select count(*) "+from, filterArgs...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return events, total, nil
+}
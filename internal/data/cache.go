@@ -0,0 +1,238 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CachedFoods is a FoodStore which keeps the foods read from another FoodStore in memory,
+// so that the public food pages do not hit the database on every request. Entries expire
+// after a TTL, and the least recently used are evicted once there are too many. Concurrent
+// misses for the same entry are coalesced into one read. Searches are not cached.
+//
+// Any change made through CachedFoods, including a change to a food's tastes, empties the
+// cache. Changes made elsewhere, such as by another instance of the server, are only seen
+// once the entries they affect expire. Entries are read from the primary database, never a
+// replica, so that the read after a change cannot cache a replica's copy from before it.
+type CachedFoods struct {
+	FoodStore
+
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // of *cacheEntry, most recently used first
+	inflight   map[string]*cacheCall
+	generation uint64 // bumped whenever the cache is emptied
+	stats      CacheStats
+}
+
+// CacheStats counts how well a CachedFoods is doing
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64 // entries dropped to make room, not counting expired or invalidated ones
+	Entries   int
+}
+
+// cacheEntry is one cached read: a list of foods, or a single food
+type cacheEntry struct {
+	key     string
+	foods   []*Food
+	expires time.Time
+}
+
+// cacheCall is a read in progress, which later misses for the same key wait for
+type cacheCall struct {
+	done  chan struct{}
+	foods []*Food
+	err   error
+}
+
+// NewCachedFoods returns a CachedFoods reading from foods, which keeps at most maxEntries
+// entries, each for at most ttl
+func NewCachedFoods(foods FoodStore, ttl time.Duration, maxEntries int) *CachedFoods {
+	return &CachedFoods{
+		FoodStore:  foods,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		inflight:   make(map[string]*cacheCall),
+	}
+}
+
+// Uncached returns the store foods reads from without its cache, or foods itself if it has
+// none. Reads which must see changes made by other instances, such as the food a patch is
+// applied to, use it.
+func Uncached(foods FoodStore) FoodStore {
+	if c, ok := foods.(*CachedFoods); ok {
+		return c.FoodStore
+	}
+
+	return foods
+}
+
+// Stats returns the cache's statistics so far
+func (c *CachedFoods) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Invalidate empties the cache. Reads already in progress are not cached when they finish.
+func (c *CachedFoods) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.inflight = make(map[string]*cacheCall)
+	c.generation++
+}
+
+func (c *CachedFoods) GetAll(ctx context.Context) ([]*Food, error) {
+	return c.get(ctx, "all", func(ctx context.Context) ([]*Food, error) {
+		return c.FoodStore.GetAll(ctx)
+	})
+}
+
+func (c *CachedFoods) GetOneById(ctx context.Context, foodID int) (*Food, error) {
+	foods, err := c.get(ctx, "id:"+strconv.Itoa(foodID), func(ctx context.Context) ([]*Food, error) {
+		food, err := c.FoodStore.GetOneById(ctx, foodID)
+		return []*Food{food}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return foods[0], nil
+}
+
+func (c *CachedFoods) GetOneBySlug(ctx context.Context, slug string) (*Food, error) {
+	foods, err := c.get(ctx, "slug:"+slug, func(ctx context.Context) ([]*Food, error) {
+		food, err := c.FoodStore.GetOneBySlug(ctx, slug)
+		return []*Food{food}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return foods[0], nil
+}
+
+func (c *CachedFoods) Insert(ctx context.Context, food Food, actor Actor) (int, error) {
+	defer c.Invalidate()
+	return c.FoodStore.Insert(ctx, food, actor)
+}
+
+func (c *CachedFoods) Update(ctx context.Context, food Food, actor Actor) error {
+	defer c.Invalidate()
+	return c.FoodStore.Update(ctx, food, actor)
+}
+
+func (c *CachedFoods) DeleteByID(ctx context.Context, foodID int, actor Actor) error {
+	defer c.Invalidate()
+	return c.FoodStore.DeleteByID(ctx, foodID, actor)
+}
+
+// get returns a copy of the cached entry for key, calling read to fill it if it is missing
+// or has expired. Errors are not cached.
+func (c *CachedFoods) get(ctx context.Context, key string, read func(context.Context) ([]*Food, error)) ([]*Food, error) {
+	c.mu.Lock()
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return cloneFoods(entry.foods), nil
+		}
+		c.remove(el)
+	}
+	c.stats.Misses++
+
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+
+		select {
+		case <-call.done:
+			return cloneFoods(call.foods), call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	call := &cacheCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	generation := c.generation
+	c.mu.Unlock()
+
+	// the read is shared, so it must not be cut short because this caller gives up
+	call.foods, call.err = read(onPrimary(context.WithoutCancel(ctx)))
+
+	c.mu.Lock()
+	if c.generation == generation {
+		delete(c.inflight, key)
+		if call.err == nil {
+			c.add(key, call.foods)
+		}
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return cloneFoods(call.foods), call.err
+}
+
+// add caches foods under key, evicting the least recently used entries if need be. The
+// caller must hold c.mu.
+func (c *CachedFoods) add(key string, foods []*Food) {
+	if c.maxEntries <= 0 {
+		return
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	entry := &cacheEntry{key: key, foods: foods, expires: c.now().Add(c.ttl)}
+	c.entries[key] = c.lru.PushFront(entry)
+}
+
+// remove drops el from the cache. The caller must hold c.mu.
+func (c *CachedFoods) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// cloneFoods returns a deep copy of foods, so that callers cannot change what is cached
+func cloneFoods(foods []*Food) []*Food {
+	if foods == nil {
+		return nil
+	}
+
+	out := make([]*Food, len(foods))
+	for i, f := range foods {
+		if f == nil {
+			continue
+		}
+		food := *f
+		food.Tastes = slices.Clone(f.Tastes)
+		food.TasteIDs = slices.Clone(f.TasteIDs)
+		out[i] = &food
+	}
+
+	return out
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingFoods is a FoodStore which counts its reads, and can hold them until released
+type countingFoods struct {
+	FoodStore
+	reads   atomic.Int32
+	release chan struct{}
+	foods   map[string]*Food
+}
+
+func (f *countingFoods) GetAll(ctx context.Context) ([]*Food, error) {
+	f.reads.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+
+	var foods []*Food
+	for _, food := range f.foods {
+		copied := *food
+		foods = append(foods, &copied)
+	}
+	return foods, nil
+}
+
+func (f *countingFoods) GetOneBySlug(ctx context.Context, slug string) (*Food, error) {
+	f.reads.Add(1)
+	food, ok := f.foods[slug]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *food
+	return &copied, nil
+}
+
+func (f *countingFoods) Update(ctx context.Context, food Food, actor Actor) error {
+	f.foods[food.Slug] = &food
+	return nil
+}
+
+func newCountingFoods() *countingFoods {
+	return &countingFoods{foods: map[string]*Food{
+		"ramen": {ID: 1, KnownAs: "Ramen", Slug: "ramen", TasteIDs: []int{1}},
+		"pizza": {ID: 2, KnownAs: "Pizza", Slug: "pizza", TasteIDs: []int{4, 1}},
+	}}
+}
+
+func TestCachedFoods(t *testing.T) {
+	ctx := context.Background()
+	store := newCountingFoods()
+	cache := NewCachedFoods(store, time.Minute, 10)
+
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	for range 3 {
+		food, err := cache.GetOneBySlug(ctx, "ramen")
+		if err != nil || food.KnownAs != "Ramen" {
+			t.Fatalf("unexpected %v %v", food, err)
+		}
+		// changing what we were given must not change what is cached
+		food.KnownAs = "changed"
+		food.TasteIDs[0] = 99
+	}
+	if n := store.reads.Load(); n != 1 {
+		t.Errorf("expected 1 read, got %d", n)
+	}
+	if food, _ := cache.GetOneBySlug(ctx, "ramen"); food.KnownAs != "Ramen" || food.TasteIDs[0] != 1 {
+		t.Errorf("the cached food was changed: %+v", food)
+	}
+
+	// missing foods are not cached
+	for range 2 {
+		if _, err := cache.GetOneBySlug(ctx, "tacos"); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+	}
+	if n := store.reads.Load(); n != 3 {
+		t.Errorf("expected 3 reads, got %d", n)
+	}
+
+	// entries expire
+	now = now.Add(2 * time.Minute)
+	if _, err := cache.GetOneBySlug(ctx, "ramen"); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.reads.Load(); n != 4 {
+		t.Errorf("expected an expired entry to be read again, got %d reads", n)
+	}
+
+	// changes empty the cache
+	if err := cache.Update(ctx, Food{ID: 1, KnownAs: "Shoyu Ramen", Slug: "ramen"}, Actor{}); err != nil {
+		t.Fatal(err)
+	}
+	if food, _ := cache.GetOneBySlug(ctx, "ramen"); food.KnownAs != "Shoyu Ramen" {
+		t.Errorf("expected the update to be seen, got %q", food.KnownAs)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 3 || stats.Misses != 5 || stats.Entries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedFoods_Evicts(t *testing.T) {
+	ctx := context.Background()
+	store := newCountingFoods()
+	cache := NewCachedFoods(store, time.Minute, 1)
+
+	cache.GetOneBySlug(ctx, "ramen")
+	cache.GetOneBySlug(ctx, "pizza")
+	cache.GetOneBySlug(ctx, "ramen")
+
+	if n := store.reads.Load(); n != 3 {
+		t.Errorf("expected the least recently used food to be evicted, got %d reads", n)
+	}
+	if stats := cache.Stats(); stats.Evictions != 2 || stats.Entries != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedFoods_Coalesces(t *testing.T) {
+	store := newCountingFoods()
+	store.release = make(chan struct{})
+	cache := NewCachedFoods(store, time.Minute, 10)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			foods, err := cache.GetAll(context.Background())
+			if err != nil || len(foods) != 2 {
+				t.Errorf("unexpected %v %v", foods, err)
+			}
+		})
+	}
+
+	// let the misses pile up behind the first read
+	for cache.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(store.release)
+	wg.Wait()
+
+	if n := store.reads.Load(); n != 1 {
+		t.Errorf("expected concurrent misses to share 1 read, got %d", n)
+	}
+}
+
+func TestCachedFoods_InvalidatedDuringRead(t *testing.T) {
+	store := newCountingFoods()
+	store.release = make(chan struct{})
+	cache := NewCachedFoods(store, time.Minute, 10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.GetAll(context.Background())
+	}()
+
+	for store.reads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cache.Invalidate()
+	close(store.release)
+	<-done
+
+	// what the read found may already be out of date, so it was not kept
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("expected nothing cached, got %+v", stats)
+	}
+}
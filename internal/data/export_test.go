@@ -0,0 +1,5 @@
+package data
+
+// NewSeededPostgres exports newSeededPostgres to the conformance tests, which are in the
+// data_test package so that they can use the storetest package
+var NewSeededPostgres = newSeededPostgres
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	slugify "github.com/mozillazg/go-slugify"
@@ -21,7 +23,10 @@ type Food struct {
 	Tastes      []Taste   `json:"tastes"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
-	TasteIDs    []int     `json:"taste_ids,omitempty"`
+	// TasteIDs are the tastes saved by Insert and Update. Update leaves the tastes as they
+	// are when it is nil, and removes them all when it is empty but not nil.
+	TasteIDs []int `json:"taste_ids,omitempty"`
+	Version  int   `json:"version"`
 }
 
 // Country is the definition of a single country
@@ -40,18 +45,24 @@ type Taste struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// tastesForFood returns all tastes for a given food id
-func (f *Food) tastesForFood(foodID int) ([]Taste, []int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+// FoodFilter narrows down the foods returned by FoodStore.Search. Zero values match everything.
+type FoodFilter struct {
+	CountryID int
+	TasteID   int
+
+	// Search matches foods whose name contains it, ignoring case
+	Search string
+}
 
+// tastesForFood returns all tastes for a given food id
+func tastesForFood(ctx context.Context, q dbtx, foodID int) ([]Taste, []int, error) {
 	// get tastes
 	var tastes []Taste
 	var tasteIDs []int
 	tasteQuery := `select id, taste, created_at, updated_at from tastes where id in (select taste_id 
 				from foods_tastes where food_id = $1) order by taste`
 
-	tRows, err := db.QueryContext(ctx, tasteQuery, foodID)
+	tRows, err := q.QueryContext(ctx, tasteQuery, foodID)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, nil, err
 	}
@@ -76,11 +87,11 @@ func (f *Food) tastesForFood(foodID int) ([]Taste, []int, error) {
 }
 
 // GetAll returns a slice of all foods
-func (f *Food) GetAll() ([]*Food, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlFoods) GetAll(ctx context.Context) ([]*Food, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at,
+	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at, f.version,
 			c.id, c.country_name, c.created_at, c.updated_at
 			from foods f
 			left join countries c on (f.country_id = c.id)
@@ -88,7 +99,7 @@ func (f *Food) GetAll() ([]*Food, error) {
 
 	var foods []*Food
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := s.read.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -105,6 +116,7 @@ func (f *Food) GetAll() ([]*Food, error) {
 			&food.Description,
 			&food.CreatedAt,
 			&food.UpdatedAt,
+			&food.Version,
 			&food.Country.ID,
 			&food.Country.CountryName,
 			&food.Country.CreatedAt,
@@ -114,7 +126,7 @@ func (f *Food) GetAll() ([]*Food, error) {
 		}
 
 		// get tastes
-		tastes, ids, err := f.tastesForFood(food.ID)
+		tastes, ids, err := tastesForFood(ctx, s.read, food.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -128,14 +140,14 @@ func (f *Food) GetAll() ([]*Food, error) {
 }
 
 // GetAllPaginated returns a slice of all foods, paginated by limit and offset
-func (f *Food) GetAllPaginated(page, pageSize int) ([]*Food, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlFoods) GetAllPaginated(ctx context.Context, page, pageSize int) ([]*Food, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	limit := pageSize
 	offset := (page - 1) * pageSize
 
-	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at,
+	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at, f.version,
 				c.id, c.country_name, c.created_at, c.updated_at
 				from foods f
 				left join countries c on (f.country_id = c.id)
@@ -144,7 +156,7 @@ func (f *Food) GetAllPaginated(page, pageSize int) ([]*Food, error) {
 
 	var foods []*Food
 
-	rows, err := db.QueryContext(ctx, query, limit, offset)
+	rows, err := s.read.QueryContext(ctx, query, limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -161,6 +173,7 @@ func (f *Food) GetAllPaginated(page, pageSize int) ([]*Food, error) {
 			&food.Description,
 			&food.CreatedAt,
 			&food.UpdatedAt,
+			&food.Version,
 			&food.Country.ID,
 			&food.Country.CountryName,
 			&food.Country.CreatedAt,
@@ -170,7 +183,7 @@ func (f *Food) GetAllPaginated(page, pageSize int) ([]*Food, error) {
 		}
 
 		// get tastes
-		tastes, ids, err := f.tastesForFood(food.ID)
+		tastes, ids, err := tastesForFood(ctx, s.read, food.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -184,17 +197,22 @@ func (f *Food) GetAllPaginated(page, pageSize int) ([]*Food, error) {
 }
 
 // GetOneById returns one food by its id
-func (f *Food) GetOneById(foodID int) (*Food, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlFoods) GetOneById(ctx context.Context, foodID int) (*Food, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at,
+	return getFoodById(ctx, s.db, foodID)
+}
+
+// getFoodById returns one food by its id, using q so that it can be called inside a transaction
+func getFoodById(ctx context.Context, q dbtx, foodID int) (*Food, error) {
+	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at, f.version,
 				c.id, c.country_name, c.created_at, c.updated_at
 				from foods f
 				left join countries c on (f.country_id = c.id)
 				where f.id = $1`
 
-	row := db.QueryRowContext(ctx, query, foodID)
+	row := q.QueryRowContext(ctx, query, foodID)
 
 	var food Food
 
@@ -207,6 +225,7 @@ func (f *Food) GetOneById(foodID int) (*Food, error) {
 		&food.Description,
 		&food.CreatedAt,
 		&food.UpdatedAt,
+		&food.Version,
 		&food.Country.ID,
 		&food.Country.CountryName,
 		&food.Country.CreatedAt,
@@ -216,7 +235,7 @@ func (f *Food) GetOneById(foodID int) (*Food, error) {
 	}
 
 	// get tastes
-	tastes, ids, err := f.tastesForFood(food.ID)
+	tastes, ids, err := tastesForFood(ctx, q, food.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -227,17 +246,17 @@ func (f *Food) GetOneById(foodID int) (*Food, error) {
 }
 
 // GetOneBySlug returns one food by slug
-func (f *Food) GetOneBySlug(slug string) (*Food, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlFoods) GetOneBySlug(ctx context.Context, slug string) (*Food, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at,
+	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at, f.version,
 			c.id, c.country_name, c.created_at, c.updated_at
 			from foods f
 			left join countries c on (f.country_id = c.id)
 			where f.slug = $1`
 
-	row := db.QueryRowContext(ctx, query, slug)
+	row := s.read.QueryRowContext(ctx, query, slug)
 
 	var food Food
 
@@ -250,6 +269,7 @@ func (f *Food) GetOneBySlug(slug string) (*Food, error) {
 		&food.Description,
 		&food.CreatedAt,
 		&food.UpdatedAt,
+		&food.Version,
 		&food.Country.ID,
 		&food.Country.CountryName,
 		&food.Country.CreatedAt,
@@ -259,7 +279,7 @@ func (f *Food) GetOneBySlug(slug string) (*Food, error) {
 	}
 
 	// get tastes
-	tastes, ids, err := f.tastesForFood(food.ID)
+	tastes, ids, err := tastesForFood(ctx, s.read, food.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -269,118 +289,228 @@ func (f *Food) GetOneBySlug(slug string) (*Food, error) {
 	return &food, nil
 }
 
-// Insert saves one food to the database
-func (f *Food) Insert(food Food) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// Search returns the foods matching filter, ordered by name, with their countries but
+// without their tastes, which Taste.ForFoods loads for many foods in one query
+func (s *sqlFoods) Search(ctx context.Context, filter FoodFilter) ([]*Food, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	stmt := `insert into foods (known_as, country_id, make_year, slug, description, created_at, updated_at)
-			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+	query := `select f.id, f.known_as, f.country_id, f.make_year, f.slug, f.description, f.created_at, f.updated_at, f.version,
+			c.id, c.country_name, c.created_at, c.updated_at
+			from foods f
+			left join countries c on (f.country_id = c.id)
+			where ($1 = 0 or f.country_id = $1)
+			and ($2 = 0 or exists (select 1 from foods_tastes ft where ft.food_id = f.id and ft.taste_id = $2))
+			and lower(f.known_as) like $3 escape '\'
+			order by f.known_as, f.id`
 
-	var newID int
-	err := db.QueryRowContext(ctx, stmt,
-		food.KnownAs,
-		food.CountryID,
-		food.MakeYear,
-		slugify.Slugify(food.KnownAs),
-		food.Description,
-		time.Now(),
-		time.Now(),
-	).Scan(&newID)
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+
+	rows, err := s.read.QueryContext(ctx, query, filter.CountryID, filter.TasteID, pattern)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foods []*Food
+	for rows.Next() {
+		var food Food
+		err := rows.Scan(
+			&food.ID,
+			&food.KnownAs,
+			&food.CountryID,
+			&food.MakeYear,
+			&food.Slug,
+			&food.Description,
+			&food.CreatedAt,
+			&food.UpdatedAt,
+			&food.Version,
+			&food.Country.ID,
+			&food.Country.CountryName,
+			&food.Country.CreatedAt,
+			&food.Country.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		foods = append(foods, &food)
 	}
 
-	// update tastes using taste ids
-	if len(food.TasteIDs) > 0 {
-		stmt = `delete from foods_tastes where food_id = $1`
-		_, err := db.ExecContext(ctx, stmt, food.ID)
+	return foods, rows.Err()
+}
+
+// likeEscaper escapes the characters which are wildcards in a like pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// auditSnapshot returns the fields of a food which are recorded in the audit log
+func (f *Food) auditSnapshot() map[string]interface{} {
+	return map[string]interface{}{
+		"known_as":    f.KnownAs,
+		"country_id":  f.CountryID,
+		"make_year":   f.MakeYear,
+		"slug":        f.Slug,
+		"description": f.Description,
+	}
+}
+
+// replaceTastes replaces the tastes for a food with the tastes in tasteIDs
+func replaceTastes(ctx context.Context, q dbtx, foodID int, tasteIDs []int) error {
+	stmt := `delete from foods_tastes where food_id = $1`
+	_, err := q.ExecContext(ctx, stmt, foodID)
+	if err != nil {
+		return err
+	}
+
+	// add new tastes
+	for _, x := range tasteIDs {
+		stmt = `insert into foods_tastes (food_id, taste_id, created_at, updated_at)
+			values ($1, $2, $3, $4)`
+		_, err = q.ExecContext(ctx, stmt, foodID, x, time.Now(), time.Now())
 		if err != nil {
-			return newID, fmt.Errorf("food updated, but tastes not: %s", err.Error())
+			return err
 		}
+	}
+
+	return nil
+}
+
+// Insert saves one food to the database, and records who did it in the audit log
+func (s *sqlFoods) Insert(ctx context.Context, food Food, actor Actor) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	food.Slug = slugify.Slugify(food.KnownAs)
 
-		// add new tastes
-		for _, x := range food.TasteIDs {
-			stmt = `insert into foods_tastes (food_id, taste_id, created_at, updated_at)
-				values ($1, $2, $3, $4)`
-			_, err = db.ExecContext(ctx, stmt, newID, x, time.Now(), time.Now())
+	var newID int
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := `insert into foods (known_as, country_id, make_year, slug, description, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+		err := tx.QueryRowContext(ctx, stmt,
+			food.KnownAs,
+			food.CountryID,
+			food.MakeYear,
+			food.Slug,
+			food.Description,
+			time.Now(),
+			time.Now(),
+		).Scan(&newID)
+		if err != nil {
+			return s.translate(err)
+		}
+
+		// update tastes using taste ids
+		if len(food.TasteIDs) > 0 {
+			err = replaceTastes(ctx, tx, newID, food.TasteIDs)
 			if err != nil {
-				return newID, fmt.Errorf("food updated, but tastes not: %s", err.Error())
+				return fmt.Errorf("could not save tastes: %w", s.translate(err))
 			}
 		}
+
+		after := food.auditSnapshot()
+		after["taste_ids"] = food.TasteIDs
+
+		return actor.record(ctx, tx, "create", "food", newID, nil, after)
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	return newID, nil
 }
 
-// Update updates one food in the database
-func (f *Food) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// Update updates one food in the database, using the information stored in f, and records
+// what changed and who changed it in the audit log. It returns ErrEditConflict unless
+// f.Version is the version stored.
+func (s *sqlFoods) Update(ctx context.Context, f Food, actor Actor) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	stmt := `update foods set
-		known_as = $1,
-		country_id = $2,
-		make_year = $3,
-        slug = $4,
-    	description = $5,
-		updated_at = $6
-		where id = $7`
-
-	_, err := db.ExecContext(ctx, stmt,
-		f.KnownAs,
-		f.CountryID,
-		f.MakeYear,
-		slugify.Slugify(f.KnownAs),
-		f.Description,
-		time.Now(),
-		f.ID)
-	if err != nil {
-		return err
-	}
+	f.Slug = slugify.Slugify(f.KnownAs)
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := getFoodById(ctx, tx, f.ID)
+		if err != nil {
+			return err
+		}
+		if current.Version != f.Version {
+			return ErrEditConflict
+		}
 
-	// update tastes using taste ids
-	if len(f.TasteIDs) > 0 {
-		stmt = `delete from foods_tastes where food_id = $1`
-		_, err := db.ExecContext(ctx, stmt, f.ID)
+		stmt := `update foods set
+			known_as = $1,
+			country_id = $2,
+			make_year = $3,
+			slug = $4,
+			description = $5,
+			updated_at = $6,
+			version = version + 1
+			where id = $7 and version = $8`
+
+		result, err := tx.ExecContext(ctx, stmt,
+			f.KnownAs,
+			f.CountryID,
+			f.MakeYear,
+			f.Slug,
+			f.Description,
+			time.Now(),
+			f.ID,
+			f.Version)
 		if err != nil {
-			return fmt.Errorf("food updated, but tastes not: %s", err.Error())
+			return s.translate(err)
 		}
+		if err := checkVersion(result); err != nil {
+			return err
+		}
+
+		before := current.auditSnapshot()
+		after := f.auditSnapshot()
 
-		// add new tastes
-		for _, x := range f.TasteIDs {
-			stmt = `insert into foods_tastes (food_id, taste_id, created_at, updated_at)
-				values ($1, $2, $3, $4)`
-			_, err = db.ExecContext(ctx, stmt, f.ID, x, time.Now(), time.Now())
+		// update tastes using taste ids; nil means they were not given
+		if f.TasteIDs != nil {
+			err = replaceTastes(ctx, tx, f.ID, f.TasteIDs)
 			if err != nil {
-				return fmt.Errorf("food updated, but tastes not: %s", err.Error())
+				return fmt.Errorf("could not save tastes: %w", s.translate(err))
 			}
+
+			before["taste_ids"] = current.TasteIDs
+			after["taste_ids"] = f.TasteIDs
 		}
-	}
 
-	return nil
+		before, after = auditDiff(before, after)
+
+		return actor.record(ctx, tx, "update", "food", f.ID, before, after)
+	})
 }
 
-// DeleteByID deletes a food by id
-func (f *Food) DeleteByID(foodID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// DeleteByID deletes a food by id, and records the food as it was in the audit log
+func (s *sqlFoods) DeleteByID(ctx context.Context, foodID int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	stmt := `delete from foods where id = $1`
-	_, err := db.ExecContext(ctx, stmt, foodID)
-	if err != nil {
-		return err
-	}
-	return nil
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := getFoodById(ctx, tx, foodID)
+		if err != nil {
+			return err
+		}
+
+		stmt := `delete from foods where id = $1`
+		_, err = tx.ExecContext(ctx, stmt, foodID)
+		if err != nil {
+			return err
+		}
+
+		return actor.record(ctx, tx, "delete", "food", foodID, current, nil)
+	})
 }
 
 // All returns a list of all countries
-func (c *Country) All() ([]*Country, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlCountries) All(ctx context.Context) ([]*Country, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	query := `select id, country_name, created_at, updated_at  from countries order by country_name`
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := s.read.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -397,3 +527,71 @@ func (c *Country) All() ([]*Country, error) {
 	}
 	return countries, nil
 }
+
+// All returns every taste, ordered by name
+func (s *sqlTastes) All(ctx context.Context) ([]*Taste, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	query := `select id, taste, created_at, updated_at from tastes order by taste, id`
+	rows, err := s.read.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tastes []*Taste
+	for rows.Next() {
+		var taste Taste
+		err := rows.Scan(&taste.ID, &taste.Taste, &taste.CreatedAt, &taste.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tastes = append(tastes, &taste)
+	}
+
+	return tastes, rows.Err()
+}
+
+// ForFoods returns the tastes of each of the foods with foodIDs, ordered by name, in one
+// query. A food without tastes is left out of the map.
+func (s *sqlTastes) ForFoods(ctx context.Context, foodIDs []int) (map[int][]Taste, error) {
+	tastes := make(map[int][]Taste)
+	if len(foodIDs) == 0 {
+		return tastes, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	placeholders := make([]string, len(foodIDs))
+	args := make([]interface{}, len(foodIDs))
+	for i, id := range foodIDs {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+
+	query := `select ft.food_id, t.id, t.taste, t.created_at, t.updated_at
+			from foods_tastes ft
+			join tastes t on (t.id = ft.taste_id)
+			where ft.food_id in (` + strings.Join(placeholders, ", ") + `)
+			order by t.taste, t.id`
+
+	rows, err := s.read.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var foodID int
+		var taste Taste
+		err := rows.Scan(&foodID, &taste.ID, &taste.Taste, &taste.CreatedAt, &taste.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tastes[foodID] = append(tastes[foodID], taste)
+	}
+
+	return tastes, rows.Err()
+}
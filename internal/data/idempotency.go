@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// IdempotentRequest is a request a client made with an Idempotency-Key, and the response it
+// got, so that a retry of the request can be answered with the same response instead of
+// being handled again. Keys belong to a scope, such as the user who made the request, so
+// that two clients can never see each other's responses.
+type IdempotentRequest struct {
+	Scope       string
+	Key         string
+	RequestHash []byte
+
+	// Status is 0 until the response is saved, while the request is still being handled
+	Status int
+	Header map[string][]string
+	Body   []byte
+
+	Expiry    time.Time
+	CreatedAt time.Time
+}
+
+// Start records that a request with a key has begun, replacing any expired request with the
+// same key. If a request with the key which has not expired is already recorded, it returns
+// ErrDuplicate.
+func (s *sqlIdempotency) Start(ctx context.Context, req IdempotentRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	now := time.Now()
+
+	stmt := `delete from idempotency_keys where scope = $1 and idempotency_key = $2 and expiry <= $3`
+	_, err := s.db.ExecContext(ctx, stmt, req.Scope, req.Key, now)
+	if err != nil {
+		return err
+	}
+
+	stmt = `insert into idempotency_keys (scope, idempotency_key, request_hash, response_status, expiry, created_at)
+		values ($1, $2, $3, 0, $4, $5)`
+
+	_, err = s.db.ExecContext(ctx, stmt, req.Scope, req.Key, req.RequestHash, req.Expiry, now)
+	if err != nil {
+		return s.translate(err)
+	}
+
+	return nil
+}
+
+// Get returns the request recorded with a key, if it has not expired
+func (s *sqlIdempotency) Get(ctx context.Context, scope, key string) (*IdempotentRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	query := `select scope, idempotency_key, request_hash, response_status, response_header, response_body,
+			expiry, created_at
+			from idempotency_keys where scope = $1 and idempotency_key = $2 and expiry > $3`
+
+	var req IdempotentRequest
+	var header []byte
+	row := s.db.QueryRowContext(ctx, query, scope, key, time.Now())
+
+	err := row.Scan(
+		&req.Scope,
+		&req.Key,
+		&req.RequestHash,
+		&req.Status,
+		&header,
+		&req.Body,
+		&req.Expiry,
+		&req.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if header != nil {
+		if err := json.Unmarshal(header, &req.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return &req, nil
+}
+
+// Finish saves the response to a request recorded by Start
+func (s *sqlIdempotency) Finish(ctx context.Context, req IdempotentRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	header, err := json.Marshal(req.Header)
+	if err != nil {
+		return err
+	}
+
+	stmt := `update idempotency_keys set response_status = $1, response_header = $2, response_body = $3
+		where scope = $4 and idempotency_key = $5`
+
+	_, err = s.db.ExecContext(ctx, stmt, req.Status, header, req.Body, req.Scope, req.Key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete forgets the request recorded with a key, so that it can be tried again
+func (s *sqlIdempotency) Delete(ctx context.Context, scope, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := `delete from idempotency_keys where scope = $1 and idempotency_key = $2`
+	_, err := s.db.ExecContext(ctx, stmt, scope, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes every request which has expired, and returns how many were deleted
+func (s *sqlIdempotency) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := `delete from idempotency_keys where expiry <= $1`
+	result, err := s.db.ExecContext(ctx, stmt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
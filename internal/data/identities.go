@@ -0,0 +1,73 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Identity links a user to an account at an external OpenID Connect identity
+// provider. A user may have one identity per issuer.
+type Identity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetUser returns the user linked to the given issuer and subject
+func (s *sqlIdentities) GetUser(ctx context.Context, issuer, subject string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	query := `select u.id, u.email, u.first_name, u.last_name, u.password, u.user_active, u.created_at, u.updated_at, u.version
+			from user_identities i
+			inner join users u on (u.id = i.user_id)
+			where i.issuer = $1 and i.subject = $2`
+
+	var user User
+	row := s.db.QueryRowContext(ctx, query, issuer, subject)
+
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Password,
+		&user.Active,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Insert links a user to an external identity
+func (s *sqlIdentities) Insert(ctx context.Context, identity Identity) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := `insert into user_identities (user_id, issuer, subject, email, created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6)`
+
+	_, err := s.db.ExecContext(ctx, stmt,
+		identity.UserID,
+		identity.Issuer,
+		identity.Subject,
+		identity.Email,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return s.translate(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,1135 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	slugify "github.com/mozillazg/go-slugify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memory holds everything kept by the memory backend. A single lock guards all of it, which
+// is simple, and quite fast enough for the tests and demos the backend is meant for. Records
+// are stored and returned by value, so callers can never change what is stored by accident.
+type memory struct {
+	mu sync.RWMutex
+
+	users         map[int]User
+	tokens        map[int]Token
+	foods         map[int]Food
+	countries     map[int]Country
+	tastes        map[int]Taste
+	identities    map[int]Identity
+	verifications map[int]EmailVerification
+	idempotency   map[idempotencyKey]IdempotentRequest
+	audit         []AuditEvent
+
+	lastID map[string]int
+}
+
+// NewMemory returns Models which keep everything in memory, starting with the data in seed.
+// Nothing is saved, so everything is lost when the program stops. Seed passwords are hashed
+// at bcrypt's lowest cost, to keep tests fast.
+func NewMemory(seed Seed) (Models, error) {
+	m := &memory{
+		users:         make(map[int]User),
+		tokens:        make(map[int]Token),
+		foods:         make(map[int]Food),
+		countries:     make(map[int]Country),
+		tastes:        make(map[int]Taste),
+		identities:    make(map[int]Identity),
+		verifications: make(map[int]EmailVerification),
+		idempotency:   make(map[idempotencyKey]IdempotentRequest),
+		lastID:        make(map[string]int),
+	}
+
+	now := time.Now()
+
+	for _, c := range seed.Countries {
+		c.ID = m.seedID("countries", c.ID)
+		c.CreatedAt, c.UpdatedAt = now, now
+		m.countries[c.ID] = c
+	}
+
+	for _, t := range seed.Tastes {
+		t.ID = m.seedID("tastes", t.ID)
+		t.CreatedAt, t.UpdatedAt = now, now
+		m.tastes[t.ID] = t
+	}
+
+	for _, f := range seed.Foods {
+		f.Slug = slugify.Slugify(f.KnownAs)
+		if m.slugTaken(f.Slug, 0) {
+			return Models{}, ErrDuplicate
+		}
+
+		f.ID = m.nextID("foods")
+		f.Country, f.Tastes = Country{}, nil
+		f.TasteIDs = append([]int(nil), f.TasteIDs...)
+		f.CreatedAt, f.UpdatedAt = now, now
+		f.Version = 1
+		m.foods[f.ID] = f
+	}
+
+	for _, su := range seed.Users {
+		if m.emailTaken(su.Email, 0) {
+			return Models{}, ErrDuplicate
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(su.Password), bcrypt.MinCost)
+		if err != nil {
+			return Models{}, err
+		}
+
+		id := m.nextID("users")
+		m.users[id] = User{
+			ID:        id,
+			Email:     su.Email,
+			FirstName: su.FirstName,
+			LastName:  su.LastName,
+			Password:  string(hash),
+			Active:    su.Active,
+			CreatedAt: now,
+			UpdatedAt: now,
+			Version:   1,
+		}
+	}
+
+	return Models{
+		User:     memoryUsers{m},
+		Token:    memoryTokens{m},
+		Food:     memoryFoods{m},
+		Country:  memoryCountries{m},
+		Taste:    memoryTastes{m},
+		Identity: memoryIdentities{m},
+		Audit:    memoryAudit{m},
+
+		EmailVerification: memoryEmailVerifications{m},
+		Idempotency:       memoryIdempotency{m},
+	}, nil
+}
+
+// nextID returns the next ID for table, as an identity column would
+func (m *memory) nextID(table string) int {
+	m.lastID[table]++
+	return m.lastID[table]
+}
+
+// seedID returns id, if it is set, making sure later IDs for table come after it; otherwise,
+// it returns the next ID for table
+func (m *memory) seedID(table string, id int) int {
+	if id == 0 {
+		return m.nextID(table)
+	}
+	if id > m.lastID[table] {
+		m.lastID[table] = id
+	}
+	return id
+}
+
+// emailTaken reports whether a user other than the one with id has email
+func (m *memory) emailTaken(email string, id int) bool {
+	for _, u := range m.users {
+		if u.Email == email && u.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// slugTaken reports whether a food other than the one with id has slug
+func (m *memory) slugTaken(slug string, id int) bool {
+	for _, f := range m.foods {
+		if f.Slug == slug && f.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// newAuditEvent returns the event recording a change made by actor. It is built before the
+// change is made, so that a change is never made without its event.
+func (m *memory) newAuditEvent(actor Actor, action, entityType string, entityID int, before, after interface{}) (AuditEvent, error) {
+	event := AuditEvent{
+		ActorID:    actor.UserID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IP:         actor.IP,
+		RequestID:  actor.RequestID,
+		CreatedAt:  time.Now(),
+	}
+
+	b, err := auditJSON(before)
+	if err != nil {
+		return event, err
+	}
+	if b, ok := b.([]byte); ok {
+		event.Before = b
+	}
+
+	a, err := auditJSON(after)
+	if err != nil {
+		return event, err
+	}
+	if a, ok := a.([]byte); ok {
+		event.After = a
+	}
+
+	return event, nil
+}
+
+// record stores event in the audit log
+func (m *memory) record(event AuditEvent) {
+	event.ID = m.nextID("audit_events")
+	m.audit = append(m.audit, event)
+}
+
+// memoryUsers is the memory implementation of UserStore
+type memoryUsers struct {
+	*memory
+}
+
+func (s memoryUsers) GetAll(ctx context.Context) ([]*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []*User
+	for _, u := range s.users {
+		u.Password = ""
+		for _, t := range s.tokens {
+			if t.UserID == u.ID && t.Expiry.After(time.Now()) {
+				u.HasToken = true
+			}
+		}
+		users = append(users, &u)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].LastName != users[j].LastName {
+			return users[i].LastName < users[j].LastName
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	return users, nil
+}
+
+func (s memoryUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return &u, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (s memoryUsers) GetOne(ctx context.Context, id int) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &u, nil
+}
+
+func (s memoryUsers) Insert(ctx context.Context, user User, actor Actor) (int, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(user.Email, 0) {
+		return 0, ErrDuplicate
+	}
+
+	id := s.lastID["users"] + 1
+	event, err := s.newAuditEvent(actor, "create", "user", id, nil, user.auditSnapshot())
+	if err != nil {
+		return 0, err
+	}
+
+	user.ID = s.nextID("users")
+	user.Password = string(hashedPassword)
+	user.HasToken = false
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	s.users[user.ID] = user
+	s.record(event)
+
+	return user.ID, nil
+}
+
+func (s memoryUsers) Update(ctx context.Context, user User, actor Actor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[user.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if current.Version != user.Version {
+		return ErrEditConflict
+	}
+
+	if s.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+
+	before, after := auditDiff(current.auditSnapshot(), user.auditSnapshot())
+	event, err := s.newAuditEvent(actor, "update", "user", user.ID, before, after)
+	if err != nil {
+		return err
+	}
+
+	current.Email = user.Email
+	current.FirstName = user.FirstName
+	current.LastName = user.LastName
+	current.Active = user.Active
+	current.UpdatedAt = time.Now()
+	current.Version++
+	s.users[user.ID] = current
+	s.record(event)
+
+	return nil
+}
+
+func (s memoryUsers) DeleteByID(ctx context.Context, id int, actor Actor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	before := current.auditSnapshot()
+	before["id"] = current.ID
+	before["created_at"] = current.CreatedAt
+	before["updated_at"] = current.UpdatedAt
+
+	event, err := s.newAuditEvent(actor, "delete", "user", id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	delete(s.users, id)
+	for identityID, i := range s.identities {
+		if i.UserID == id {
+			delete(s.identities, identityID)
+		}
+	}
+	s.record(event)
+
+	return nil
+}
+
+func (s memoryUsers) ResetPassword(ctx context.Context, id int, password string, actor Actor) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	event, err := s.newAuditEvent(actor, "reset_password", "user", id, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	current.Password = string(hashedPassword)
+	s.users[id] = current
+	s.record(event)
+
+	return nil
+}
+
+// memoryTokens is the memory implementation of TokenStore
+type memoryTokens struct {
+	*memory
+}
+
+func (s memoryTokens) GetByToken(ctx context.Context, plainText string) (*Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.Token == plainText {
+			return &t, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (s memoryTokens) GetUserForToken(ctx context.Context, token Token) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[token.UserID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &u, nil
+}
+
+func (s memoryTokens) Insert(ctx context.Context, token Token, u User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if t.UserID == token.UserID {
+			delete(s.tokens, id)
+		}
+	}
+
+	token.ID = s.nextID("tokens")
+	token.Email = u.Email
+	token.CreatedAt = time.Now()
+	token.UpdatedAt = token.CreatedAt
+	s.tokens[token.ID] = token
+
+	return nil
+}
+
+func (s memoryTokens) DeleteByToken(ctx context.Context, plainText string) error {
+	return s.deleteWhere(ctx, func(t Token) bool {
+		return t.Token == plainText
+	})
+}
+
+func (s memoryTokens) DeleteTokensForUser(ctx context.Context, id int) error {
+	return s.deleteWhere(ctx, func(t Token) bool {
+		return t.UserID == id
+	})
+}
+
+func (s memoryTokens) DeleteOtherTokensForUser(ctx context.Context, id int, keep string) error {
+	return s.deleteWhere(ctx, func(t Token) bool {
+		return t.UserID == id && t.Token != keep
+	})
+}
+
+func (s memoryTokens) DeleteExpired(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, t := range s.tokens {
+		if t.Expiry.Before(time.Now()) {
+			delete(s.tokens, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// deleteWhere deletes every token for which match returns true
+func (s memoryTokens) deleteWhere(ctx context.Context, match func(Token) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if match(t) {
+			delete(s.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+// memoryFoods is the memory implementation of FoodStore
+type memoryFoods struct {
+	*memory
+}
+
+// food returns f as it is read from the database: with its country, and its tastes ordered
+// by name
+func (s memoryFoods) food(f Food) *Food {
+	f.Country = s.countries[f.CountryID]
+
+	var tastes []Taste
+	for _, id := range f.TasteIDs {
+		if t, ok := s.tastes[id]; ok {
+			tastes = append(tastes, t)
+		}
+	}
+	sort.Slice(tastes, func(i, j int) bool {
+		return tastes[i].Taste < tastes[j].Taste
+	})
+
+	f.Tastes = tastes
+	f.TasteIDs = nil
+	for _, t := range tastes {
+		f.TasteIDs = append(f.TasteIDs, t.ID)
+	}
+
+	return &f
+}
+
+// sorted returns every food, ordered by name
+func (s memoryFoods) sorted() []*Food {
+	var foods []*Food
+	for _, f := range s.foods {
+		foods = append(foods, s.food(f))
+	}
+
+	sort.Slice(foods, func(i, j int) bool {
+		if foods[i].KnownAs != foods[j].KnownAs {
+			return foods[i].KnownAs < foods[j].KnownAs
+		}
+		return foods[i].ID < foods[j].ID
+	})
+
+	return foods
+}
+
+func (s memoryFoods) GetAll(ctx context.Context) ([]*Food, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sorted(), nil
+}
+
+func (s memoryFoods) GetAllPaginated(ctx context.Context, page, pageSize int) ([]*Food, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	foods := s.sorted()
+
+	offset := (page - 1) * pageSize
+	if offset < 0 || offset >= len(foods) {
+		return nil, nil
+	}
+
+	end := offset + pageSize
+	if end > len(foods) {
+		end = len(foods)
+	}
+
+	return foods[offset:end], nil
+}
+
+func (s memoryFoods) GetOneById(ctx context.Context, foodID int) (*Food, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, ok := s.foods[foodID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.food(f), nil
+}
+
+func (s memoryFoods) GetOneBySlug(ctx context.Context, slug string) (*Food, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, f := range s.foods {
+		if f.Slug == slug {
+			return s.food(f), nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (s memoryFoods) Search(ctx context.Context, filter FoodFilter) ([]*Food, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(filter.Search)
+
+	var foods []*Food
+	for _, f := range s.sorted() {
+		if filter.CountryID != 0 && f.CountryID != filter.CountryID {
+			continue
+		}
+		if filter.TasteID != 0 && !slices.Contains(f.TasteIDs, filter.TasteID) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(f.KnownAs), search) {
+			continue
+		}
+
+		f.Tastes, f.TasteIDs = nil, nil
+		foods = append(foods, f)
+	}
+
+	return foods, nil
+}
+
+func (s memoryFoods) Insert(ctx context.Context, food Food, actor Actor) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	food.Slug = slugify.Slugify(food.KnownAs)
+	if s.slugTaken(food.Slug, 0) {
+		return 0, ErrDuplicate
+	}
+
+	after := food.auditSnapshot()
+	after["taste_ids"] = food.TasteIDs
+
+	event, err := s.newAuditEvent(actor, "create", "food", s.lastID["foods"]+1, nil, after)
+	if err != nil {
+		return 0, err
+	}
+
+	food.ID = s.nextID("foods")
+	food.Country, food.Tastes = Country{}, nil
+	food.TasteIDs = append([]int(nil), food.TasteIDs...)
+	food.CreatedAt = time.Now()
+	food.UpdatedAt = food.CreatedAt
+	food.Version = 1
+	s.foods[food.ID] = food
+	s.record(event)
+
+	return food.ID, nil
+}
+
+func (s memoryFoods) Update(ctx context.Context, food Food, actor Actor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.foods[food.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	current := s.food(stored)
+	if current.Version != food.Version {
+		return ErrEditConflict
+	}
+
+	food.Slug = slugify.Slugify(food.KnownAs)
+	if s.slugTaken(food.Slug, food.ID) {
+		return ErrDuplicate
+	}
+
+	before := current.auditSnapshot()
+	after := food.auditSnapshot()
+
+	// nil taste IDs were not given, and leave the tastes alone
+	if food.TasteIDs != nil {
+		before["taste_ids"] = current.TasteIDs
+		after["taste_ids"] = food.TasteIDs
+		stored.TasteIDs = append([]int(nil), food.TasteIDs...)
+	}
+
+	before, after = auditDiff(before, after)
+	event, err := s.newAuditEvent(actor, "update", "food", food.ID, before, after)
+	if err != nil {
+		return err
+	}
+
+	stored.KnownAs = food.KnownAs
+	stored.CountryID = food.CountryID
+	stored.MakeYear = food.MakeYear
+	stored.Slug = food.Slug
+	stored.Description = food.Description
+	stored.UpdatedAt = time.Now()
+	stored.Version++
+	s.foods[food.ID] = stored
+	s.record(event)
+
+	return nil
+}
+
+func (s memoryFoods) DeleteByID(ctx context.Context, foodID int, actor Actor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.foods[foodID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	event, err := s.newAuditEvent(actor, "delete", "food", foodID, s.food(stored), nil)
+	if err != nil {
+		return err
+	}
+
+	delete(s.foods, foodID)
+	s.record(event)
+
+	return nil
+}
+
+// memoryCountries is the memory implementation of CountryStore
+type memoryCountries struct {
+	*memory
+}
+
+func (s memoryCountries) All(ctx context.Context) ([]*Country, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var countries []*Country
+	for _, c := range s.countries {
+		countries = append(countries, &c)
+	}
+
+	sort.Slice(countries, func(i, j int) bool {
+		if countries[i].CountryName != countries[j].CountryName {
+			return countries[i].CountryName < countries[j].CountryName
+		}
+		return countries[i].ID < countries[j].ID
+	})
+
+	return countries, nil
+}
+
+// memoryTastes is the memory implementation of TasteStore
+type memoryTastes struct {
+	*memory
+}
+
+func (s memoryTastes) All(ctx context.Context) ([]*Taste, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var tastes []*Taste
+	for _, t := range s.tastes {
+		tastes = append(tastes, &t)
+	}
+
+	sort.Slice(tastes, func(i, j int) bool {
+		if tastes[i].Taste != tastes[j].Taste {
+			return tastes[i].Taste < tastes[j].Taste
+		}
+		return tastes[i].ID < tastes[j].ID
+	})
+
+	return tastes, nil
+}
+
+func (s memoryTastes) ForFoods(ctx context.Context, foodIDs []int) (map[int][]Taste, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tastes := make(map[int][]Taste)
+	for _, id := range foodIDs {
+		f, ok := s.foods[id]
+		if !ok {
+			continue
+		}
+
+		if food := (memoryFoods{s.memory}).food(f); len(food.Tastes) > 0 {
+			tastes[id] = food.Tastes
+		}
+	}
+
+	return tastes, nil
+}
+
+// memoryIdentities is the memory implementation of IdentityStore
+type memoryIdentities struct {
+	*memory
+}
+
+func (s memoryIdentities) GetUser(ctx context.Context, issuer, subject string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, i := range s.identities {
+		if i.Issuer == issuer && i.Subject == subject {
+			if u, ok := s.users[i.UserID]; ok {
+				return &u, nil
+			}
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (s memoryIdentities) Insert(ctx context.Context, identity Identity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, i := range s.identities {
+		if i.Issuer == identity.Issuer && i.Subject == identity.Subject {
+			return ErrDuplicate
+		}
+	}
+
+	identity.ID = s.nextID("user_identities")
+	identity.CreatedAt = time.Now()
+	identity.UpdatedAt = identity.CreatedAt
+	s.identities[identity.ID] = identity
+
+	return nil
+}
+
+// memoryAudit is the memory implementation of AuditStore
+type memoryAudit struct {
+	*memory
+}
+
+func (s memoryAudit) GetAll(ctx context.Context, filter AuditFilter, page, pageSize int) ([]*AuditEvent, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []*AuditEvent
+	for _, e := range s.audit {
+		switch {
+		case filter.EntityType != "" && e.EntityType != filter.EntityType,
+			filter.EntityID != 0 && e.EntityID != filter.EntityID,
+			filter.ActorID != 0 && e.ActorID != filter.ActorID,
+			!filter.Since.IsZero() && e.CreatedAt.Before(filter.Since):
+			continue
+		}
+		events = append(events, &e)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.After(events[j].CreatedAt)
+		}
+		return events[i].ID > events[j].ID
+	})
+
+	total := len(events)
+
+	offset := (page - 1) * pageSize
+	if offset < 0 || offset >= total {
+		return nil, total, nil
+	}
+
+	end := offset + pageSize
+	if end > total {
+		end = total
+	}
+
+	return events[offset:end], total, nil
+}
+
+// memoryEmailVerifications is the memory implementation of EmailVerificationStore
+type memoryEmailVerifications struct {
+	*memory
+}
+
+func (s memoryEmailVerifications) Insert(ctx context.Context, verification EmailVerification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, v := range s.verifications {
+		if v.UserID == verification.UserID {
+			delete(s.verifications, id)
+		}
+	}
+
+	// only the hash of the token is kept, as in the database
+	verification.ID = s.nextID("email_verifications")
+	verification.Token = ""
+	verification.CreatedAt = time.Now()
+	s.verifications[verification.ID] = verification
+
+	return nil
+}
+
+func (s memoryEmailVerifications) GetByToken(ctx context.Context, plainText string) (*EmailVerification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := sha256.Sum256([]byte(plainText))
+	for _, v := range s.verifications {
+		if bytes.Equal(v.TokenHash, hash[:]) {
+			return &v, nil
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func (s memoryEmailVerifications) DeleteForUser(ctx context.Context, userID int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, v := range s.verifications {
+		if v.UserID == userID {
+			delete(s.verifications, id)
+		}
+	}
+
+	return nil
+}
+
+func (s memoryEmailVerifications) DeleteExpired(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, v := range s.verifications {
+		if v.Expiry.Before(time.Now()) {
+			delete(s.verifications, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// idempotencyKey is what the memory backend stores idempotent requests under
+type idempotencyKey struct {
+	scope, key string
+}
+
+// memoryIdempotency is the memory implementation of IdempotencyStore
+type memoryIdempotency struct {
+	*memory
+}
+
+func (s memoryIdempotency) Start(ctx context.Context, req IdempotentRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{req.Scope, req.Key}
+	if existing, ok := s.idempotency[k]; ok && existing.Expiry.After(time.Now()) {
+		return ErrDuplicate
+	}
+
+	req.Status, req.Header, req.Body = 0, nil, nil
+	req.RequestHash = bytes.Clone(req.RequestHash)
+	req.CreatedAt = time.Now()
+	s.idempotency[k] = req
+
+	return nil
+}
+
+func (s memoryIdempotency) Get(ctx context.Context, scope, key string) (*IdempotentRequest, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	req, ok := s.idempotency[idempotencyKey{scope, key}]
+	if !ok || !req.Expiry.After(time.Now()) {
+		return nil, sql.ErrNoRows
+	}
+
+	req.RequestHash = bytes.Clone(req.RequestHash)
+	req.Header = cloneHeader(req.Header)
+	req.Body = bytes.Clone(req.Body)
+	return &req, nil
+}
+
+func (s memoryIdempotency) Finish(ctx context.Context, req IdempotentRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := idempotencyKey{req.Scope, req.Key}
+	stored, ok := s.idempotency[k]
+	if !ok {
+		return nil
+	}
+
+	stored.Status = req.Status
+	stored.Header = cloneHeader(req.Header)
+	stored.Body = bytes.Clone(req.Body)
+	s.idempotency[k] = stored
+
+	return nil
+}
+
+func (s memoryIdempotency) Delete(ctx context.Context, scope, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.idempotency, idempotencyKey{scope, key})
+
+	return nil
+}
+
+func (s memoryIdempotency) DeleteExpired(ctx context.Context) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for k, req := range s.idempotency {
+		if !req.Expiry.After(time.Now()) {
+			delete(s.idempotency, k)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// cloneHeader returns a deep copy of a response's header
+func cloneHeader(header map[string][]string) map[string][]string {
+	if header == nil {
+		return nil
+	}
+
+	out := make(map[string][]string, len(header))
+	for name, values := range header {
+		out[name] = slices.Clone(values)
+	}
+
+	return out
+}
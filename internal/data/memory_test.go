@@ -0,0 +1,63 @@
+package data_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/food/internal/data/storetest"
+)
+
+func TestMemory_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, seed data.Seed) data.Models {
+		m, err := data.NewMemory(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	})
+}
+
+// the cache must not change how the foods it wraps behave
+func TestCachedFoods_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, seed data.Seed) data.Models {
+		m, err := data.NewMemory(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Food = data.NewCachedFoods(m.Food, time.Minute, 100)
+		return m
+	})
+}
+
+func TestLoadSeed(t *testing.T) {
+	seed, err := data.LoadSeed("testdata/demo.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := data.NewMemory(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := m.Food.GetOneBySlug(t.Context(), "hamburger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Country.CountryName != "United States" || len(f.Tastes) == 0 {
+		t.Errorf("the demo food was not seeded: %+v", f)
+	}
+
+	u, err := m.User.GetByEmail(t.Context(), "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := u.PasswordMatches("password"); !ok {
+		t.Error("the demo user's password does not match")
+	}
+
+	if _, err := data.NewMemory(data.Seed{Users: []data.SeedUser{{Email: "a@example.com"}, {Email: "a@example.com"}}}); err == nil {
+		t.Error("expected an error for a seed with duplicate users")
+	}
+}
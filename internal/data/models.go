@@ -14,59 +14,32 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-const dbTimeout = time.Second * 3
-
-var db *sql.DB
-
-// New is the function used to create an instance of the data package. It returns the type
-// Model, which embeds all of the types we want to be available to our application.
-func New(dbPool *sql.DB) Models {
-	db = dbPool
-
-	return Models{
-		User:    User{},
-		Token:   Token{},
-		Food:    Food{},
-		Country: Country{},
-	}
-}
-
-// Models is the type for this package. Note that any model that is included as a member
-// in this type is available to us throughout the application, anywhere that the
-// app variable is used, provided that the model is also added in the New function.
-type Models struct {
-	User    User
-	Token   Token
-	Food    Food
-	Country Country
-}
-
 // User is the stucture which holds one user from the database. Note
-// that it embeds a token type.
+// that the password hash is never included in exported JSON.
 type User struct {
 	ID        int       `json:"id"`
 	Email     string    `json:"email"`
 	FirstName string    `json:"first_name,omitempty"`
 	LastName  string    `json:"last_name,omitempty"`
-	Password  string    `json:"password"`
+	Password  string    `json:"-"`
 	Active    int       `json:"active"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	Token     Token     `json:"token"`
+	HasToken  bool      `json:"has_token"`
+	Version   int       `json:"version"`
 }
 
-func (u *User) GetAll() ([]*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// GetAll returns all users, ordered by last name. Password hashes are not loaded, but
+// HasToken is set for users who currently have an unexpired token.
+func (s *sqlUsers) GetAll(ctx context.Context) ([]*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at,
-	case
-		when (select count(id) from tokens t where user_id = users.id and t.expiry > NOW()) > 0 then 1
-		else 0
-	end as has_token
+	query := `select id, email, first_name, last_name, user_active, created_at, updated_at, version,
+	exists (select 1 from tokens t where t.user_id = users.id and t.expiry > $1) as has_token
 	from users order by last_name`
 
-	rows, err := db.QueryContext(ctx, query)
+	rows, err := s.read.QueryContext(ctx, query, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -81,11 +54,11 @@ func (u *User) GetAll() ([]*User, error) {
 			&user.Email,
 			&user.FirstName,
 			&user.LastName,
-			&user.Password,
 			&user.Active,
 			&user.CreatedAt,
 			&user.UpdatedAt,
-			&user.Token.ID,
+			&user.Version,
+			&user.HasToken,
 		)
 		if err != nil {
 			return nil, err
@@ -98,14 +71,14 @@ func (u *User) GetAll() ([]*User, error) {
 }
 
 // GetByEmail returns one user by email
-func (u *User) GetByEmail(email string) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where email = $1`
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version from users where email = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, email)
+	row := s.db.QueryRowContext(ctx, query, email)
 
 	err := row.Scan(
 		&user.ID,
@@ -116,6 +89,7 @@ func (u *User) GetByEmail(email string) (*User, error) {
 		&user.Active,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Version,
 	)
 
 	if err != nil {
@@ -126,14 +100,19 @@ func (u *User) GetByEmail(email string) (*User, error) {
 }
 
 // GetOne returns one user by id
-func (u *User) GetOne(id int) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlUsers) GetOne(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1`
+	return s.getOne(ctx, s.db, id)
+}
+
+// getOne returns one user by id, using q so that it can be called inside a transaction
+func (s *sqlUsers) getOne(ctx context.Context, q dbtx, id int) (*User, error) {
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version from users where id = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, id)
+	row := q.QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
 		&user.ID,
@@ -144,6 +123,7 @@ func (u *User) GetOne(id int) (*User, error) {
 		&user.Active,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Version,
 	)
 
 	if err != nil {
@@ -153,90 +133,131 @@ func (u *User) GetOne(id int) (*User, error) {
 	return &user, nil
 }
 
+// auditSnapshot returns the fields of a user which are recorded in the audit log. The
+// password hash is deliberately left out.
+func (u *User) auditSnapshot() map[string]interface{} {
+	return map[string]interface{}{
+		"email":      u.Email,
+		"first_name": u.FirstName,
+		"last_name":  u.LastName,
+		"active":     u.Active,
+	}
+}
+
 // Update updates one user in the database, using the information
-// stored in the receiver u
-func (u *User) Update() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// stored in u, and records what changed and who changed it in the
+// audit log. It returns ErrEditConflict unless u.Version is the
+// version stored.
+func (s *sqlUsers) Update(ctx context.Context, u User, actor Actor) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	stmt := `update users set
-		email = $1,
-		first_name = $2,
-		last_name = $3,
-		user_active = $4,
-		updated_at = $5
-		where id = $6
-	`
-
-	_, err := db.ExecContext(ctx, stmt,
-		u.Email,
-		u.FirstName,
-		u.LastName,
-		u.Active,
-		time.Now(),
-		u.ID,
-	)
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := s.getOne(ctx, tx, u.ID)
+		if err != nil {
+			return err
+		}
+		if current.Version != u.Version {
+			return ErrEditConflict
+		}
 
-	if err != nil {
-		return err
-	}
+		stmt := `update users set
+			email = $1,
+			first_name = $2,
+			last_name = $3,
+			user_active = $4,
+			updated_at = $5,
+			version = version + 1
+			where id = $6 and version = $7
+		`
+
+		result, err := tx.ExecContext(ctx, stmt,
+			u.Email,
+			u.FirstName,
+			u.LastName,
+			u.Active,
+			time.Now(),
+			u.ID,
+			u.Version,
+		)
+		if err != nil {
+			return s.translate(err)
+		}
+		if err := checkVersion(result); err != nil {
+			return err
+		}
 
-	return nil
+		before, after := auditDiff(current.auditSnapshot(), u.auditSnapshot())
+
+		return actor.record(ctx, tx, "update", "user", u.ID, before, after)
+	})
 }
 
-// Delete deletes one user from the datbase, by ID
-func (u *User) Delete() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+// DeleteByID deletes one user from the database, by ID, with the identities linked to
+// them, and records the user as it was in the audit log
+func (s *sqlUsers) DeleteByID(ctx context.Context, id int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	stmt := `delete from users where id = $1`
-
-	_, err := db.ExecContext(ctx, stmt, u.ID)
-	if err != nil {
-		return err
-	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		current, err := s.getOne(ctx, tx, id)
+		if err != nil {
+			return err
+		}
 
-	return nil
-}
+		// an identity left behind would stop its account signing in again, as a new user
+		_, err = tx.ExecContext(ctx, `delete from user_identities where user_id = $1`, id)
+		if err != nil {
+			return err
+		}
 
-func (u *User) DeleteByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
+		stmt := `delete from users where id = $1`
 
-	stmt := `delete from users where id = $1`
+		_, err = tx.ExecContext(ctx, stmt, id)
+		if err != nil {
+			return err
+		}
 
-	_, err := db.ExecContext(ctx, stmt, id)
-	if err != nil {
-		return err
-	}
+		before := current.auditSnapshot()
+		before["id"] = current.ID
+		before["created_at"] = current.CreatedAt
+		before["updated_at"] = current.UpdatedAt
 
-	return nil
+		return actor.record(ctx, tx, "delete", "user", id, before, nil)
+	})
 }
 
-// Insert inserts a new user into the datbase, and returns the ID of the newly inserted row
-func (u *User) Insert(user User) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
+// Insert inserts a new user into the datbase, records who created it in the audit log,
+// and returns the ID of the newly inserted row
+func (s *sqlUsers) Insert(ctx context.Context, user User, actor Actor) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
 	if err != nil {
 		return 0, err
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
 	var newID int
-	stmt := `insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
-		values ($1, $2, $3, $4, $5, $6, $7) returning id`
-
-	err = db.QueryRowContext(ctx, stmt,
-		user.Email,
-		user.FirstName,
-		user.LastName,
-		hashedPassword,
-		user.Active,
-		time.Now(),
-		time.Now(),
-	).Scan(&newID)
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := `insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+		err := tx.QueryRowContext(ctx, stmt,
+			user.Email,
+			user.FirstName,
+			user.LastName,
+			hashedPassword,
+			user.Active,
+			time.Now(),
+			time.Now(),
+		).Scan(&newID)
+		if err != nil {
+			return s.translate(err)
+		}
 
+		return actor.record(ctx, tx, "create", "user", newID, nil, user.auditSnapshot())
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -244,23 +265,32 @@ func (u *User) Insert(user User) (int, error) {
 	return newID, nil
 }
 
-// ResetPassword is the method we will use to change a user's password.
-func (u *User) ResetPassword(password string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
-	defer cancel()
-
+// ResetPassword is the method we will use to change a user's password. The audit
+// log records that the password was changed, but never the password itself.
+func (s *sqlUsers) ResetPassword(ctx context.Context, id int, password string, actor Actor) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return err
 	}
 
-	stmt := `update users set password = $1 where id = $2`
-	_, err = db.ExecContext(ctx, stmt, hashedPassword, u.ID)
-	if err != nil {
-		return err
-	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-	return nil
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		stmt := `update users set password = $1 where id = $2`
+		result, err := tx.ExecContext(ctx, stmt, hashedPassword, id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+
+		return actor.record(ctx, tx, "reset_password", "user", id, nil, nil)
+	})
 }
 
 // PasswordMatches uses Go's bcrypt package to compare a user supplied password
@@ -297,8 +327,8 @@ type Token struct {
 
 // GetByToken takes a plain text token string, and looks up the full token from
 // the database. It returns a pointer to the Token model.
-func (t *Token) GetByToken(plainText string) (*Token, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlTokens) GetByToken(ctx context.Context, plainText string) (*Token, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	query := `select id, user_id, email, token, token_hash, created_at, updated_at, expiry
@@ -306,7 +336,7 @@ func (t *Token) GetByToken(plainText string) (*Token, error) {
 
 	var token Token
 
-	row := db.QueryRowContext(ctx, query, plainText)
+	row := s.db.QueryRowContext(ctx, query, plainText)
 	err := row.Scan(
 		&token.ID,
 		&token.UserID,
@@ -319,6 +349,9 @@ func (t *Token) GetByToken(plainText string) (*Token, error) {
 	)
 
 	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logger.ErrorContext(ctx, "could not look up token", "err", err)
+		}
 		return nil, err
 	}
 
@@ -327,14 +360,14 @@ func (t *Token) GetByToken(plainText string) (*Token, error) {
 
 // GetUserForToken takes a token parameter, and uses the UserID field from that parameter
 // to look a user up by id. It returns a pointer to the user model.
-func (t *Token) GetUserForToken(token Token) (*User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlTokens) GetUserForToken(ctx context.Context, token Token) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
-	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at from users where id = $1`
+	query := `select id, email, first_name, last_name, password, user_active, created_at, updated_at, version from users where id = $1`
 
 	var user User
-	row := db.QueryRowContext(ctx, query, token.UserID)
+	row := s.db.QueryRowContext(ctx, query, token.UserID)
 
 	err := row.Scan(
 		&user.ID,
@@ -345,6 +378,7 @@ func (t *Token) GetUserForToken(token Token) (*User, error) {
 		&user.Active,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Version,
 	)
 
 	if err != nil {
@@ -355,7 +389,7 @@ func (t *Token) GetUserForToken(token Token) (*User, error) {
 }
 
 // GenerateToken generates a secure token of exactly 26 characters in length and returns it
-func (t *Token) GenerateToken(userID int, ttl time.Duration) (*Token, error) {
+func GenerateToken(userID int, ttl time.Duration) (*Token, error) {
 	token := &Token{
 		UserID: userID,
 		Expiry: time.Now().Add(ttl),
@@ -376,11 +410,15 @@ func (t *Token) GenerateToken(userID int, ttl time.Duration) (*Token, error) {
 
 // AuthenticateToken takes the full http request, extracts the authorization header,
 // takes the plain text token from that header and looks up the associated token entry
-// in the database, and then finds the user associated with that token. If the token
-// is valid and a user is found, the user is returned; otherwise, it returns an error.
-func (t *Token) AuthenticateToken(r *http.Request) (*User, error) {
-	// get the authorization header
-	authorizationHeader := r.Header.Get("Authorization")
+// in tokens, and then finds the user associated with that token. If the token is valid
+// and a user is found, the user is returned; otherwise, it returns an error.
+func AuthenticateToken(r *http.Request, tokens TokenStore) (*User, error) {
+	return AuthenticateAuthorization(r.Context(), r.Header.Get("Authorization"), tokens)
+}
+
+// AuthenticateAuthorization does what AuthenticateToken does with the value of an
+// Authorization header, wherever it came from, such as gRPC metadata
+func AuthenticateAuthorization(ctx context.Context, authorizationHeader string, tokens TokenStore) (*User, error) {
 	if authorizationHeader == "" {
 		return nil, errors.New("no authorization header received")
 	}
@@ -399,7 +437,7 @@ func (t *Token) AuthenticateToken(r *http.Request) (*User, error) {
 	}
 
 	// get the token from the database, using the plain text token to find it
-	tkn, err := t.GetByToken(token)
+	tkn, err := tokens.GetByToken(ctx, token)
 	if err != nil {
 		return nil, errors.New("no matching token found")
 	}
@@ -410,7 +448,7 @@ func (t *Token) AuthenticateToken(r *http.Request) (*User, error) {
 	}
 
 	// get the user associated with the token
-	user, err := t.GetUserForToken(*tkn)
+	user, err := tokens.GetUserForToken(ctx, *tkn)
 	if err != nil {
 		return nil, errors.New("no matching user found")
 	}
@@ -423,13 +461,13 @@ func (t *Token) AuthenticateToken(r *http.Request) (*User, error) {
 }
 
 // Insert inserts a token into the database
-func (t *Token) Insert(token Token, u User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlTokens) Insert(ctx context.Context, token Token, u User) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	// delete any existing tokens
 	stmt := `delete from tokens where user_id = $1`
-	_, err := db.ExecContext(ctx, stmt, token.UserID)
+	_, err := s.db.ExecContext(ctx, stmt, token.UserID)
 	if err != nil {
 		return err
 	}
@@ -442,7 +480,7 @@ func (t *Token) Insert(token Token, u User) error {
 	stmt = `insert into tokens (user_id, email, token, token_hash, created_at, updated_at, expiry)
 		values ($1, $2, $3, $4, $5, $6, $7)`
 
-	_, err = db.ExecContext(ctx, stmt,
+	_, err = s.db.ExecContext(ctx, stmt,
 		token.UserID,
 		token.Email,
 		token.Token,
@@ -459,13 +497,13 @@ func (t *Token) Insert(token Token, u User) error {
 }
 
 // DeleteByToken deletes a token, by plain text token
-func (t *Token) DeleteByToken(plainText string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlTokens) DeleteByToken(ctx context.Context, plainText string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	stmt := `delete from tokens where token = $1`
 
-	_, err := db.ExecContext(ctx, stmt, plainText)
+	_, err := s.db.ExecContext(ctx, stmt, plainText)
 	if err != nil {
 		return err
 	}
@@ -473,12 +511,12 @@ func (t *Token) DeleteByToken(plainText string) error {
 	return nil
 }
 
-func (t *Token) DeleteTokensForUser(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbTimeout)
+func (s *sqlTokens) DeleteTokensForUser(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
 	defer cancel()
 
 	stmt := "delete from tokens where user_id = $1"
-	_, err := db.ExecContext(ctx, stmt, id)
+	_, err := s.db.ExecContext(ctx, stmt, id)
 	if err != nil {
 		return err
 	}
@@ -486,16 +524,45 @@ func (t *Token) DeleteTokensForUser(id int) error {
 	return nil
 }
 
+// DeleteOtherTokensForUser deletes every token belonging to a user, except for the
+// plain text token keep
+func (s *sqlTokens) DeleteOtherTokensForUser(ctx context.Context, id int, keep string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := "delete from tokens where user_id = $1 and token <> $2"
+	_, err := s.db.ExecContext(ctx, stmt, id, keep)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes every token which has expired, and returns how many were deleted
+func (s *sqlTokens) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := "delete from tokens where expiry < $1"
+	result, err := s.db.ExecContext(ctx, stmt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
 // ValidToken makes certain that a given token is valid; in order to be valid,
-// the token must exist in the database, the associated user must exist in the database,
-// and the token must not have expired.
-func (t *Token) ValidToken(plainText string) (bool, error) {
-	token, err := t.GetByToken(plainText)
+// the token must exist in tokens, the associated user must exist, and the token
+// must not have expired.
+func ValidToken(ctx context.Context, tokens TokenStore, plainText string) (bool, error) {
+	token, err := tokens.GetByToken(ctx, plainText)
 	if err != nil {
 		return false, errors.New("no matching token found")
 	}
 
-	_, err = t.GetUserForToken(*token)
+	_, err = tokens.GetUserForToken(ctx, *token)
 	if err != nil {
 		return false, errors.New("no matching user found")
 	}
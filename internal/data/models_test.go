@@ -1,8 +1,13 @@
 package data
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
 func Test_Ping(t *testing.T) {
+	requirePostgres(t)
+
 	err := testDB.Ping()
 	if err != nil {
 		t.Error("failed to ping database")
@@ -10,7 +15,9 @@ func Test_Ping(t *testing.T) {
 }
 
 func TestFood_GetAll(t *testing.T) {
-	all, err := models.Food.GetAll()
+	requirePostgres(t)
+
+	all, err := models.Food.GetAll(context.Background())
 	if err != nil {
 		t.Error("failed to get all foods", err)
 	}
@@ -21,7 +28,9 @@ func TestFood_GetAll(t *testing.T) {
 }
 
 func TestFood_GetOneByID(t *testing.T) {
-	f, err := models.Food.GetOneById(1)
+	requirePostgres(t)
+
+	f, err := models.Food.GetOneById(context.Background(), 1)
 	if err != nil {
 		t.Error("failed to get one food by id", err)
 	}
@@ -32,7 +41,9 @@ func TestFood_GetOneByID(t *testing.T) {
 }
 
 func TestFood_GetOneBySlug(t *testing.T) {
-	f, err := models.Food.GetOneBySlug("hamburger")
+	requirePostgres(t)
+
+	f, err := models.Food.GetOneBySlug(context.Background(), "hamburger")
 	if err != nil {
 		t.Error("failed to get one food by slug", err)
 	}
@@ -41,8 +52,42 @@ func TestFood_GetOneBySlug(t *testing.T) {
 		t.Errorf("expected title to be Hamburger but got %s", f.KnownAs)
 	}
 
-	_, err = models.Food.GetOneBySlug("bad-slug")
+	_, err = models.Food.GetOneBySlug(context.Background(), "bad-slug")
 	if err == nil {
 		t.Error("did not get an error when attempting to fetch non-existent slug")
 	}
 }
+
+func TestFood_Update_Audited(t *testing.T) {
+	requirePostgres(t)
+
+	f, err := models.Food.GetOneById(context.Background(), 1)
+	if err != nil {
+		t.Fatal("failed to get one food by id", err)
+	}
+
+	f.Description = "A new description"
+	err = models.Food.Update(context.Background(), *f, Actor{UserID: 1, IP: "127.0.0.1", RequestID: "test"})
+	if err != nil {
+		t.Fatal("failed to update food", err)
+	}
+
+	events, total, err := models.Audit.GetAll(context.Background(), AuditFilter{EntityType: "food", EntityID: 1}, 1, 10)
+	if err != nil {
+		t.Fatal("failed to get audit events", err)
+	}
+
+	if total != 1 || len(events) != 1 {
+		t.Fatalf("expected one audit event, got %d", total)
+	}
+
+	if string(events[0].After) != `{"description": "A new description"}` {
+		t.Errorf("expected only the description in the audit event, got %s", events[0].After)
+	}
+
+	// the audit log is append-only
+	_, err = testDB.Exec("delete from audit_events")
+	if err == nil {
+		t.Error("was able to delete from audit_events")
+	}
+}
@@ -0,0 +1,12 @@
+package data_test
+
+import (
+	"testing"
+
+	"github.com/food/internal/data"
+	"github.com/food/internal/data/storetest"
+)
+
+func TestPostgres_Conformance(t *testing.T) {
+	storetest.Run(t, data.NewSeededPostgres)
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+)
+
+// ReplicaSet is a primary database along with read replicas of it. Queries which can put up
+// with replication lag, such as listing foods, are spread across the healthy replicas in
+// turn. A replica is marked unhealthy as soon as a query on it fails, and the query is run
+// again on the primary; it is used again once Check finds it healthy. When no replica is
+// healthy, everything runs on the primary.
+type ReplicaSet struct {
+	primary  *sql.DB
+	replicas []*sql.DB
+	healthy  []atomic.Bool
+	next     atomic.Uint64
+
+	// settings are those of the Models using the set, which NewPostgresWithReplicas passes on
+	settings
+}
+
+// NewReplicaSet returns a ReplicaSet for primary and replicas, all of which start out healthy
+func NewReplicaSet(primary *sql.DB, replicas ...*sql.DB) *ReplicaSet {
+	r := &ReplicaSet{
+		primary:  primary,
+		replicas: replicas,
+		healthy:  make([]atomic.Bool, len(replicas)),
+		settings: newSettings(nil),
+	}
+	for i := range r.healthy {
+		r.healthy[i].Store(true)
+	}
+
+	return r
+}
+
+// Check pings every replica, marking those which answer healthy and the rest unhealthy, and
+// returns the number which are healthy
+func (r *ReplicaSet) Check(ctx context.Context) int {
+	var n int
+
+	for i, db := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+
+		if err != nil {
+			r.markDown(ctx, i, err)
+			continue
+		}
+
+		if !r.healthy[i].Swap(true) {
+			r.logger.InfoContext(ctx, "read replica is healthy again", "replica", i)
+		}
+		n++
+	}
+
+	return n
+}
+
+// Replicas returns the read replicas, in the order they were given, which is the order
+// they are numbered in the log
+func (r *ReplicaSet) Replicas() []*sql.DB {
+	return r.replicas
+}
+
+// Close closes the replicas, but not the primary
+func (r *ReplicaSet) Close() error {
+	var errs []error
+	for _, db := range r.replicas {
+		errs = append(errs, db.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// primaryKey marks a context whose reads all run on the primary
+type primaryKey struct{}
+
+// onPrimary returns ctx with every read made with it run on the primary, for reads which
+// must see the latest changes even where a replica would do otherwise, such as those which
+// fill a cache
+func onPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// pick returns the next healthy replica in turn, and its index, or nil if there is none or
+// ctx is onPrimary
+func (r *ReplicaSet) pick(ctx context.Context) (int, *sql.DB) {
+	n := uint64(len(r.replicas))
+	if n == 0 || ctx.Value(primaryKey{}) != nil {
+		return -1, nil
+	}
+
+	start := r.next.Add(1)
+	for k := uint64(0); k < n; k++ {
+		i := int((start + k) % n)
+		if r.healthy[i].Load() {
+			return i, r.replicas[i]
+		}
+	}
+
+	return -1, nil
+}
+
+// markDown marks replica i unhealthy, because of err
+func (r *ReplicaSet) markDown(ctx context.Context, i int, err error) {
+	if r.healthy[i].Swap(false) {
+		r.logger.WarnContext(ctx, "read replica is unhealthy; reading from the primary", "replica", i, "err", err)
+	}
+}
+
+// failed reports whether err, from a query on a replica, means the query should be run
+// again on the primary. It does not if the caller has given up.
+func failed(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil
+}
+
+func (r *ReplicaSet) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if i, db := r.pick(ctx); db != nil {
+		rows, err := db.QueryContext(ctx, query, args...)
+		if !failed(ctx, err) {
+			return rows, err
+		}
+		r.markDown(ctx, i, err)
+	}
+
+	return r.primary.QueryContext(ctx, query, args...)
+}
+
+func (r *ReplicaSet) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if i, db := r.pick(ctx); db != nil {
+		row := db.QueryRowContext(ctx, query, args...)
+		if !failed(ctx, row.Err()) {
+			return row
+		}
+		r.markDown(ctx, i, row.Err())
+	}
+
+	return r.primary.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext always runs on the primary, since replicas cannot be written to
+func (r *ReplicaSet) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.primary.ExecContext(ctx, query, args...)
+}
@@ -0,0 +1,156 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/food/internal/data"
+)
+
+// newMock returns a mocked database which expects pings to be checked as well as queries
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, mock
+}
+
+func countryRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "country_name", "created_at", "updated_at"}).
+		AddRow(1, "Japan", time.Now(), time.Now())
+}
+
+func TestReplicaSet(t *testing.T) {
+	ctx := context.Background()
+
+	primary, primaryMock := newMock(t)
+	replicaA, mockA := newMock(t)
+	replicaB, mockB := newMock(t)
+
+	models := data.NewPostgresWithReplicas(data.NewReplicaSet(primary, replicaA, replicaB))
+
+	// listings take turns on the replicas
+	mockA.ExpectQuery("from countries").WillReturnRows(countryRows())
+	mockB.ExpectQuery("from countries").WillReturnRows(countryRows())
+	for range 2 {
+		if _, err := models.Country.All(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// everything else runs on the primary
+	primaryMock.ExpectQuery("from users").WillReturnError(sql.ErrNoRows)
+	if _, err := models.User.GetOne(ctx, 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows from the primary, got %v", err)
+	}
+
+	for name, mock := range map[string]sqlmock.Sqlmock{"primary": primaryMock, "A": mockA, "B": mockB} {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestReplicaSet_Fallback(t *testing.T) {
+	ctx := context.Background()
+
+	primary, primaryMock := newMock(t)
+	replica, replicaMock := newMock(t)
+
+	set := data.NewReplicaSet(primary, replica)
+	models := data.NewPostgresWithReplicas(set)
+
+	// a failed replica is retried on the primary, then left alone
+	replicaMock.ExpectQuery("from countries").WillReturnError(errors.New("connection refused"))
+	primaryMock.ExpectQuery("from countries").WillReturnRows(countryRows())
+	primaryMock.ExpectQuery("from countries").WillReturnRows(countryRows())
+	for range 2 {
+		countries, err := models.Country.All(ctx)
+		if err != nil || len(countries) != 1 {
+			t.Fatalf("expected the primary to answer, got %v %v", countries, err)
+		}
+	}
+
+	// until it is found to be healthy again
+	replicaMock.ExpectPing()
+	if n := set.Check(ctx); n != 1 {
+		t.Errorf("expected 1 healthy replica, got %d", n)
+	}
+
+	replicaMock.ExpectQuery("from countries").WillReturnRows(countryRows())
+	if _, err := models.Country.All(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a replica which does not answer a ping is unhealthy
+	replicaMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	if n := set.Check(ctx); n != 0 {
+		t.Errorf("expected no healthy replicas, got %d", n)
+	}
+
+	primaryMock.ExpectQuery("from countries").WillReturnRows(countryRows())
+	if _, err := models.Country.All(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+}
+
+func TestReplicaSet_CachedFoods(t *testing.T) {
+	ctx := context.Background()
+
+	primary, primaryMock := newMock(t)
+	replica, replicaMock := newMock(t)
+
+	models := data.NewPostgresWithReplicas(data.NewReplicaSet(primary, replica))
+	foods := data.NewCachedFoods(models.Food, time.Minute, 10)
+
+	foodRows := func(description string) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "known_as", "country_id", "make_year", "slug", "description", "created_at", "updated_at", "version",
+			"id", "country_name", "created_at", "updated_at"}).
+			AddRow(3, "Ramen", 1, 1910, "ramen", description, time.Now(), time.Now(), 2, 1, "Japan", time.Now(), time.Now())
+	}
+	tasteRows := sqlmock.NewRows([]string{"id", "taste", "created_at", "updated_at"})
+
+	// the replica still has the food from before a change, which the cache must not be
+	// filled with. Nothing is expected of the replica, so a query on it fails, which marks it
+	// unhealthy and fails the read from it below.
+	primaryMock.ExpectQuery("from foods").WithArgs("ramen").WillReturnRows(foodRows("changed"))
+	primaryMock.ExpectQuery("from tastes").WillReturnRows(tasteRows)
+
+	food, err := foods.GetOneBySlug(ctx, "ramen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if food.Description != "changed" {
+		t.Errorf("expected the food from the primary, got %q", food.Description)
+	}
+
+	if err := primaryMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("primary: %v", err)
+	}
+	if err := replicaMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("replica: %v", err)
+	}
+
+	// without the cache, the same read goes to the replica
+	replicaMock.ExpectQuery("from foods").WithArgs("ramen").WillReturnRows(foodRows("old"))
+	replicaMock.ExpectQuery("from tastes").WillReturnRows(sqlmock.NewRows([]string{"id", "taste", "created_at", "updated_at"}))
+	if food, err := models.Food.GetOneBySlug(ctx, "ramen"); err != nil || food.Description != "old" {
+		t.Errorf("expected the replica's food, got %v %v", food, err)
+	}
+}
@@ -0,0 +1,38 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// ExpectedSchemaVersion is the version of the newest migration in the migrations directory.
+// It must be bumped whenever a migration is added.
+const ExpectedSchemaVersion = 7
+
+// Ping checks that the database db can be reached
+func Ping(ctx context.Context, db *sql.DB) error {
+	return db.PingContext(ctx)
+}
+
+// CheckSchemaVersion returns an error unless the migrations recorded in the database db, by
+// the migrate tool, are clean and at ExpectedSchemaVersion
+func CheckSchemaVersion(ctx context.Context, db *sql.DB) error {
+	var version int
+	var dirty bool
+
+	err := db.QueryRowContext(ctx, `select version, dirty from schema_migrations limit 1`).Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d failed and must be fixed by hand", version)
+	}
+
+	if version != ExpectedSchemaVersion {
+		return fmt.Errorf("schema is at version %d, expected %d", version, ExpectedSchemaVersion)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Seed is the data a new memory store starts with, for tests and demos. Countries and tastes
+// keep the IDs they are given, so that foods can refer to them; foods and users are numbered
+// from 1, in the order given.
+type Seed struct {
+	Countries []Country  `json:"countries"`
+	Tastes    []Taste    `json:"tastes"`
+	Foods     []Food     `json:"foods"`
+	Users     []SeedUser `json:"users"`
+}
+
+// SeedUser is one user in a Seed. Unlike User, it holds a plain text password, which is
+// hashed when the user is stored.
+type SeedUser struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password"`
+	Active    int    `json:"active"`
+}
+
+// LoadSeed reads a Seed from the JSON file at path
+func LoadSeed(path string) (Seed, error) {
+	var seed Seed
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return seed, err
+	}
+
+	if err := json.Unmarshal(b, &seed); err != nil {
+		return seed, fmt.Errorf("reading seed %s: %w", path, err)
+	}
+
+	return seed, nil
+}
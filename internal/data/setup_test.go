@@ -1,17 +1,22 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	slugify "github.com/mozillazg/go-slugify"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // IMPORTANT -- change the values below to ones that work for your system. The only value you should have to
@@ -56,7 +61,9 @@ func TestMain(m *testing.M) {
 
 	resource, err = pool.RunWithOptions(&opts)
 	if err != nil {
-		log.Fatalf("could not start resource: %s", err)
+		// the tests which need no database, such as those for the memory backend, still run
+		log.Printf("skipping the tests which need Postgres: could not start resource: %s", err)
+		os.Exit(m.Run())
 	}
 
 	if err := pool.Retry(func() error {
@@ -73,7 +80,7 @@ func TestMain(m *testing.M) {
 	}
 
 	// get our models
-	models = New(testDB)
+	models = NewPostgres(testDB)
 
 	err = createTables(testDB)
 	if err != nil {
@@ -265,6 +272,146 @@ ALTER TABLE public.users ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
     NO MAXVALUE
     CACHE 1
 );
+
+
+--
+-- Name: user_identities; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.user_identities (
+    id integer NOT NULL,
+    user_id integer NOT NULL,
+    issuer character varying(512) NOT NULL,
+    subject character varying(255) NOT NULL,
+    email character varying(255),
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    UNIQUE (issuer, subject)
+);
+
+
+--
+-- Name: user_identities_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+ALTER TABLE public.user_identities ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.user_identities_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+
+--
+-- Name: email_verifications; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.email_verifications (
+    id integer NOT NULL,
+    user_id integer NOT NULL,
+    email character varying(255) NOT NULL,
+    token_hash bytea NOT NULL,
+    expiry timestamp with time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+--
+-- Name: email_verifications_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+ALTER TABLE public.email_verifications ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.email_verifications_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+
+--
+-- Name: audit_events; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.audit_events (
+    id integer NOT NULL,
+    actor_id integer,
+    action character varying(64) NOT NULL,
+    entity_type character varying(64) NOT NULL,
+    entity_id integer NOT NULL,
+    before jsonb,
+    after jsonb,
+    ip character varying(64) NOT NULL,
+    request_id character varying(255) NOT NULL,
+    created_at timestamp without time zone NOT NULL
+);
+
+
+--
+-- Name: audit_events_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+ALTER TABLE public.audit_events ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY (
+    SEQUENCE NAME public.audit_events_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1
+);
+
+CREATE INDEX audit_events_entity_idx ON public.audit_events (entity_type, entity_id);
+CREATE INDEX audit_events_actor_idx ON public.audit_events (actor_id);
+CREATE INDEX audit_events_created_at_idx ON public.audit_events (created_at);
+
+
+--
+-- audit_events is append-only: refuse any attempt to change or remove an event
+--
+
+CREATE FUNCTION public.audit_events_append_only() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON public.audit_events
+    FOR EACH ROW EXECUTE FUNCTION public.audit_events_append_only();
+
+
+--
+-- Users log in by email, and foods are looked up by slug, so both must be unique
+--
+
+ALTER TABLE public.users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE public.foods ADD CONSTRAINT foods_slug_key UNIQUE (slug);
+ALTER TABLE public.foods ADD COLUMN version integer NOT NULL DEFAULT 1;
+ALTER TABLE public.users ADD COLUMN version integer NOT NULL DEFAULT 1;
+
+
+--
+-- Name: idempotency_keys; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE public.idempotency_keys (
+    scope character varying(255) NOT NULL,
+    idempotency_key character varying(255) NOT NULL,
+    request_hash bytea NOT NULL,
+    response_status integer NOT NULL DEFAULT 0,
+    response_header jsonb,
+    response_body bytea,
+    expiry timestamp with time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expiry_idx ON public.idempotency_keys (expiry);
 `
 
 	_, err := db.Exec(stmt)
@@ -325,3 +472,133 @@ func insertData(db *sql.DB) error {
 
 	return nil
 }
+
+// requirePostgres skips the test when there is no Postgres to run it against
+func requirePostgres(t *testing.T) {
+	t.Helper()
+	if testDB == nil {
+		t.Skip("Postgres is not available")
+	}
+}
+
+// conformanceTemplate is an empty database with our schema, which each database made by
+// newSeededPostgres is copied from
+const conformanceTemplate = "conformance_template"
+
+var (
+	conformanceOnce sync.Once
+	conformanceErr  error
+	conformanceDBs  int
+)
+
+// newSeededPostgres returns Models backed by a new database holding only seed. The database
+// is dropped when the test ends.
+func newSeededPostgres(t *testing.T, seed Seed) Models {
+	t.Helper()
+	requirePostgres(t)
+
+	conformanceOnce.Do(func() {
+		conformanceErr = createConformanceTemplate()
+	})
+	if conformanceErr != nil {
+		t.Fatalf("could not create the template database: %v", conformanceErr)
+	}
+
+	conformanceDBs++
+	name := fmt.Sprintf("conformance_%d", conformanceDBs)
+
+	if _, err := testDB.Exec(fmt.Sprintf("create database %s template %s", name, conformanceTemplate)); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("pgx", fmt.Sprintf(dsn, host, port, user, password, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if _, err := testDB.Exec("drop database " + name); err != nil {
+			t.Errorf("could not drop %s: %v", name, err)
+		}
+	})
+
+	if err := insertSeed(db, seed); err != nil {
+		t.Fatalf("could not insert seed: %v", err)
+	}
+
+	return NewPostgres(db)
+}
+
+// createConformanceTemplate creates the template database for newSeededPostgres. Postgres
+// only copies a database nobody is connected to, so the connection is closed when done.
+func createConformanceTemplate() error {
+	if _, err := testDB.Exec("create database " + conformanceTemplate); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("pgx", fmt.Sprintf(dsn, host, port, user, password, conformanceTemplate))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return createTables(db)
+}
+
+// insertSeed inserts seed into db, in the same way NewMemory stores it
+func insertSeed(db *sql.DB, seed Seed) error {
+	now := time.Now()
+
+	for _, c := range seed.Countries {
+		_, err := db.Exec(`insert into countries (id, country_name, created_at, updated_at)
+			overriding system value values ($1, $2, $3, $3)`, c.ID, c.CountryName, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, taste := range seed.Tastes {
+		_, err := db.Exec(`insert into tastes (id, taste, created_at, updated_at)
+			overriding system value values ($1, $2, $3, $3)`, taste.ID, taste.Taste, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	// later rows are numbered after the seeded IDs
+	for _, table := range []string{"countries", "tastes"} {
+		_, err := db.Exec(fmt.Sprintf(`select setval('%[1]s_id_seq', coalesce((select max(id) from %[1]s), 0) + 1, false)`, table))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range seed.Foods {
+		var id int
+		err := db.QueryRow(`insert into foods (known_as, country_id, make_year, slug, description, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6) returning id`,
+			f.KnownAs, f.CountryID, f.MakeYear, slugify.Slugify(f.KnownAs), f.Description, now).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		if err := replaceTastes(context.Background(), db, id, f.TasteIDs); err != nil {
+			return err
+		}
+	}
+
+	for _, u := range seed.Users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.MinCost)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6)`, u.Email, u.FirstName, u.LastName, hash, u.Active, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
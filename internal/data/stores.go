@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ErrDuplicate is returned by every store when a change would give two records the same
+// value for a field which must be unique, such as a user's email address or a food's slug
+var ErrDuplicate = errors.New("duplicate value violates unique constraint")
+
+// ErrForeignKey is returned by every store when a change refers to a record which does not
+// exist, where the database enforces it
+var ErrForeignKey = errors.New("foreign key violation")
+
+// ErrEditConflict is returned by every store when an update is based on an out of date
+// version of a record: someone else has changed it since it was read
+var ErrEditConflict = errors.New("edit conflict")
+
+// Models is the type for this package. Each member is the store for one kind of model,
+// and is available to us throughout the application, anywhere that the app variable is
+// used. The members are interfaces, so that a handler can be tested against a fake store,
+// and the application can be run on something other than Postgres.
+//
+// Every implementation behaves the same way: lists come back in the same order, a missing
+// record is reported as sql.ErrNoRows, as database/sql does, a duplicate as ErrDuplicate,
+// and an update to a record which has changed since it was read as ErrEditConflict. Foods
+// and users carry a Version, which every update increments.
+// The conformance tests in the storetest package check this.
+type Models struct {
+	User     UserStore
+	Token    TokenStore
+	Food     FoodStore
+	Country  CountryStore
+	Taste    TasteStore
+	Identity IdentityStore
+	Audit    AuditStore
+
+	EmailVerification EmailVerificationStore
+	Idempotency       IdempotencyStore
+}
+
+// Option changes how the SQL implementations of the stores behave. Each Models has its own,
+// so two in one process, such as in parallel tests, may behave differently.
+type Option func(*settings)
+
+// settings are what the Options change
+type settings struct {
+	// timeout is the longest any one call into a store may take. Every method takes the
+	// caller's context, usually the request's, so the call also ends early if the caller
+	// cancels or has a shorter deadline; timeout is only a ceiling.
+	timeout time.Duration
+
+	// logger is where the stores log problems which they do not return to the caller
+	logger *slog.Logger
+}
+
+// WithQueryTimeout changes the longest any one query may take, which is 3 seconds unless
+// changed
+func WithQueryTimeout(d time.Duration) Option {
+	return func(s *settings) {
+		s.timeout = d
+	}
+}
+
+// WithLogger sets where the stores log problems which they do not return to the caller.
+// Nothing is logged unless it is set.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *settings) {
+		s.logger = l
+	}
+}
+
+func newSettings(opts []Option) settings {
+	s := settings{
+		timeout: time.Second * 3,
+		logger:  slog.New(slog.DiscardHandler),
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	return s
+}
+
+// NewPostgres returns Models backed by the Postgres database db. Every store uses db, so
+// two Models may be backed by two different databases.
+func NewPostgres(db *sql.DB, opts ...Option) Models {
+	return NewSQL(db, postgresError, opts...)
+}
+
+// NewPostgresWithReplicas returns Models backed by the Postgres databases in replicas.
+// Listings, such as Food.GetAll, Food.GetOneBySlug, Country.All, User.GetAll and
+// Audit.GetAll, are read from the replicas; everything else, including the lookups used to
+// authenticate a request and the reads which fill a CachedFoods, runs on the primary, so
+// that a user can see their own changes. The options apply to replicas too, which should
+// not be shared with other Models.
+func NewPostgresWithReplicas(replicas *ReplicaSet, opts ...Option) Models {
+	replicas.settings = newSettings(opts)
+	return newSQL(sqlDB{db: replicas.primary, read: replicas, translate: postgresError, settings: replicas.settings})
+}
+
+// NewSQL returns Models backed by db, which may be any database that understands the SQL we
+// use, and has our schema. translate turns the database's errors into the errors every store
+// returns, such as ErrDuplicate, and returns any other error unchanged.
+func NewSQL(db *sql.DB, translate func(error) error, opts ...Option) Models {
+	return newSQL(sqlDB{db: db, read: db, translate: translate, settings: newSettings(opts)})
+}
+
+func newSQL(s sqlDB) Models {
+	return Models{
+		User:     &sqlUsers{s},
+		Token:    &sqlTokens{s},
+		Food:     &sqlFoods{s},
+		Country:  &sqlCountries{s},
+		Taste:    &sqlTastes{s},
+		Identity: &sqlIdentities{s},
+		Audit:    &sqlAudit{s},
+
+		EmailVerification: &sqlEmailVerifications{s},
+		Idempotency:       &sqlIdempotency{s},
+	}
+}
+
+// UserStore stores users. Changes are recorded in the audit log, as made by actor.
+type UserStore interface {
+	GetAll(ctx context.Context) ([]*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetOne(ctx context.Context, id int) (*User, error)
+	Insert(ctx context.Context, user User, actor Actor) (int, error)
+	Update(ctx context.Context, user User, actor Actor) error
+	DeleteByID(ctx context.Context, id int, actor Actor) error
+	ResetPassword(ctx context.Context, id int, password string, actor Actor) error
+}
+
+// TokenStore stores the tokens issued to users when they log in
+type TokenStore interface {
+	GetByToken(ctx context.Context, plainText string) (*Token, error)
+	GetUserForToken(ctx context.Context, token Token) (*User, error)
+	Insert(ctx context.Context, token Token, u User) error
+	DeleteByToken(ctx context.Context, plainText string) error
+	DeleteTokensForUser(ctx context.Context, id int) error
+	DeleteOtherTokensForUser(ctx context.Context, id int, keep string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// FoodStore stores foods, along with their tastes. Changes are recorded in the audit log,
+// as made by actor.
+type FoodStore interface {
+	GetAll(ctx context.Context) ([]*Food, error)
+	GetAllPaginated(ctx context.Context, page, pageSize int) ([]*Food, error)
+	GetOneById(ctx context.Context, foodID int) (*Food, error)
+	GetOneBySlug(ctx context.Context, slug string) (*Food, error)
+	Search(ctx context.Context, filter FoodFilter) ([]*Food, error)
+	Insert(ctx context.Context, food Food, actor Actor) (int, error)
+	Update(ctx context.Context, food Food, actor Actor) error
+	DeleteByID(ctx context.Context, foodID int, actor Actor) error
+}
+
+// CountryStore lists the countries a food may come from
+type CountryStore interface {
+	All(ctx context.Context) ([]*Country, error)
+}
+
+// TasteStore lists the tastes a food may have, and the tastes of many foods at once
+type TasteStore interface {
+	All(ctx context.Context) ([]*Taste, error)
+	ForFoods(ctx context.Context, foodIDs []int) (map[int][]Taste, error)
+}
+
+// IdentityStore stores the links between users and external identity providers
+type IdentityStore interface {
+	GetUser(ctx context.Context, issuer, subject string) (*User, error)
+	Insert(ctx context.Context, identity Identity) error
+}
+
+// AuditStore reads the audit log, which the other stores write to
+type AuditStore interface {
+	GetAll(ctx context.Context, filter AuditFilter, page, pageSize int) ([]*AuditEvent, int, error)
+}
+
+// EmailVerificationStore stores pending changes of email address
+type EmailVerificationStore interface {
+	Insert(ctx context.Context, verification EmailVerification) error
+	GetByToken(ctx context.Context, plainText string) (*EmailVerification, error)
+	DeleteForUser(ctx context.Context, userID int) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// IdempotencyStore stores the requests made with an Idempotency-Key, and their responses
+type IdempotencyStore interface {
+	Start(ctx context.Context, req IdempotentRequest) error
+	Get(ctx context.Context, scope, key string) (*IdempotentRequest, error)
+	Finish(ctx context.Context, req IdempotentRequest) error
+	Delete(ctx context.Context, scope, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// sqlDB is the database the SQL implementations of the stores run queries on, where read
+// only listings are run, the function which translates its errors, and their settings
+type sqlDB struct {
+	db        *sql.DB
+	read      dbtx
+	translate func(error) error
+	settings
+}
+
+// The SQL implementations of the stores
+type (
+	sqlUsers              struct{ sqlDB }
+	sqlTokens             struct{ sqlDB }
+	sqlFoods              struct{ sqlDB }
+	sqlCountries          struct{ sqlDB }
+	sqlTastes             struct{ sqlDB }
+	sqlIdentities         struct{ sqlDB }
+	sqlAudit              struct{ sqlDB }
+	sqlEmailVerifications struct{ sqlDB }
+	sqlIdempotency        struct{ sqlDB }
+)
+
+// checkVersion returns ErrEditConflict if an update, made on condition that the record was
+// at the version read earlier in the same transaction, changed nothing: another transaction
+// has changed the record in the meantime
+func checkVersion(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// postgresError translates the errors from Postgres which every store reports the same way,
+// whatever it is backed by. Other errors are returned unchanged.
+func postgresError(err error) error {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		switch pgErr.SQLState() {
+		case "23505":
+			return fmt.Errorf("%w: %v", ErrDuplicate, err)
+		case "23503":
+			return fmt.Errorf("%w: %v", ErrForeignKey, err)
+		}
+	}
+
+	return err
+}
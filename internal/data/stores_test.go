@@ -0,0 +1,43 @@
+package data_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+func TestOptions(t *testing.T) {
+	ctx := context.Background()
+
+	// two Models in one process keep their own settings
+	dbA, mockA := newMock(t)
+	var logA bytes.Buffer
+	a := data.NewPostgres(dbA, data.WithQueryTimeout(10*time.Millisecond), data.WithLogger(slog.New(slog.NewTextHandler(&logA, nil))))
+
+	dbB, mockB := newMock(t)
+	b := data.NewPostgres(dbB)
+
+	mockA.ExpectQuery("from countries").WillDelayFor(100 * time.Millisecond).WillReturnRows(countryRows())
+	mockB.ExpectQuery("from countries").WillDelayFor(100 * time.Millisecond).WillReturnRows(countryRows())
+
+	if _, err := a.Country.All(ctx); err == nil {
+		t.Error("a query took longer than the timeout of its Models")
+	}
+	if _, err := b.Country.All(ctx); err != nil {
+		t.Errorf("a query was cut short by the timeout of other Models: %v", err)
+	}
+
+	mockA.ExpectQuery("from tokens").WillReturnError(errors.New("connection refused"))
+	if _, err := a.Token.GetByToken(ctx, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"); err == nil {
+		t.Fatal("GetByToken did not return the error")
+	}
+	if !strings.Contains(logA.String(), "could not look up token") {
+		t.Errorf("the error was not logged to the logger of its Models: %q", logA.String())
+	}
+}
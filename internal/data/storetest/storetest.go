@@ -0,0 +1,742 @@
+// Package storetest is a conformance suite for implementations of the stores in the data
+// package. Every backend runs it, so that the application behaves the same way whichever
+// backend it is using.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+)
+
+// Seed is the data every test starts with. Foods are numbered 1 to 3, and users 1 to 3, in
+// the order they appear here.
+var Seed = data.Seed{
+	Countries: []data.Country{
+		{ID: 1, CountryName: "Japan"},
+		{ID: 2, CountryName: "Italy"},
+		{ID: 3, CountryName: "Mexico"},
+	},
+	Tastes: []data.Taste{
+		{ID: 1, Taste: "umami"},
+		{ID: 2, Taste: "sweet"},
+		{ID: 3, Taste: "sour"},
+		{ID: 4, Taste: "salty"},
+		{ID: 5, Taste: "spicy"},
+	},
+	Foods: []data.Food{
+		{KnownAs: "Tacos", CountryID: 3, MakeYear: 1900, Description: "Folded tortillas", TasteIDs: []int{5, 4}},
+		{KnownAs: "Pizza", CountryID: 2, MakeYear: 1889, Description: "Flat bread with toppings", TasteIDs: []int{4, 1}},
+		{KnownAs: "Ramen", CountryID: 1, MakeYear: 1910, Description: "Noodles in broth", TasteIDs: []int{1}},
+	},
+	Users: []data.SeedUser{
+		{Email: "alice@example.com", FirstName: "Alice", LastName: "Smith", Password: "alice-password", Active: 1},
+		{Email: "bob@example.com", FirstName: "Bob", LastName: "Jones", Password: "bob-password", Active: 1},
+		{Email: "carol@example.com", FirstName: "Carol", LastName: "Brown", Password: "carol-password", Active: 0},
+	},
+}
+
+// actor is who makes the changes in the tests
+var actor = data.Actor{UserID: 1, IP: "127.0.0.1", RequestID: "storetest"}
+
+// Run runs the suite. Every test calls open once, for Models holding the given seed and
+// nothing else.
+func Run(t *testing.T, open func(t *testing.T, seed data.Seed) data.Models) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, m data.Models)
+	}{
+		{"Countries", testCountries},
+		{"Users/Get", testUsersGet},
+		{"Users/Insert", testUsersInsert},
+		{"Users/Update", testUsersUpdate},
+		{"Users/Delete", testUsersDelete},
+		{"Users/ResetPassword", testUsersResetPassword},
+		{"Tokens", testTokens},
+		{"Foods/Get", testFoodsGet},
+		{"Foods/Search", testFoodsSearch},
+		{"Tastes", testTastes},
+		{"Foods/Insert", testFoodsInsert},
+		{"Foods/Update", testFoodsUpdate},
+		{"Foods/Delete", testFoodsDelete},
+		{"Identities", testIdentities},
+		{"EmailVerifications", testEmailVerifications},
+		{"Idempotency", testIdempotency},
+		{"Audit", testAudit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t, Seed))
+		})
+	}
+}
+
+// must fails the test if err is not nil
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantErr fails the test unless err is target
+func wantErr(t *testing.T, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("expected %v, got %v", target, err)
+	}
+}
+
+func testCountries(t *testing.T, m data.Models) {
+	countries, err := m.Country.All(context.Background())
+	must(t, err)
+
+	var names []string
+	for _, c := range countries {
+		names = append(names, c.CountryName)
+	}
+
+	if want := []string{"Italy", "Japan", "Mexico"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected countries %v, got %v", want, names)
+	}
+}
+
+func testUsersGet(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	users, err := m.User.GetAll(ctx)
+	must(t, err)
+
+	var names []string
+	for _, u := range users {
+		names = append(names, u.LastName)
+		if u.Password != "" {
+			t.Errorf("GetAll returned the password hash of %s", u.Email)
+		}
+	}
+	if want := []string{"Brown", "Jones", "Smith"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected users ordered by last name %v, got %v", want, names)
+	}
+
+	u, err := m.User.GetByEmail(ctx, "bob@example.com")
+	must(t, err)
+	if u.ID != 2 || u.FirstName != "Bob" || u.Active != 1 {
+		t.Errorf("GetByEmail returned the wrong user: %+v", u)
+	}
+	if ok, _ := u.PasswordMatches("bob-password"); !ok {
+		t.Error("the seed password does not match")
+	}
+
+	u, err = m.User.GetOne(ctx, 3)
+	must(t, err)
+	if u.Email != "carol@example.com" || u.Active != 0 {
+		t.Errorf("GetOne returned the wrong user: %+v", u)
+	}
+
+	_, err = m.User.GetByEmail(ctx, "nobody@example.com")
+	wantErr(t, err, sql.ErrNoRows)
+
+	_, err = m.User.GetOne(ctx, 99)
+	wantErr(t, err, sql.ErrNoRows)
+}
+
+func testUsersInsert(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	id, err := m.User.Insert(ctx, data.User{
+		Email: "dave@example.com", FirstName: "Dave", LastName: "Adams", Password: "dave-password", Active: 1,
+	}, actor)
+	must(t, err)
+	if id != 4 {
+		t.Errorf("expected the new user to have ID 4, got %d", id)
+	}
+
+	u, err := m.User.GetOne(ctx, id)
+	must(t, err)
+	if u.Email != "dave@example.com" || u.LastName != "Adams" || u.CreatedAt.IsZero() {
+		t.Errorf("the new user was not stored: %+v", u)
+	}
+	if ok, _ := u.PasswordMatches("dave-password"); !ok {
+		t.Error("the new user's password does not match")
+	}
+
+	_, err = m.User.Insert(ctx, data.User{Email: "alice@example.com", FirstName: "A", LastName: "B", Password: "x"}, actor)
+	wantErr(t, err, data.ErrDuplicate)
+}
+
+func testUsersUpdate(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	u, err := m.User.GetOne(ctx, 1)
+	must(t, err)
+
+	u.FirstName = "Alicia"
+	u.Active = 0
+	must(t, m.User.Update(ctx, *u, actor))
+
+	u, err = m.User.GetOne(ctx, 1)
+	must(t, err)
+	if u.FirstName != "Alicia" || u.Active != 0 {
+		t.Errorf("the user was not updated: %+v", u)
+	}
+	if ok, _ := u.PasswordMatches("alice-password"); !ok {
+		t.Error("updating the user changed their password")
+	}
+	if u.Version != 2 {
+		t.Errorf("expected the update to take the user to version 2, got %d", u.Version)
+	}
+
+	// an update based on an earlier version is refused, and changes nothing
+	stale := *u
+	stale.Version = 1
+	stale.FirstName = "Al"
+	wantErr(t, m.User.Update(ctx, stale, actor), data.ErrEditConflict)
+	if u, _ := m.User.GetOne(ctx, 1); u.FirstName != "Alicia" {
+		t.Errorf("a conflicting update changed the user: %+v", u)
+	}
+
+	u.Email = "bob@example.com"
+	wantErr(t, m.User.Update(ctx, *u, actor), data.ErrDuplicate)
+
+	wantErr(t, m.User.Update(ctx, data.User{ID: 99, Email: "x@example.com"}, actor), sql.ErrNoRows)
+}
+
+func testUsersDelete(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	must(t, m.User.DeleteByID(ctx, 2, actor))
+
+	_, err := m.User.GetOne(ctx, 2)
+	wantErr(t, err, sql.ErrNoRows)
+
+	users, err := m.User.GetAll(ctx)
+	must(t, err)
+	if len(users) != 2 {
+		t.Errorf("expected 2 users left, got %d", len(users))
+	}
+
+	wantErr(t, m.User.DeleteByID(ctx, 2, actor), sql.ErrNoRows)
+}
+
+func testUsersResetPassword(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	must(t, m.User.ResetPassword(ctx, 1, "new-password", actor))
+
+	u, err := m.User.GetOne(ctx, 1)
+	must(t, err)
+	if ok, _ := u.PasswordMatches("new-password"); !ok {
+		t.Error("the new password does not match")
+	}
+	if ok, _ := u.PasswordMatches("alice-password"); ok {
+		t.Error("the old password still matches")
+	}
+
+	wantErr(t, m.User.ResetPassword(ctx, 99, "new-password", actor), sql.ErrNoRows)
+}
+
+func testTokens(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	alice, err := m.User.GetOne(ctx, 1)
+	must(t, err)
+	carol, err := m.User.GetOne(ctx, 3)
+	must(t, err)
+
+	first, err := data.GenerateToken(alice.ID, time.Hour)
+	must(t, err)
+	must(t, m.Token.Insert(ctx, *first, *alice))
+
+	// a user has one token at a time
+	second, err := data.GenerateToken(alice.ID, time.Hour)
+	must(t, err)
+	must(t, m.Token.Insert(ctx, *second, *alice))
+
+	_, err = m.Token.GetByToken(ctx, first.Token)
+	wantErr(t, err, sql.ErrNoRows)
+
+	token, err := m.Token.GetByToken(ctx, second.Token)
+	must(t, err)
+	if token.UserID != alice.ID || token.Email != alice.Email {
+		t.Errorf("GetByToken returned the wrong token: %+v", token)
+	}
+
+	u, err := m.Token.GetUserForToken(ctx, *token)
+	must(t, err)
+	if u.ID != alice.ID {
+		t.Errorf("GetUserForToken returned the wrong user: %+v", u)
+	}
+
+	users, err := m.User.GetAll(ctx)
+	must(t, err)
+	for _, u := range users {
+		if u.HasToken != (u.ID == alice.ID) {
+			t.Errorf("user %s has has_token %v", u.Email, u.HasToken)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+second.Token)
+	u, err = data.AuthenticateToken(req, m.Token)
+	must(t, err)
+	if u.ID != alice.ID {
+		t.Errorf("AuthenticateToken returned the wrong user: %+v", u)
+	}
+
+	// inactive users cannot authenticate
+	carolsToken, err := data.GenerateToken(carol.ID, time.Hour)
+	must(t, err)
+	must(t, m.Token.Insert(ctx, *carolsToken, *carol))
+	req.Header.Set("Authorization", "Bearer "+carolsToken.Token)
+	if _, err := data.AuthenticateToken(req, m.Token); err == nil {
+		t.Error("an inactive user was authenticated")
+	}
+
+	must(t, m.Token.DeleteOtherTokensForUser(ctx, alice.ID, second.Token))
+	if valid, _ := data.ValidToken(ctx, m.Token, second.Token); !valid {
+		t.Error("DeleteOtherTokensForUser deleted the token it should keep")
+	}
+
+	must(t, m.Token.DeleteByToken(ctx, second.Token))
+	if valid, _ := data.ValidToken(ctx, m.Token, second.Token); valid {
+		t.Error("the token is still valid after it was deleted")
+	}
+
+	must(t, m.Token.DeleteTokensForUser(ctx, carol.ID))
+	_, err = m.Token.GetByToken(ctx, carolsToken.Token)
+	wantErr(t, err, sql.ErrNoRows)
+
+	expired, err := data.GenerateToken(alice.ID, -time.Hour)
+	must(t, err)
+	must(t, m.Token.Insert(ctx, *expired, *alice))
+
+	n, err := m.Token.DeleteExpired(ctx)
+	must(t, err)
+	if n != 1 {
+		t.Errorf("expected DeleteExpired to delete 1 token, got %d", n)
+	}
+}
+
+func testFoodsGet(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	foods, err := m.Food.GetAll(ctx)
+	must(t, err)
+
+	var names []string
+	for _, f := range foods {
+		names = append(names, f.KnownAs)
+	}
+	if want := []string{"Pizza", "Ramen", "Tacos"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected foods ordered by name %v, got %v", want, names)
+	}
+
+	pizza := foods[0]
+	if pizza.ID != 2 || pizza.Slug != "pizza" || pizza.Country.CountryName != "Italy" || pizza.MakeYear != 1889 {
+		t.Errorf("GetAll returned the wrong food: %+v", pizza)
+	}
+
+	// tastes are ordered by name
+	var tastes []string
+	for _, taste := range pizza.Tastes {
+		tastes = append(tastes, taste.Taste)
+	}
+	if want := []string{"salty", "umami"}; !reflect.DeepEqual(tastes, want) || !reflect.DeepEqual(pizza.TasteIDs, []int{4, 1}) {
+		t.Errorf("expected tastes %v, got %v with IDs %v", want, tastes, pizza.TasteIDs)
+	}
+
+	page, err := m.Food.GetAllPaginated(ctx, 2, 2)
+	must(t, err)
+	if len(page) != 1 || page[0].KnownAs != "Tacos" {
+		t.Errorf("expected Tacos alone on the second page, got %d foods", len(page))
+	}
+
+	page, err = m.Food.GetAllPaginated(ctx, 3, 2)
+	must(t, err)
+	if len(page) != 0 {
+		t.Errorf("expected no foods past the last page, got %d", len(page))
+	}
+
+	f, err := m.Food.GetOneById(ctx, 1)
+	must(t, err)
+	if f.KnownAs != "Tacos" || f.Country.CountryName != "Mexico" || len(f.Tastes) != 2 {
+		t.Errorf("GetOneById returned the wrong food: %+v", f)
+	}
+
+	f, err = m.Food.GetOneBySlug(ctx, "ramen")
+	must(t, err)
+	if f.ID != 3 || f.Description != "Noodles in broth" {
+		t.Errorf("GetOneBySlug returned the wrong food: %+v", f)
+	}
+
+	_, err = m.Food.GetOneById(ctx, 99)
+	wantErr(t, err, sql.ErrNoRows)
+
+	_, err = m.Food.GetOneBySlug(ctx, "sushi")
+	wantErr(t, err, sql.ErrNoRows)
+}
+
+func testFoodsSearch(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	names := func(filter data.FoodFilter) []string {
+		t.Helper()
+
+		foods, err := m.Food.Search(ctx, filter)
+		must(t, err)
+
+		var names []string
+		for _, f := range foods {
+			if len(f.Tastes) != 0 || len(f.TasteIDs) != 0 {
+				t.Errorf("Search returned the tastes of %s", f.KnownAs)
+			}
+			names = append(names, f.KnownAs)
+		}
+		return names
+	}
+
+	tests := []struct {
+		filter data.FoodFilter
+		want   []string
+	}{
+		{data.FoodFilter{}, []string{"Pizza", "Ramen", "Tacos"}},
+		{data.FoodFilter{CountryID: 2}, []string{"Pizza"}},
+		{data.FoodFilter{TasteID: 4}, []string{"Pizza", "Tacos"}},
+		{data.FoodFilter{TasteID: 4, CountryID: 3}, []string{"Tacos"}},
+		{data.FoodFilter{Search: "AM"}, []string{"Ramen"}},
+		{data.FoodFilter{Search: "%"}, nil},
+		{data.FoodFilter{TasteID: 2}, nil},
+	}
+
+	for _, tt := range tests {
+		if got := names(tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: expected %v, got %v", tt.filter, tt.want, got)
+		}
+	}
+
+	foods, err := m.Food.Search(ctx, data.FoodFilter{CountryID: 1})
+	must(t, err)
+	if len(foods) != 1 || foods[0].Country.CountryName != "Japan" || foods[0].Slug != "ramen" || foods[0].Version != 1 {
+		t.Errorf("Search returned the wrong food: %+v", foods)
+	}
+}
+
+func testTastes(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	all, err := m.Taste.All(ctx)
+	must(t, err)
+
+	var names []string
+	for _, taste := range all {
+		names = append(names, taste.Taste)
+	}
+	if want := []string{"salty", "sour", "spicy", "sweet", "umami"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected tastes %v, got %v", want, names)
+	}
+
+	tastes, err := m.Taste.ForFoods(ctx, []int{1, 2, 99})
+	must(t, err)
+
+	ids := map[int][]int{}
+	for foodID, list := range tastes {
+		for _, taste := range list {
+			ids[foodID] = append(ids[foodID], taste.ID)
+		}
+	}
+	if want := map[int][]int{1: {4, 5}, 2: {4, 1}}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("expected tastes by food %v, got %v", want, ids)
+	}
+
+	tastes, err = m.Taste.ForFoods(ctx, nil)
+	must(t, err)
+	if len(tastes) != 0 {
+		t.Errorf("expected no tastes for no foods, got %v", tastes)
+	}
+}
+
+func testFoodsInsert(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	id, err := m.Food.Insert(ctx, data.Food{
+		KnownAs: "Miso Soup", CountryID: 1, MakeYear: 1200, Description: "Soup", TasteIDs: []int{4, 1},
+	}, actor)
+	must(t, err)
+	if id != 4 {
+		t.Errorf("expected the new food to have ID 4, got %d", id)
+	}
+
+	f, err := m.Food.GetOneBySlug(ctx, "miso-soup")
+	must(t, err)
+	if f.ID != id || f.Country.CountryName != "Japan" || !reflect.DeepEqual(f.TasteIDs, []int{4, 1}) {
+		t.Errorf("the new food was not stored: %+v", f)
+	}
+
+	_, err = m.Food.Insert(ctx, data.Food{KnownAs: "Pizza", CountryID: 2}, actor)
+	wantErr(t, err, data.ErrDuplicate)
+}
+
+func testFoodsUpdate(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	f, err := m.Food.GetOneById(ctx, 1)
+	must(t, err)
+
+	f.KnownAs = "Fish Tacos"
+	f.TasteIDs = []int{3}
+	must(t, m.Food.Update(ctx, *f, actor))
+
+	f, err = m.Food.GetOneById(ctx, 1)
+	must(t, err)
+	if f.Slug != "fish-tacos" || !reflect.DeepEqual(f.TasteIDs, []int{3}) {
+		t.Errorf("the food was not updated: %+v", f)
+	}
+
+	// without taste IDs, the tastes are left alone
+	f.Description = "Tacos with fish"
+	f.TasteIDs = nil
+	must(t, m.Food.Update(ctx, *f, actor))
+
+	f, err = m.Food.GetOneById(ctx, 1)
+	must(t, err)
+	if f.Description != "Tacos with fish" || !reflect.DeepEqual(f.TasteIDs, []int{3}) {
+		t.Errorf("the food was not updated: %+v", f)
+	}
+	if f.Version != 3 {
+		t.Errorf("expected two updates to take the food to version 3, got %d", f.Version)
+	}
+
+	// empty taste IDs remove every taste
+	f.TasteIDs = []int{}
+	must(t, m.Food.Update(ctx, *f, actor))
+
+	f, err = m.Food.GetOneById(ctx, 1)
+	must(t, err)
+	if len(f.TasteIDs) != 0 || len(f.Tastes) != 0 {
+		t.Errorf("the tastes were not removed: %+v", f)
+	}
+	f.TasteIDs = []int{3}
+	must(t, m.Food.Update(ctx, *f, actor))
+	f, err = m.Food.GetOneById(ctx, 1)
+	must(t, err)
+
+	// an update based on an earlier version is refused, and changes nothing
+	stale := *f
+	stale.Version = 2
+	stale.TasteIDs = []int{1}
+	wantErr(t, m.Food.Update(ctx, stale, actor), data.ErrEditConflict)
+	if f, _ := m.Food.GetOneById(ctx, 1); !reflect.DeepEqual(f.TasteIDs, []int{3}) {
+		t.Errorf("a conflicting update changed the food: %+v", f)
+	}
+
+	f.KnownAs = "Pizza"
+	wantErr(t, m.Food.Update(ctx, *f, actor), data.ErrDuplicate)
+
+	wantErr(t, m.Food.Update(ctx, data.Food{ID: 99, KnownAs: "Sushi"}, actor), sql.ErrNoRows)
+}
+
+func testFoodsDelete(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	must(t, m.Food.DeleteByID(ctx, 2, actor))
+
+	_, err := m.Food.GetOneById(ctx, 2)
+	wantErr(t, err, sql.ErrNoRows)
+
+	foods, err := m.Food.GetAll(ctx)
+	must(t, err)
+	if len(foods) != 2 {
+		t.Errorf("expected 2 foods left, got %d", len(foods))
+	}
+
+	wantErr(t, m.Food.DeleteByID(ctx, 2, actor), sql.ErrNoRows)
+}
+
+func testIdentities(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	identity := data.Identity{UserID: 2, Issuer: "https://idp.example.com", Subject: "bob", Email: "bob@example.com"}
+	must(t, m.Identity.Insert(ctx, identity))
+
+	u, err := m.Identity.GetUser(ctx, identity.Issuer, identity.Subject)
+	must(t, err)
+	if u.ID != 2 {
+		t.Errorf("GetUser returned the wrong user: %+v", u)
+	}
+
+	_, err = m.Identity.GetUser(ctx, identity.Issuer, "alice")
+	wantErr(t, err, sql.ErrNoRows)
+
+	identity.UserID = 1
+	wantErr(t, m.Identity.Insert(ctx, identity), data.ErrDuplicate)
+
+	// deleting a user deletes their identities, so the account can be linked again
+	must(t, m.User.DeleteByID(ctx, 2, actor))
+	_, err = m.Identity.GetUser(ctx, identity.Issuer, identity.Subject)
+	wantErr(t, err, sql.ErrNoRows)
+	must(t, m.Identity.Insert(ctx, identity))
+}
+
+func testEmailVerifications(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	first, err := data.GenerateEmailVerification(1, "first@example.com", time.Hour)
+	must(t, err)
+	must(t, m.EmailVerification.Insert(ctx, *first))
+
+	// a user has one verification pending at a time
+	second, err := data.GenerateEmailVerification(1, "second@example.com", time.Hour)
+	must(t, err)
+	must(t, m.EmailVerification.Insert(ctx, *second))
+
+	_, err = m.EmailVerification.GetByToken(ctx, first.Token)
+	wantErr(t, err, sql.ErrNoRows)
+
+	v, err := m.EmailVerification.GetByToken(ctx, second.Token)
+	must(t, err)
+	if v.UserID != 1 || v.Email != "second@example.com" || v.Token != "" {
+		t.Errorf("GetByToken returned the wrong verification: %+v", v)
+	}
+
+	must(t, m.EmailVerification.DeleteForUser(ctx, 1))
+	_, err = m.EmailVerification.GetByToken(ctx, second.Token)
+	wantErr(t, err, sql.ErrNoRows)
+
+	expired, err := data.GenerateEmailVerification(2, "expired@example.com", -time.Hour)
+	must(t, err)
+	must(t, m.EmailVerification.Insert(ctx, *expired))
+
+	n, err := m.EmailVerification.DeleteExpired(ctx)
+	must(t, err)
+	if n != 1 {
+		t.Errorf("expected DeleteExpired to delete 1 verification, got %d", n)
+	}
+}
+
+func testIdempotency(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	req := data.IdempotentRequest{
+		Scope:       "user:1",
+		Key:         "key-1",
+		RequestHash: []byte("hash"),
+		Expiry:      time.Now().Add(time.Hour),
+	}
+	must(t, m.Idempotency.Start(ctx, req))
+
+	// a request in progress has no response yet
+	got, err := m.Idempotency.Get(ctx, "user:1", "key-1")
+	must(t, err)
+	if got.Status != 0 || !bytes.Equal(got.RequestHash, []byte("hash")) {
+		t.Errorf("Get returned the wrong request: %+v", got)
+	}
+
+	// keys are only unique within a scope
+	wantErr(t, m.Idempotency.Start(ctx, req), data.ErrDuplicate)
+	_, err = m.Idempotency.Get(ctx, "user:2", "key-1")
+	wantErr(t, err, sql.ErrNoRows)
+	other := req
+	other.Scope = "user:2"
+	must(t, m.Idempotency.Start(ctx, other))
+
+	req.Status = 201
+	req.Header = map[string][]string{"Content-Type": {"application/json"}}
+	req.Body = []byte(`{"error":false}`)
+	must(t, m.Idempotency.Finish(ctx, req))
+
+	got, err = m.Idempotency.Get(ctx, "user:1", "key-1")
+	must(t, err)
+	if got.Status != 201 || string(got.Body) != `{"error":false}` || got.Header["Content-Type"][0] != "application/json" {
+		t.Errorf("Get returned the wrong response: %+v", got)
+	}
+
+	must(t, m.Idempotency.Delete(ctx, "user:1", "key-1"))
+	_, err = m.Idempotency.Get(ctx, "user:1", "key-1")
+	wantErr(t, err, sql.ErrNoRows)
+
+	// an expired key is forgotten, and may be used again
+	expired := data.IdempotentRequest{
+		Scope:       "user:1",
+		Key:         "key-2",
+		RequestHash: []byte("hash"),
+		Expiry:      time.Now().Add(-time.Hour),
+	}
+	must(t, m.Idempotency.Start(ctx, expired))
+	_, err = m.Idempotency.Get(ctx, "user:1", "key-2")
+	wantErr(t, err, sql.ErrNoRows)
+
+	n, err := m.Idempotency.DeleteExpired(ctx)
+	must(t, err)
+	if n != 1 {
+		t.Errorf("expected DeleteExpired to delete 1 request, got %d", n)
+	}
+
+	expired.Expiry = time.Now().Add(time.Hour)
+	must(t, m.Idempotency.Start(ctx, expired))
+}
+
+func testAudit(t *testing.T, m data.Models) {
+	ctx := context.Background()
+
+	f, err := m.Food.GetOneById(ctx, 3)
+	must(t, err)
+	f.Description = "Noodles in a rich broth"
+	must(t, m.Food.Update(ctx, *f, actor))
+
+	must(t, m.Food.DeleteByID(ctx, 3, data.Actor{UserID: 2, IP: "127.0.0.2"}))
+
+	_, err = m.User.Insert(ctx, data.User{Email: "dave@example.com", FirstName: "Dave", LastName: "Adams", Password: "x"}, actor)
+	must(t, err)
+
+	events, total, err := m.Audit.GetAll(ctx, data.AuditFilter{EntityType: "food", EntityID: 3}, 1, 10)
+	must(t, err)
+	if total != 2 || len(events) != 2 {
+		t.Fatalf("expected 2 events for the food, got %d", total)
+	}
+
+	// newest first
+	deleted, updated := events[0], events[1]
+	if deleted.Action != "delete" || deleted.ActorID != 2 || deleted.IP != "127.0.0.2" || deleted.After != nil {
+		t.Errorf("unexpected delete event: %+v", deleted)
+	}
+	if updated.Action != "update" || updated.ActorID != actor.UserID || updated.RequestID != actor.RequestID {
+		t.Errorf("unexpected update event: %+v", updated)
+	}
+
+	// updates record only the fields which changed
+	var before, after map[string]interface{}
+	must(t, json.Unmarshal(updated.Before, &before))
+	must(t, json.Unmarshal(updated.After, &after))
+	if !reflect.DeepEqual(before, map[string]interface{}{"description": "Noodles in broth"}) ||
+		!reflect.DeepEqual(after, map[string]interface{}{"description": "Noodles in a rich broth"}) {
+		t.Errorf("expected only the description in the update event, got %s and %s", updated.Before, updated.After)
+	}
+
+	events, total, err = m.Audit.GetAll(ctx, data.AuditFilter{ActorID: actor.UserID}, 2, 1)
+	must(t, err)
+	if total != 2 || len(events) != 1 || events[0].Action != "update" {
+		t.Errorf("expected the older of 2 events by the actor on the second page, got %d of %d", len(events), total)
+	}
+
+	// a page past the end still reports the total
+	events, total, err = m.Audit.GetAll(ctx, data.AuditFilter{ActorID: actor.UserID}, 3, 1)
+	must(t, err)
+	if total != 2 || len(events) != 0 {
+		t.Errorf("expected no events of 2 on the third page, got %d of %d", len(events), total)
+	}
+
+	_, total, err = m.Audit.GetAll(ctx, data.AuditFilter{Since: time.Now().Add(time.Hour)}, 1, 10)
+	must(t, err)
+	if total != 0 {
+		t.Errorf("expected no events in the future, got %d", total)
+	}
+}
@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"time"
+)
+
+// EmailVerification is a pending change of a user's email address. The change is only
+// applied once the user proves they own the new address, by presenting the plain text
+// token we send to it. Only a hash of the token is stored in the database.
+type EmailVerification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Token     string    `json:"-"`
+	TokenHash []byte    `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GenerateEmailVerification creates a verification for changing a user's email address to email.
+// It uses the same token format as GenerateToken.
+func GenerateEmailVerification(userID int, email string, ttl time.Duration) (*EmailVerification, error) {
+	token, err := GenerateToken(userID, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmailVerification{
+		UserID:    userID,
+		Email:     email,
+		Token:     token.Token,
+		TokenHash: token.TokenHash,
+		Expiry:    token.Expiry,
+	}, nil
+}
+
+// Insert saves a verification, replacing any verification already pending for the same user
+func (s *sqlEmailVerifications) Insert(ctx context.Context, verification EmailVerification) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := `delete from email_verifications where user_id = $1`
+	_, err := s.db.ExecContext(ctx, stmt, verification.UserID)
+	if err != nil {
+		return err
+	}
+
+	stmt = `insert into email_verifications (user_id, email, token_hash, expiry, created_at)
+		values ($1, $2, $3, $4, $5)`
+
+	_, err = s.db.ExecContext(ctx, stmt,
+		verification.UserID,
+		verification.Email,
+		verification.TokenHash,
+		verification.Expiry,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetByToken looks up a verification by the plain text token that was sent to the user
+func (s *sqlEmailVerifications) GetByToken(ctx context.Context, plainText string) (*EmailVerification, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	hash := sha256.Sum256([]byte(plainText))
+
+	query := `select id, user_id, email, token_hash, expiry, created_at
+			from email_verifications where token_hash = $1`
+
+	var verification EmailVerification
+	row := s.db.QueryRowContext(ctx, query, hash[:])
+
+	err := row.Scan(
+		&verification.ID,
+		&verification.UserID,
+		&verification.Email,
+		&verification.TokenHash,
+		&verification.Expiry,
+		&verification.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &verification, nil
+}
+
+// DeleteForUser deletes any verification pending for a user
+func (s *sqlEmailVerifications) DeleteForUser(ctx context.Context, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := `delete from email_verifications where user_id = $1`
+	_, err := s.db.ExecContext(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpired deletes every verification which has expired, and returns how many were deleted
+func (s *sqlEmailVerifications) DeleteExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	stmt := `delete from email_verifications where expiry < $1`
+	result, err := s.db.ExecContext(ctx, stmt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
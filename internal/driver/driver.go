@@ -1,51 +1,99 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"time"
 
 	_ "github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4"
-	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jackc/pgx/v4/stdlib"
 )
 
+// tracedPostgres is the name of the pgx driver, wrapped so that every query is traced
+const tracedPostgres = "pgx-traced"
+
+func init() {
+	sql.Register(tracedPostgres, Traced(stdlib.GetDefaultDriver(), "postgresql"))
+}
+
 type DB struct {
 	SQL *sql.DB
 }
 
-var dbConn = &DB{}
+// PoolConfig holds the connection pool settings
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
 
-const maxOpenDbConn = 5
-const maxIdleDbConn = 5
-const maxDbLifeTime = 5 * time.Minute
+// RetryConfig controls how long ConnectPostgres waits for a database which is not up yet,
+// such as one starting alongside us. It makes up to Attempts attempts, waiting Backoff
+// after the first failure and doubling the wait after each one, up to MaxBackoff.
+type RetryConfig struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
 
-func ConnectPostgres(dsn string) (*DB, error) {
-	d, err := sql.Open("pgx", dsn)
+// ConnectPostgres opens a pool of connections to the Postgres database at dsn, and makes
+// sure it can be reached, retrying as retry says until it can or ctx is done
+func ConnectPostgres(ctx context.Context, dsn string, pool PoolConfig, retry RetryConfig) (*DB, error) {
+	db, err := OpenPostgres(dsn, pool)
 	if err != nil {
 		return nil, err
 	}
 
-	d.SetMaxOpenConns(maxOpenDbConn)
-	d.SetMaxIdleConns(maxIdleDbConn)
-	d.SetConnMaxLifetime(maxDbLifeTime)
-
-	err = testDB(d)
+	err = withRetry(ctx, retry, func() error {
+		return db.SQL.PingContext(ctx)
+	})
 	if err != nil {
+		db.SQL.Close()
 		return nil, err
 	}
 
-	dbConn.SQL = d
-	return dbConn, nil
+	return db, nil
 }
 
-func testDB(d *sql.DB) error {
-	err := d.Ping()
+// OpenPostgres opens a pool of connections to the Postgres database at dsn, without
+// connecting to it, so that a database which is down, such as a read replica, does not stop
+// us starting
+func OpenPostgres(dsn string, pool PoolConfig) (*DB, error) {
+	d, err := sql.Open(tracedPostgres, dsn)
 	if err != nil {
-		fmt.Println("Error!", err)
-		return err
+		return nil, err
 	}
-	fmt.Println("*** Pinged database successfully! ***")
 
-	return nil
+	d.SetMaxOpenConns(pool.MaxOpenConns)
+	d.SetMaxIdleConns(pool.MaxIdleConns)
+	d.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
+	return &DB{SQL: d}, nil
+}
+
+// withRetry calls fn until it succeeds, it has been called retry.Attempts times, or ctx is
+// done, and returns its last error
+func withRetry(ctx context.Context, retry RetryConfig, fn func() error) error {
+	wait := retry.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retry.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		wait *= 2
+		if retry.MaxBackoff > 0 && wait > retry.MaxBackoff {
+			wait = retry.MaxBackoff
+		}
+	}
 }
@@ -0,0 +1,71 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		retry    RetryConfig
+		failures int
+		wantErr  bool
+		wantCall int
+	}{
+		{"succeeds at once", RetryConfig{Attempts: 3, Backoff: time.Millisecond}, 0, false, 1},
+		{"succeeds after retrying", RetryConfig{Attempts: 3, Backoff: time.Millisecond}, 2, false, 3},
+		{"gives up", RetryConfig{Attempts: 3, Backoff: time.Millisecond}, 5, true, 3},
+		{"tries once without attempts", RetryConfig{}, 5, true, 1},
+	}
+
+	for _, tt := range tests {
+		var calls int
+		err := withRetry(context.Background(), tt.retry, func() error {
+			calls++
+			if calls <= tt.failures {
+				return down
+			}
+			return nil
+		})
+
+		if (err != nil) != tt.wantErr || calls != tt.wantCall {
+			t.Errorf("%s: got error %v after %d calls, want error %v after %d", tt.name, err, calls, tt.wantErr, tt.wantCall)
+		}
+	}
+}
+
+func TestWithRetry_Backoff(t *testing.T) {
+	var calls []time.Time
+	start := time.Now()
+
+	retry := RetryConfig{Attempts: 4, Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	_ = withRetry(context.Background(), retry, func() error {
+		calls = append(calls, time.Now())
+		return errors.New("down")
+	})
+
+	// waits of 10ms, 20ms, then 20ms rather than 40ms
+	if elapsed := calls[len(calls)-1].Sub(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("expected about 50ms of backoff, got %s", elapsed)
+	}
+}
+
+func TestWithRetry_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+	err := withRetry(ctx, RetryConfig{Attempts: 100, Backoff: time.Hour}, func() error {
+		calls++
+		cancel()
+		return errors.New("down")
+	})
+
+	if err == nil || calls != 1 {
+		t.Errorf("expected to stop after 1 call when cancelled, got %d calls and error %v", calls, err)
+	}
+}
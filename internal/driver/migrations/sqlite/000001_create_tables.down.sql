@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS tastes;
+DROP TABLE IF EXISTS foods_tastes;
+DROP TABLE IF EXISTS foods;
+DROP TABLE IF EXISTS countries;
@@ -0,0 +1,60 @@
+--
+-- The SQLite version of the Postgres schema in the top level migrations directory. Each
+-- migration here matches the one with the same number there, so that both databases are
+-- at the same schema version.
+--
+
+CREATE TABLE countries (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    country_name varchar(512),
+    created_at timestamp,
+    updated_at timestamp
+);
+
+CREATE TABLE foods (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    known_as varchar(512),
+    country_id integer,
+    make_year integer,
+    created_at timestamp,
+    updated_at timestamp,
+    slug varchar(512),
+    description text
+);
+
+CREATE TABLE foods_tastes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    food_id integer,
+    taste_id integer,
+    created_at timestamp,
+    updated_at timestamp
+);
+
+CREATE TABLE tastes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    taste varchar(255),
+    created_at timestamp,
+    updated_at timestamp
+);
+
+CREATE TABLE tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer,
+    email varchar(255) NOT NULL,
+    token varchar(255) NOT NULL,
+    token_hash blob NOT NULL,
+    expiry timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE TABLE users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    email varchar(255),
+    first_name varchar(255) NOT NULL,
+    last_name varchar(255) NOT NULL,
+    password varchar(60) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL,
+    user_active integer DEFAULT 0
+);
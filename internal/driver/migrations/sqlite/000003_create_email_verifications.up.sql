@@ -0,0 +1,8 @@
+CREATE TABLE email_verifications (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    email varchar(255) NOT NULL,
+    token_hash blob NOT NULL,
+    expiry timestamp NOT NULL,
+    created_at timestamp NOT NULL
+);
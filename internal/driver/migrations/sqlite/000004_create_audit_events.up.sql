@@ -0,0 +1,30 @@
+CREATE TABLE audit_events (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    actor_id integer,
+    action varchar(64) NOT NULL,
+    entity_type varchar(64) NOT NULL,
+    entity_id integer NOT NULL,
+    before text,
+    after text,
+    ip varchar(64) NOT NULL,
+    request_id varchar(255) NOT NULL,
+    created_at timestamp NOT NULL
+);
+
+CREATE INDEX audit_events_entity_idx ON audit_events (entity_type, entity_id);
+CREATE INDEX audit_events_actor_idx ON audit_events (actor_id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+--
+-- audit_events is append-only: refuse any attempt to change or remove an event
+--
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit_events is append-only');
+END;
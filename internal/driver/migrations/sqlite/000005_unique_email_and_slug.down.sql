@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS foods_slug_key;
+DROP INDEX IF EXISTS users_email_key;
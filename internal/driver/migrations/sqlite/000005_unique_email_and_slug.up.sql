@@ -0,0 +1,6 @@
+--
+-- Users log in by email, and foods are looked up by slug, so both must be unique
+--
+
+CREATE UNIQUE INDEX users_email_key ON users (email);
+CREATE UNIQUE INDEX foods_slug_key ON foods (slug);
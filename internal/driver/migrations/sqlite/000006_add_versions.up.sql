@@ -0,0 +1,7 @@
+--
+-- Every update increments version, so that an update based on an out of date copy of a
+-- food or user can be refused instead of overwriting someone else's changes
+--
+
+ALTER TABLE foods ADD COLUMN version integer NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version integer NOT NULL DEFAULT 1;
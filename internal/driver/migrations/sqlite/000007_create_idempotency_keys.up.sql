@@ -0,0 +1,13 @@
+CREATE TABLE idempotency_keys (
+    scope varchar(255) NOT NULL,
+    idempotency_key varchar(255) NOT NULL,
+    request_hash blob NOT NULL,
+    response_status integer NOT NULL DEFAULT 0,
+    response_header text,
+    response_body blob,
+    expiry timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expiry_idx ON idempotency_keys (expiry);
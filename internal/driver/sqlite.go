@@ -0,0 +1,145 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/food/internal/data"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// tracedSQLite is the name of the SQLite driver, wrapped so that every query is traced
+const tracedSQLite = "sqlite-traced"
+
+func init() {
+	sql.Register(tracedSQLite, Traced(&sqlite.Driver{}, "sqlite"))
+}
+
+// sqliteMigrations holds the SQLite schema. Each migration matches the Postgres migration
+// with the same number, so that data.CheckSchemaVersion works for both.
+//
+//go:embed migrations/sqlite/*.up.sql
+var sqliteMigrations embed.FS
+
+// ConnectSQLite opens the SQLite database file at path, creating it if need be, and brings
+// its schema up to date. Foreign keys are enforced, and times are stored in UTC.
+//
+// Transactions take the write lock when they begin, rather than when they first write, so
+// that one which reads and then writes, as an update checking a version does, waits for
+// other writers under busy_timeout. Upgrading a read lock fails with SQLITE_BUSY at once,
+// however long the timeout.
+func ConnectSQLite(path string, pool PoolConfig) (*DB, error) {
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma":      {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+		"_time_format": {"sqlite"},
+		"_timezone":    {"UTC"},
+		"_txlock":      {"immediate"},
+	}.Encode()
+
+	d, err := sql.Open(tracedSQLite, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	d.SetMaxOpenConns(pool.MaxOpenConns)
+	d.SetMaxIdleConns(pool.MaxIdleConns)
+	d.SetConnMaxLifetime(pool.ConnMaxLifetime)
+
+	if err := migrateSQLite(context.Background(), d); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+
+	return &DB{SQL: d}, nil
+}
+
+// migrateSQLite applies, in order, every migration newer than the version recorded in
+// schema_migrations, each in its own transaction. The table has the same layout as the one
+// golang-migrate keeps in Postgres.
+func migrateSQLite(ctx context.Context, d *sql.DB) error {
+	_, err := d.ExecContext(ctx, `create table if not exists schema_migrations (version bigint not null primary key, dirty boolean not null)`)
+	if err != nil {
+		return err
+	}
+
+	var current int64
+	err = d.QueryRowContext(ctx, `select coalesce(max(version), 0) from schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(sqliteMigrations, "migrations/sqlite/*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version, err := strconv.ParseInt(strings.SplitN(path.Base(name), "_", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", name, err)
+		}
+		if version <= current {
+			continue
+		}
+
+		stmts, err := sqliteMigrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		err = func() error {
+			tx, err := d.BeginTx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			if _, err := tx.ExecContext(ctx, string(stmts)); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `delete from schema_migrations`); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `insert into schema_migrations (version, dirty) values ($1, false)`, version); err != nil {
+				return err
+			}
+
+			return tx.Commit()
+		}()
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", path.Base(name), err)
+		}
+	}
+
+	return nil
+}
+
+// SQLiteError translates SQLite constraint violations into the errors the data package
+// uses for them, so that callers handle them the same way whichever database is in use.
+// Pass it to data.NewSQL.
+func SQLiteError(err error) error {
+	var serr *sqlite.Error
+	if !errors.As(err, &serr) {
+		return err
+	}
+
+	switch serr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return fmt.Errorf("%w: %v", data.ErrDuplicate, err)
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return fmt.Errorf("%w: %v", data.ErrForeignKey, err)
+	}
+
+	return err
+}
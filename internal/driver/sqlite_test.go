@@ -0,0 +1,224 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/food/internal/data"
+	"github.com/food/internal/data/storetest"
+	slugify "github.com/mozillazg/go-slugify"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSQLite_Conformance(t *testing.T) {
+	storetest.Run(t, newSeededSQLite)
+}
+
+func TestConnectSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "food.db")
+	pool := PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4}
+
+	db, err := ConnectSQLite(path, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.CheckSchemaVersion(context.Background(), db.SQL); err != nil {
+		t.Error(err)
+	}
+	db.SQL.Close()
+
+	// opening it again finds the migrations already applied
+	db, err = ConnectSQLite(path, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	if err := data.CheckSchemaVersion(context.Background(), db.SQL); err != nil {
+		t.Error(err)
+	}
+
+	_, err = db.SQL.Exec(`insert into audit_events (action, entity_type, entity_id, ip, request_id, created_at)
+		values ('create', 'food', 1, '', '', $1)`, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SQL.Exec(`delete from audit_events`); err == nil {
+		t.Error("expected audit events to be append-only")
+	}
+}
+
+func TestSQLiteError(t *testing.T) {
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "food.db"), PoolConfig{MaxOpenConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.SQL.Close()
+
+	_, err = db.SQL.Exec(`create table parents (id integer primary key);
+		create table children (id integer primary key, parent_id integer references parents (id));
+		insert into parents (id) values (1)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  error
+	}{
+		{"unique", `insert into users (email, first_name, last_name, password, created_at, updated_at)
+			values ('a@example.com', 'a', 'b', 'x', 0, 0), ('a@example.com', 'a', 'b', 'x', 0, 0)`, data.ErrDuplicate},
+		{"primary key", `insert into parents (id) values (1)`, data.ErrDuplicate},
+		{"foreign key", `insert into children (parent_id) values (2)`, data.ErrForeignKey},
+	}
+
+	for _, tt := range tests {
+		_, err := db.SQL.Exec(tt.query)
+		if !errors.Is(SQLiteError(err), tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, SQLiteError(err))
+		}
+	}
+
+	other := errors.New("boom")
+	if SQLiteError(other) != other {
+		t.Error("expected other errors to be returned unchanged")
+	}
+}
+
+// TestSQLite_ConcurrentUpdates updates the same foods from many connections at once. Each
+// update reads the food's version and then writes it, in one transaction, so two of them
+// holding read locks must not fail to upgrade them with SQLITE_BUSY: one waits for the
+// other, and then finds the version changed.
+func TestSQLite_ConcurrentUpdates(t *testing.T) {
+	ctx := context.Background()
+	models := newSeededSQLite(t, storetest.Seed)
+
+	const workers, updates = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for done := 0; done < updates; {
+				id := w%3 + 1
+				food, err := models.Food.GetOneById(ctx, id)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				food.Description = fmt.Sprintf("updated by %d", w)
+				err = models.Food.Update(ctx, *food, data.Actor{})
+				switch {
+				case errors.Is(err, data.ErrEditConflict):
+					// someone else got there first, so try again from their version
+				case err != nil:
+					errs <- err
+					return
+				default:
+					done++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	versions := 0
+	for id := 1; id <= 3; id++ {
+		food, err := models.Food.GetOneById(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions += food.Version - 1
+	}
+	if versions != workers*updates {
+		t.Errorf("expected %d updates, got %d", workers*updates, versions)
+	}
+}
+
+// newSeededSQLite returns models backed by a new SQLite database holding seed
+func newSeededSQLite(t *testing.T, seed data.Seed) data.Models {
+	t.Helper()
+
+	db, err := ConnectSQLite(filepath.Join(t.TempDir(), "food.db"), PoolConfig{MaxOpenConns: 4, MaxIdleConns: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.SQL.Close() })
+
+	if err := insertSeed(db.SQL, seed); err != nil {
+		t.Fatal(err)
+	}
+
+	return data.NewSQL(db.SQL, SQLiteError)
+}
+
+// insertSeed stores seed in db the way data.NewMemory would: countries and tastes keep
+// their IDs, and foods and users are numbered from 1
+func insertSeed(db *sql.DB, seed data.Seed) error {
+	now := time.Now()
+
+	for _, c := range seed.Countries {
+		_, err := db.Exec(`insert into countries (id, country_name, created_at, updated_at) values ($1, $2, $3, $3)`,
+			c.ID, c.CountryName, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, taste := range seed.Tastes {
+		_, err := db.Exec(`insert into tastes (id, taste, created_at, updated_at) values ($1, $2, $3, $3)`,
+			taste.ID, taste.Taste, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range seed.Foods {
+		var id int
+		err := db.QueryRow(`insert into foods (known_as, country_id, make_year, slug, description, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6) returning id`,
+			f.KnownAs, f.CountryID, f.MakeYear, slugify.Slugify(f.KnownAs), f.Description, now).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		for _, tasteID := range f.TasteIDs {
+			_, err := db.Exec(`insert into foods_tastes (food_id, taste_id, created_at, updated_at) values ($1, $2, $3, $3)`,
+				id, tasteID, now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, u := range seed.Users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.MinCost)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.Exec(`insert into users (email, first_name, last_name, password, user_active, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6)`, u.Email, u.FirstName, u.LastName, hash, u.Active, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
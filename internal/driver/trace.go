@@ -0,0 +1,316 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package
+const tracerName = "github.com/food/internal/driver"
+
+// Traced wraps a database/sql driver so that every query and statement run through it is
+// recorded as an OpenTelemetry span, a child of the span in the context the query was run
+// with. Spans are named after the statement, such as "SELECT foods", and record the rows
+// returned or affected and any error, along with system, the OpenTelemetry name of the
+// database, such as "postgresql". Spans are sent to the global tracer provider.
+func Traced(d driver.Driver, system string) driver.Driver {
+	return tracedDriver{d, system}
+}
+
+type tracedDriver struct {
+	driver.Driver
+	system string
+}
+
+func (d tracedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return tracedConn{conn, d.system}, nil
+}
+
+// statementName returns a short, low cardinality name for query, suitable for a span name:
+// the operation, and the table it works on. Tables named inside parentheses, such as in
+// subqueries, are ignored.
+func statementName(query string) (operation, table string) {
+	var words []string
+	var depth int
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, c := range query {
+		switch {
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			depth--
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' || c == ';':
+			flush()
+		case depth == 0:
+			word.WriteRune(c)
+		}
+	}
+	flush()
+
+	if len(words) == 0 {
+		return "QUERY", ""
+	}
+
+	operation = strings.ToUpper(words[0])
+
+	var before string
+	switch operation {
+	case "SELECT", "DELETE":
+		before = "from"
+	case "INSERT":
+		before = "into"
+	case "UPDATE":
+		if len(words) > 1 {
+			return operation, words[1]
+		}
+		return operation, ""
+	default:
+		return operation, ""
+	}
+
+	for i := 1; i < len(words)-1; i++ {
+		if strings.EqualFold(words[i], before) {
+			return operation, words[i+1]
+		}
+	}
+
+	return operation, ""
+}
+
+// startSpan starts a span for query, run on the database system
+func startSpan(ctx context.Context, system, query string) (context.Context, trace.Span) {
+	operation, table := statementName(query)
+
+	name := operation
+	if table != "" {
+		name += " " + table
+	}
+
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", system),
+			attribute.String("db.operation.name", operation),
+			attribute.String("db.collection.name", table),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+// endSpan records err, if it is a real error, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, driver.ErrSkip) && !errors.Is(err, io.EOF) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedConn traces queries run directly on a connection. It passes every optional
+// interface through to the wrapped connection, returning driver.ErrSkip where the wrapped
+// connection does not implement one, so that database/sql falls back as it would have.
+type tracedConn struct {
+	driver.Conn
+	system string
+}
+
+func (c tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startSpan(ctx, c.system, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (c tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := startSpan(ctx, c.system, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	if err == nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	endSpan(span, err)
+
+	return result, err
+}
+
+func (c tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tracedStmt{Stmt: stmt, query: query, system: c.system}, nil
+}
+
+func (c tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+
+	return c.Conn.Begin()
+}
+
+func (c tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// tracedStmt traces prepared statements, which database/sql uses when the connection
+// cannot run a query directly
+type tracedStmt struct {
+	driver.Stmt
+	query  string
+	system string
+}
+
+func (s tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := startSpan(ctx, s.system, s.query)
+
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedToValues(args))
+	}
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (s tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := startSpan(ctx, s.system, s.query)
+
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(namedToValues(args))
+	}
+	if err == nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	endSpan(span, err)
+
+	return result, err
+}
+
+func (s tracedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func namedToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
+
+// tracedRows keeps the span for a query open while its rows are read, and counts them
+type tracedRows struct {
+	driver.Rows
+	span  trace.Span
+	count int64
+	err   error
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.count++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+
+	r.span.SetAttributes(attribute.Int64("db.response.returned_rows", r.count))
+	if r.err != nil {
+		endSpan(r.span, r.err)
+	} else {
+		endSpan(r.span, err)
+	}
+
+	return err
+}
@@ -0,0 +1,117 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStatementName(t *testing.T) {
+	tests := []struct {
+		query, operation, table string
+	}{
+		{`select id, email, exists (select 1 from tokens t where t.user_id = users.id) as has_token
+			from users order by last_name`, "SELECT", "users"},
+		{`select f.id from foods f left join countries c on (f.country_id = c.id)`, "SELECT", "foods"},
+		{`insert into audit_events (actor_id, action) values ($1, $2)`, "INSERT", "audit_events"},
+		{`update users set email = $1 where id = $2`, "UPDATE", "users"},
+		{`delete from tokens where expiry < $1`, "DELETE", "tokens"},
+		{`begin`, "BEGIN", ""},
+	}
+
+	for _, tt := range tests {
+		operation, table := statementName(tt.query)
+		if operation != tt.operation || table != tt.table {
+			t.Errorf("statementName(%q) = %s %s, want %s %s", tt.query, operation, table, tt.operation, tt.table)
+		}
+	}
+}
+
+func TestTraced(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(tp)
+
+	mockDB, mock, err := sqlmock.NewWithDSN("trace_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mockDB.Close()
+
+	sql.Register("sqlmock-traced", Traced(mockDB.Driver(), "postgresql"))
+	db, err := sql.Open("sqlmock-traced", "trace_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("from foods").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectExec("update foods").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectQuery("from tastes").WillReturnError(errors.New("boom"))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "GET /foods")
+
+	rows, err := db.QueryContext(ctx, "select id from foods f order by f.known_as")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	if _, err := db.ExecContext(ctx, "update foods set slug = $1", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.QueryContext(ctx, "select id from tastes"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(spans))
+	}
+
+	attr := func(s tracetest.SpanStub, key string) attribute.Value {
+		for _, a := range s.Attributes {
+			if string(a.Key) == key {
+				return a.Value
+			}
+		}
+		return attribute.Value{}
+	}
+
+	selectFoods, updateFoods, selectTastes := spans[0], spans[1], spans[2]
+
+	for _, s := range spans[:3] {
+		if s.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %s is not a child of the request span", s.Name)
+		}
+		if got := attr(s, "db.system.name").AsString(); got != "postgresql" {
+			t.Errorf("span %s has db.system.name %q, want postgresql", s.Name, got)
+		}
+	}
+
+	if selectFoods.Name != "SELECT foods" || attr(selectFoods, "db.response.returned_rows").AsInt64() != 2 {
+		t.Errorf("unexpected span %s with attributes %v", selectFoods.Name, selectFoods.Attributes)
+	}
+
+	if updateFoods.Name != "UPDATE foods" || attr(updateFoods, "db.rows_affected").AsInt64() != 3 {
+		t.Errorf("unexpected span %s with attributes %v", updateFoods.Name, updateFoods.Attributes)
+	}
+
+	if selectTastes.Name != "SELECT tastes" || selectTastes.Status.Code != codes.Error {
+		t.Errorf("expected span SELECT tastes to record an error, got %s %v", selectTastes.Name, selectTastes.Status)
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS public.users;
+DROP TABLE IF EXISTS public.tokens;
+DROP TABLE IF EXISTS public.tastes;
+DROP TABLE IF EXISTS public.foods_tastes;
+DROP TABLE IF EXISTS public.foods;
+DROP TABLE IF EXISTS public.countries;
@@ -0,0 +1,2 @@
+ALTER TABLE public.foods DROP CONSTRAINT IF EXISTS foods_slug_key;
+ALTER TABLE public.users DROP CONSTRAINT IF EXISTS users_email_key;
@@ -0,0 +1,6 @@
+--
+-- Users log in by email, and foods are looked up by slug, so both must be unique
+--
+
+ALTER TABLE public.users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE public.foods ADD CONSTRAINT foods_slug_key UNIQUE (slug);
@@ -0,0 +1,2 @@
+ALTER TABLE public.users DROP COLUMN IF EXISTS version;
+ALTER TABLE public.foods DROP COLUMN IF EXISTS version;
@@ -0,0 +1,20 @@
+--
+-- Name: idempotency_keys; Type: TABLE; Schema: public; Owner: -
+--
+-- A request made with an Idempotency-Key, and the response it got, so that a retry of the
+-- request is answered with the same response instead of being handled again
+--
+
+CREATE TABLE public.idempotency_keys (
+    scope character varying(255) NOT NULL,
+    idempotency_key character varying(255) NOT NULL,
+    request_hash bytea NOT NULL,
+    response_status integer NOT NULL DEFAULT 0,
+    response_header jsonb,
+    response_body bytea,
+    expiry timestamp with time zone NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    PRIMARY KEY (scope, idempotency_key)
+);
+
+CREATE INDEX idempotency_keys_expiry_idx ON public.idempotency_keys (expiry);
@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Login logs in, and returns the user logged in as. The client sends the token it is given
+// from then on, and keeps the credentials, so that it can log in again when the token is
+// about to expire or is refused.
+func (c *Client) Login(ctx context.Context, email, password string) (*User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.logIn(ctx, email, password)
+}
+
+// logIn logs in with email and password, and keeps the token and the credentials. c.mu must
+// be held.
+func (c *Client) logIn(ctx context.Context, email, password string) (*User, error) {
+	body, _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/login",
+		body:   map[string]string{"email": email, "password": password},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var session struct {
+		Token struct {
+			Token  string    `json:"token"`
+			Expiry time.Time `json:"expiry"`
+		} `json:"token"`
+		User User `json:"user"`
+	}
+	if err := decodeData(body, &session); err != nil {
+		return nil, err
+	}
+
+	c.token, c.expiry = session.Token.Token, session.Token.Expiry
+	c.email, c.password = email, password
+
+	return &session.User, nil
+}
+
+// Logout logs out, deleting the token, and forgets the credentials
+func (c *Client) Logout(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/logout",
+		body:   map[string]string{"token": c.token},
+	})
+	if err != nil {
+		return err
+	}
+
+	c.token, c.expiry = "", time.Time{}
+	c.email, c.password = "", ""
+
+	return nil
+}
+
+// ValidateToken reports whether token is valid
+func (c *Client) ValidateToken(ctx context.Context, token string) (bool, error) {
+	body, _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/validate-token",
+		body:   map[string]string{"token": token},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var valid bool
+	err = decodeData(body, &valid)
+	return valid, err
+}
+
+// VerifyEmail confirms a new email address with the token sent to it
+func (c *Client) VerifyEmail(ctx context.Context, token string) error {
+	_, _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/users/verify-email",
+		body:   map[string]string{"token": token},
+	})
+	return err
+}
+
+// Me returns the logged in user
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	body, _, err := c.do(ctx, request{method: http.MethodGet, path: "/me", auth: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var me struct {
+		User User `json:"user"`
+	}
+	if err := decodeData(body, &me); err != nil {
+		return nil, err
+	}
+
+	return &me.User, nil
+}
+
+// UpdateMe changes the logged in user's name or email address. A new email address only
+// takes effect once it is verified.
+func (c *Client) UpdateMe(ctx context.Context, update MeUpdate) error {
+	_, _, err := c.do(ctx, request{method: http.MethodPatch, path: "/me", body: update, auth: true})
+	return err
+}
+
+// ChangePassword changes the logged in user's password, which logs out every other session
+func (c *Client) ChangePassword(ctx context.Context, current, next string) error {
+	_, _, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/me/password",
+		body:   map[string]string{"current_password": current, "new_password": next},
+		auth:   true,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.email != "" {
+		c.password = next
+	}
+
+	return nil
+}
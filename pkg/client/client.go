@@ -0,0 +1,292 @@
+// Package client is a Go client for the food API. It logs in and sends the bearer token for
+// the caller, logging in again when the token is about to expire or is refused, decodes
+// errors into an *Error, and retries calls which are safe to repeat when the server or the
+// network fails.
+//
+//	c := client.New("https://food.example.com")
+//	if _, err := c.Login(ctx, "admin@example.com", "password"); err != nil {
+//		return err
+//	}
+//	food, err := c.GetFood(ctx, 1)
+package client
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshBefore is how long before its token expires the client logs in again
+const refreshBefore = time.Minute
+
+// Client calls the food API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	// mu guards the token, and the credentials it was issued for, which are kept so that
+	// the client can log in again when it expires
+	mu       sync.Mutex
+	token    string
+	expiry   time.Time
+	email    string
+	password string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used to send requests, instead of http.DefaultClient
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithRetries sets how many times a call which is safe to repeat is retried, and the delay
+// before the first retry, which doubles with each one up to maxBackoff. Zero retries turns
+// retrying off. The default is 3 retries, from 100ms up to 5s.
+func WithRetries(retries int, backoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = max(retries, 0)
+		c.backoff = backoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithToken starts the client with a token issued earlier. The client cannot log in again
+// when it expires, as it does not know the credentials; call Login for that.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New returns a client for the API at baseURL, such as https://food.example.com
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retries:    3,
+		backoff:    100 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Token returns the token the client sends, which is empty before it has logged in
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.token
+}
+
+// request is one call to the API
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        interface{} // marshalled as JSON, unless it is a []byte
+	contentType string      // of the body, if it is not application/json
+	header      http.Header
+	auth        bool // sends the token
+}
+
+// do sends r, and returns the body of a successful response. An error response is returned as
+// an *Error. A request with auth set sends the token, logging in again first if it is about
+// to expire, or afterwards if it is refused.
+func (c *Client) do(ctx context.Context, r request) ([]byte, http.Header, error) {
+	var body []byte
+	switch b := r.body.(type) {
+	case nil:
+	case []byte:
+		body = b
+	default:
+		var err error
+		body, err = json.Marshal(b)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range r.header {
+		header[k] = v
+	}
+	header.Set("Accept", "application/json")
+	if body != nil {
+		if r.contentType == "" {
+			r.contentType = "application/json"
+		}
+		header.Set("Content-Type", r.contentType)
+	}
+
+	// a POST which changes something is retried with the same key, so that the server
+	// answers a retry of a request it already handled with the first response
+	if r.auth && r.method == http.MethodPost && header.Get("Idempotency-Key") == "" {
+		header.Set("Idempotency-Key", crand.Text())
+	}
+
+	target := c.baseURL + r.path
+	if len(r.query) > 0 {
+		target += "?" + r.query.Encode()
+	}
+
+	if !r.auth {
+		return c.send(ctx, r.method, target, header, body)
+	}
+
+	token, err := c.bearer(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Set("Authorization", "Bearer "+token)
+
+	respBody, respHeader, err := c.send(ctx, r.method, target, header, body)
+	if !IsStatus(err, http.StatusUnauthorized) || !c.canLogIn() {
+		return respBody, respHeader, err
+	}
+
+	// the token was refused, perhaps because it was revoked, so log in again and try once more
+	token, err = c.refresh(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Set("Authorization", "Bearer "+token)
+
+	return c.send(ctx, r.method, target, header, body)
+}
+
+// send sends one request, retrying it if it is safe to repeat and it fails in a way which
+// may not happen again
+func (c *Client) send(ctx context.Context, method, target string, header http.Header, body []byte) ([]byte, http.Header, error) {
+	repeatable := method == http.MethodGet || method == http.MethodHead || method == http.MethodPut ||
+		method == http.MethodDelete || header.Get("Idempotency-Key") != ""
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header = header.Clone()
+
+		var status int
+		var respBody []byte
+		var respHeader http.Header
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil {
+			status, respHeader = resp.StatusCode, resp.Header
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+
+		retry := (err != nil && ctx.Err() == nil) || status == http.StatusTooManyRequests ||
+			status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+		if repeatable && retry && attempt < c.retries {
+			if err := c.wait(ctx, attempt, respHeader); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+		if status >= 400 {
+			return nil, respHeader, decodeError(status, respBody)
+		}
+
+		return respBody, respHeader, nil
+	}
+}
+
+// wait waits before retry number attempt, for as long as the server asked in Retry-After, or
+// else for an exponential backoff with full jitter
+func (c *Client) wait(ctx context.Context, attempt int, header http.Header) error {
+	delay := min(c.backoff<<attempt, c.maxBackoff)
+	if delay > 0 {
+		delay = rand.N(delay) + 1
+	}
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// bearer returns the token to send, logging in again first if it is about to expire
+func (c *Client) bearer(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.email != "" && (c.token == "" || time.Until(c.expiry) < refreshBefore) {
+		if _, err := c.logIn(ctx, c.email, c.password); err != nil {
+			return "", err
+		}
+	}
+
+	return c.token, nil
+}
+
+// refresh logs in again, because stale was refused, unless another call already has
+func (c *Client) refresh(ctx context.Context, stale string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != stale {
+		return c.token, nil
+	}
+
+	if _, err := c.logIn(ctx, c.email, c.password); err != nil {
+		return "", err
+	}
+
+	return c.token, nil
+}
+
+// canLogIn reports whether the client knows the credentials to log in again
+func (c *Client) canLogIn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.email != ""
+}
+
+// decodeData decodes the data held by the envelope in body into out
+func decodeData(body []byte, out interface{}) error {
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(envelope.Data, out)
+}
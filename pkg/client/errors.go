@@ -0,0 +1,88 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// These errors describe why the API refused a call. Test for them with errors.Is, which
+// matches an *Error with the right status.
+var (
+	// ErrBadRequest is a call with a body or parameters the API does not accept
+	ErrBadRequest = errors.New("bad request")
+
+	// ErrUnauthorized is a call without a valid token, or a login with the wrong credentials
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrForbidden is a call which is not allowed, such as one which would create a second
+	// food with the same slug, or a second user with the same email address
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrNotFound is a call for a food or user which does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is an update based on a version which is no longer the current one
+	ErrConflict = errors.New("conflict")
+
+	// ErrPreconditionRequired is an update which did not say which version it was based on
+	ErrPreconditionRequired = errors.New("precondition required")
+)
+
+// Error is an error response from the API
+type Error struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+
+	// Message is the message sent by the API, or the status text if it sent none
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("food api: %d %s", e.StatusCode, e.Message)
+}
+
+// Is matches the sentinel error for the status of e
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict || e.StatusCode == http.StatusPreconditionFailed
+	case ErrPreconditionRequired:
+		return e.StatusCode == http.StatusPreconditionRequired
+	}
+
+	return false
+}
+
+// IsStatus reports whether err is an error response from the API with status
+func IsStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+// decodeError returns the *Error for a response with status and body, which is usually an
+// envelope holding the message
+func decodeError(status int, body []byte) error {
+	var envelope struct {
+		Message string `json:"message"`
+	}
+
+	e := &Error{StatusCode: status}
+	if json.Unmarshal(body, &envelope) == nil {
+		e.Message = envelope.Message
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(status)
+	}
+
+	return e
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ListFoods returns every food
+func (c *Client) ListFoods(ctx context.Context) ([]Food, error) {
+	body, _, err := c.do(ctx, request{method: http.MethodGet, path: "/v1/foods"})
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Foods []Food `json:"foods"`
+	}
+	if err := decodeData(body, &list); err != nil {
+		return nil, err
+	}
+
+	return list.Foods, nil
+}
+
+// GetFood returns the food with id
+func (c *Client) GetFood(ctx context.Context, id int) (*Food, error) {
+	return c.food(ctx, request{method: http.MethodGet, path: foodPath(id)})
+}
+
+// GetFoodBySlug returns the food with slug, such as fish-tacos
+func (c *Client) GetFoodBySlug(ctx context.Context, slug string) (*Food, error) {
+	return c.food(ctx, request{method: http.MethodGet, path: "/foods/" + url.PathEscape(slug)})
+}
+
+// CreateFood creates a food, and returns it as it was saved
+func (c *Client) CreateFood(ctx context.Context, food FoodInput) (*Food, error) {
+	food.Version = 0
+	return c.food(ctx, request{method: http.MethodPost, path: "/v1/foods", body: food, auth: true})
+}
+
+// ReplaceFood replaces the food with id, clearing anything food leaves out. food.Version must
+// be the version the replacement is based on; if the food has changed since, the error
+// matches ErrConflict. As a replacement is retried, a retry of one which was in fact saved
+// also reports ErrConflict.
+func (c *Client) ReplaceFood(ctx context.Context, id int, food FoodInput) (*Food, error) {
+	return c.food(ctx, request{method: http.MethodPut, path: foodPath(id), body: food, auth: true})
+}
+
+// PatchFood changes the fields of the food with id which patch names, provided the food is
+// still at version
+func (c *Client) PatchFood(ctx context.Context, id, version int, patch Patch) (*Food, error) {
+	return c.food(ctx, request{
+		method:      http.MethodPatch,
+		path:        foodPath(id),
+		body:        patch,
+		contentType: patch.mediaType(),
+		header:      ifMatch(version),
+		auth:        true,
+	})
+}
+
+// DeleteFood deletes the food with id
+func (c *Client) DeleteFood(ctx context.Context, id int) error {
+	_, _, err := c.do(ctx, request{method: http.MethodDelete, path: foodPath(id), auth: true})
+	return err
+}
+
+// ListCountries returns the countries a food may come from
+func (c *Client) ListCountries(ctx context.Context) ([]CountryOption, error) {
+	body, _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/countries/all", auth: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var countries []CountryOption
+	err = decodeData(body, &countries)
+	return countries, err
+}
+
+// AuditLog returns a page of the audit log, newest first
+func (c *Client) AuditLog(ctx context.Context, q AuditQuery) (*AuditPage, error) {
+	query := url.Values{}
+	if q.Entity != "" {
+		query.Set("entity", q.Entity)
+	}
+	if q.EntityID != 0 {
+		query.Set("entity_id", strconv.Itoa(q.EntityID))
+	}
+	if q.Actor != 0 {
+		query.Set("actor", strconv.Itoa(q.Actor))
+	}
+	if !q.Since.IsZero() {
+		query.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if q.Page != 0 {
+		query.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.PageSize != 0 {
+		query.Set("page_size", strconv.Itoa(q.PageSize))
+	}
+
+	body, _, err := c.do(ctx, request{method: http.MethodGet, path: "/admin/audit", query: query, auth: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var page AuditPage
+	if err := decodeData(body, &page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// food sends r, and decodes the food in the response
+func (c *Client) food(ctx context.Context, r request) (*Food, error) {
+	body, _, err := c.do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var food Food
+	if err := decodeData(body, &food); err != nil {
+		return nil, err
+	}
+
+	return &food, nil
+}
+
+func foodPath(id int) string {
+	return "/v1/foods/" + strconv.Itoa(id)
+}
+
+// ifMatch returns the header which makes an update depend on the record being at version
+func ifMatch(version int) http.Header {
+	return http.Header{"If-Match": {`"` + strconv.Itoa(version) + `"`}}
+}
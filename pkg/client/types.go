@@ -0,0 +1,149 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Food is a food, as the API sends it
+type Food struct {
+	ID          int       `json:"id"`
+	KnownAs     string    `json:"known_as"`
+	CountryID   int       `json:"country_id"`
+	MakeYear    int       `json:"make_year"`
+	Slug        string    `json:"slug"`
+	Country     Country   `json:"country"`
+	Description string    `json:"description"`
+	Tastes      []Taste   `json:"tastes"`
+	TasteIDs    []int     `json:"taste_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int       `json:"version"`
+}
+
+// FoodInput is a food to create, or to replace one with. Sample is an image of the food,
+// and is only changed if it is given.
+type FoodInput struct {
+	KnownAs     string `json:"known_as"`
+	CountryID   int    `json:"country_id"`
+	MakeYear    int    `json:"make_year"`
+	Description string `json:"description"`
+	Sample      []byte `json:"sample,omitempty"`
+	TasteIDs    []int  `json:"taste_ids"`
+
+	// Version is the version of the food a replacement is based on
+	Version int `json:"version,omitempty"`
+}
+
+// Country is a country a food comes from
+type Country struct {
+	ID          int       `json:"id"`
+	CountryName string    `json:"country_name"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CountryOption is a country, as listed by ListCountries
+type CountryOption struct {
+	ID   int    `json:"value"`
+	Name string `json:"text"`
+}
+
+// Taste is one of the tastes a food has
+type Taste struct {
+	ID        int       `json:"id"`
+	Taste     string    `json:"taste"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// User is a user, as the API sends it. HasToken is only set by ListUsers.
+type User struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Active    int       `json:"active"`
+	HasToken  bool      `json:"has_token"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+// UserInput is a user to create, or to replace one with. The password is only changed if
+// one is given.
+type UserInput struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Password  string `json:"password,omitempty"`
+	Active    int    `json:"active"`
+
+	// Version is the version of the user a replacement is based on
+	Version int `json:"version,omitempty"`
+}
+
+// MeUpdate changes the logged in user. Fields left nil are not changed.
+type MeUpdate struct {
+	FirstName *string `json:"first_name,omitempty"`
+	LastName  *string `json:"last_name,omitempty"`
+	Email     *string `json:"email,omitempty"`
+}
+
+// Patch is a change to a food or user: a MergePatch or a JSONPatch
+type Patch interface {
+	mediaType() string
+}
+
+// MergePatch is a JSON Merge Patch (RFC 7396): the fields to change, with nil for the ones
+// to clear
+type MergePatch map[string]interface{}
+
+func (MergePatch) mediaType() string { return "application/merge-patch+json" }
+
+// JSONPatch is a JSON Patch (RFC 6902): a list of operations
+type JSONPatch []PatchOperation
+
+func (JSONPatch) mediaType() string { return "application/json-patch+json" }
+
+// PatchOperation is one operation of a JSONPatch, such as
+// {Op: "replace", Path: "/description", Value: "spicy"}
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// AuditEvent is one change recorded in the audit log. Before and After are the record as it
+// was and as it became, as JSON.
+type AuditEvent struct {
+	ID         int             `json:"id"`
+	ActorID    int             `json:"actor_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int             `json:"entity_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditQuery narrows down the audit log. Zero values match everything.
+type AuditQuery struct {
+	Entity   string
+	EntityID int
+	Actor    int
+	Since    time.Time
+	Page     int
+	PageSize int
+}
+
+// AuditPage is one page of the audit log
+type AuditPage struct {
+	Events   []AuditEvent `json:"events"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int          `json:"total"`
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ListUsers returns every user, with whether they are logged in
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	body, _, err := c.do(ctx, request{method: http.MethodGet, path: "/v1/users", auth: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Users []User `json:"users"`
+	}
+	if err := decodeData(body, &list); err != nil {
+		return nil, err
+	}
+
+	return list.Users, nil
+}
+
+// GetUser returns the user with id
+func (c *Client) GetUser(ctx context.Context, id int) (*User, error) {
+	return c.user(ctx, request{method: http.MethodGet, path: userPath(id), auth: true})
+}
+
+// CreateUser creates a user, and returns it as it was saved
+func (c *Client) CreateUser(ctx context.Context, user UserInput) (*User, error) {
+	user.Version = 0
+	return c.user(ctx, request{method: http.MethodPost, path: "/v1/users", body: user, auth: true})
+}
+
+// ReplaceUser replaces the user with id, clearing anything user leaves out apart from the
+// password. user.Version must be the version the replacement is based on, as for ReplaceFood.
+func (c *Client) ReplaceUser(ctx context.Context, id int, user UserInput) (*User, error) {
+	return c.user(ctx, request{method: http.MethodPut, path: userPath(id), body: user, auth: true})
+}
+
+// PatchUser changes the fields of the user with id which patch names, provided the user is
+// still at version. A patch cannot change the password.
+func (c *Client) PatchUser(ctx context.Context, id, version int, patch Patch) (*User, error) {
+	return c.user(ctx, request{
+		method:      http.MethodPatch,
+		path:        userPath(id),
+		body:        patch,
+		contentType: patch.mediaType(),
+		header:      ifMatch(version),
+		auth:        true,
+	})
+}
+
+// DeleteUser deletes the user with id
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	_, _, err := c.do(ctx, request{method: http.MethodDelete, path: userPath(id), auth: true})
+	return err
+}
+
+// LogUserOut logs the user with id out everywhere, and makes them inactive
+func (c *Client) LogUserOut(ctx context.Context, id int) error {
+	_, _, err := c.do(ctx, request{method: http.MethodPost, path: "/admin/log-user-out/" + strconv.Itoa(id), auth: true})
+	return err
+}
+
+// user sends r, and decodes the user in the response, which is not wrapped in an envelope
+func (c *Client) user(ctx context.Context, r request) (*User, error) {
+	body, _, err := c.do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := json.Unmarshal(body, &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func userPath(id int) string {
+	return "/v1/users/" + strconv.Itoa(id)
+}
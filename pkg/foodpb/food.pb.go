@@ -0,0 +1,1020 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: food/v1/food.proto
+
+package foodpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Food is a dish, where it comes from and what it tastes like.
+type Food struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Id      int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	KnownAs string                 `protobuf:"bytes,2,opt,name=known_as,json=knownAs,proto3" json:"known_as,omitempty"`
+	// slug is the name of the food as used in URLs.
+	Slug        string                 `protobuf:"bytes,3,opt,name=slug,proto3" json:"slug,omitempty"`
+	MakeYear    int32                  `protobuf:"varint,4,opt,name=make_year,json=makeYear,proto3" json:"make_year,omitempty"`
+	Description string                 `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	Country     *Country               `protobuf:"bytes,6,opt,name=country,proto3" json:"country,omitempty"`
+	Tastes      []*Taste               `protobuf:"bytes,7,rep,name=tastes,proto3" json:"tastes,omitempty"`
+	CreatedAt   *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt   *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	// version goes up with every change, and is given back to UpdateFood.
+	Version       int32 `protobuf:"varint,10,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Food) Reset() {
+	*x = Food{}
+	mi := &file_food_v1_food_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Food) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Food) ProtoMessage() {}
+
+func (x *Food) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Food.ProtoReflect.Descriptor instead.
+func (*Food) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Food) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Food) GetKnownAs() string {
+	if x != nil {
+		return x.KnownAs
+	}
+	return ""
+}
+
+func (x *Food) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *Food) GetMakeYear() int32 {
+	if x != nil {
+		return x.MakeYear
+	}
+	return 0
+}
+
+func (x *Food) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Food) GetCountry() *Country {
+	if x != nil {
+		return x.Country
+	}
+	return nil
+}
+
+func (x *Food) GetTastes() []*Taste {
+	if x != nil {
+		return x.Tastes
+	}
+	return nil
+}
+
+func (x *Food) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *Food) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *Food) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+// Country is a country a food may come from.
+type Country struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Country) Reset() {
+	*x = Country{}
+	mi := &file_food_v1_food_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Country) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Country) ProtoMessage() {}
+
+func (x *Country) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Country.ProtoReflect.Descriptor instead.
+func (*Country) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Country) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Country) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// Taste is a taste a food may have.
+type Taste struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Taste) Reset() {
+	*x = Taste{}
+	mi := &file_food_v1_food_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Taste) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Taste) ProtoMessage() {}
+
+func (x *Taste) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Taste.ProtoReflect.Descriptor instead.
+func (*Taste) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Taste) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Taste) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// FoodInput is a food as it is created or updated.
+type FoodInput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	KnownAs       string                 `protobuf:"bytes,1,opt,name=known_as,json=knownAs,proto3" json:"known_as,omitempty"`
+	CountryId     int32                  `protobuf:"varint,2,opt,name=country_id,json=countryId,proto3" json:"country_id,omitempty"`
+	MakeYear      int32                  `protobuf:"varint,3,opt,name=make_year,json=makeYear,proto3" json:"make_year,omitempty"`
+	Description   string                 `protobuf:"bytes,4,opt,name=description,proto3" json:"description,omitempty"`
+	TasteIds      []int32                `protobuf:"varint,5,rep,packed,name=taste_ids,json=tasteIds,proto3" json:"taste_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FoodInput) Reset() {
+	*x = FoodInput{}
+	mi := &file_food_v1_food_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FoodInput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FoodInput) ProtoMessage() {}
+
+func (x *FoodInput) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FoodInput.ProtoReflect.Descriptor instead.
+func (*FoodInput) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FoodInput) GetKnownAs() string {
+	if x != nil {
+		return x.KnownAs
+	}
+	return ""
+}
+
+func (x *FoodInput) GetCountryId() int32 {
+	if x != nil {
+		return x.CountryId
+	}
+	return 0
+}
+
+func (x *FoodInput) GetMakeYear() int32 {
+	if x != nil {
+		return x.MakeYear
+	}
+	return 0
+}
+
+func (x *FoodInput) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *FoodInput) GetTasteIds() []int32 {
+	if x != nil {
+		return x.TasteIds
+	}
+	return nil
+}
+
+type ListFoodsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// country_id, if set, returns only the foods from that country.
+	CountryId int32 `protobuf:"varint,1,opt,name=country_id,json=countryId,proto3" json:"country_id,omitempty"`
+	// taste_id, if set, returns only the foods with that taste.
+	TasteId int32 `protobuf:"varint,2,opt,name=taste_id,json=tasteId,proto3" json:"taste_id,omitempty"`
+	// search, if set, returns only the foods whose name contains it, ignoring case.
+	Search        string `protobuf:"bytes,3,opt,name=search,proto3" json:"search,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFoodsRequest) Reset() {
+	*x = ListFoodsRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFoodsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFoodsRequest) ProtoMessage() {}
+
+func (x *ListFoodsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFoodsRequest.ProtoReflect.Descriptor instead.
+func (*ListFoodsRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListFoodsRequest) GetCountryId() int32 {
+	if x != nil {
+		return x.CountryId
+	}
+	return 0
+}
+
+func (x *ListFoodsRequest) GetTasteId() int32 {
+	if x != nil {
+		return x.TasteId
+	}
+	return 0
+}
+
+func (x *ListFoodsRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+type ListFoodsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Foods         []*Food                `protobuf:"bytes,1,rep,name=foods,proto3" json:"foods,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListFoodsResponse) Reset() {
+	*x = ListFoodsResponse{}
+	mi := &file_food_v1_food_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListFoodsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFoodsResponse) ProtoMessage() {}
+
+func (x *ListFoodsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFoodsResponse.ProtoReflect.Descriptor instead.
+func (*ListFoodsResponse) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListFoodsResponse) GetFoods() []*Food {
+	if x != nil {
+		return x.Foods
+	}
+	return nil
+}
+
+type GetFoodRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Lookup:
+	//
+	//	*GetFoodRequest_Id
+	//	*GetFoodRequest_Slug
+	Lookup        isGetFoodRequest_Lookup `protobuf_oneof:"lookup"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetFoodRequest) Reset() {
+	*x = GetFoodRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetFoodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFoodRequest) ProtoMessage() {}
+
+func (x *GetFoodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFoodRequest.ProtoReflect.Descriptor instead.
+func (*GetFoodRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetFoodRequest) GetLookup() isGetFoodRequest_Lookup {
+	if x != nil {
+		return x.Lookup
+	}
+	return nil
+}
+
+func (x *GetFoodRequest) GetId() int32 {
+	if x != nil {
+		if x, ok := x.Lookup.(*GetFoodRequest_Id); ok {
+			return x.Id
+		}
+	}
+	return 0
+}
+
+func (x *GetFoodRequest) GetSlug() string {
+	if x != nil {
+		if x, ok := x.Lookup.(*GetFoodRequest_Slug); ok {
+			return x.Slug
+		}
+	}
+	return ""
+}
+
+type isGetFoodRequest_Lookup interface {
+	isGetFoodRequest_Lookup()
+}
+
+type GetFoodRequest_Id struct {
+	Id int32 `protobuf:"varint,1,opt,name=id,proto3,oneof"`
+}
+
+type GetFoodRequest_Slug struct {
+	Slug string `protobuf:"bytes,2,opt,name=slug,proto3,oneof"`
+}
+
+func (*GetFoodRequest_Id) isGetFoodRequest_Lookup() {}
+
+func (*GetFoodRequest_Slug) isGetFoodRequest_Lookup() {}
+
+type ListCountriesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCountriesRequest) Reset() {
+	*x = ListCountriesRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCountriesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCountriesRequest) ProtoMessage() {}
+
+func (x *ListCountriesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCountriesRequest.ProtoReflect.Descriptor instead.
+func (*ListCountriesRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{7}
+}
+
+type ListCountriesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Countries     []*Country             `protobuf:"bytes,1,rep,name=countries,proto3" json:"countries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListCountriesResponse) Reset() {
+	*x = ListCountriesResponse{}
+	mi := &file_food_v1_food_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListCountriesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListCountriesResponse) ProtoMessage() {}
+
+func (x *ListCountriesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListCountriesResponse.ProtoReflect.Descriptor instead.
+func (*ListCountriesResponse) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListCountriesResponse) GetCountries() []*Country {
+	if x != nil {
+		return x.Countries
+	}
+	return nil
+}
+
+type ListTastesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTastesRequest) Reset() {
+	*x = ListTastesRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTastesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTastesRequest) ProtoMessage() {}
+
+func (x *ListTastesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTastesRequest.ProtoReflect.Descriptor instead.
+func (*ListTastesRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{9}
+}
+
+type ListTastesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tastes        []*Taste               `protobuf:"bytes,1,rep,name=tastes,proto3" json:"tastes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListTastesResponse) Reset() {
+	*x = ListTastesResponse{}
+	mi := &file_food_v1_food_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListTastesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTastesResponse) ProtoMessage() {}
+
+func (x *ListTastesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTastesResponse.ProtoReflect.Descriptor instead.
+func (*ListTastesResponse) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListTastesResponse) GetTastes() []*Taste {
+	if x != nil {
+		return x.Tastes
+	}
+	return nil
+}
+
+type CreateFoodRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Food          *FoodInput             `protobuf:"bytes,1,opt,name=food,proto3" json:"food,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateFoodRequest) Reset() {
+	*x = CreateFoodRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateFoodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateFoodRequest) ProtoMessage() {}
+
+func (x *CreateFoodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateFoodRequest.ProtoReflect.Descriptor instead.
+func (*CreateFoodRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateFoodRequest) GetFood() *FoodInput {
+	if x != nil {
+		return x.Food
+	}
+	return nil
+}
+
+type UpdateFoodRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// version is the version of the food the change is based on.
+	Version       int32      `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	Food          *FoodInput `protobuf:"bytes,3,opt,name=food,proto3" json:"food,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateFoodRequest) Reset() {
+	*x = UpdateFoodRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateFoodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateFoodRequest) ProtoMessage() {}
+
+func (x *UpdateFoodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateFoodRequest.ProtoReflect.Descriptor instead.
+func (*UpdateFoodRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UpdateFoodRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *UpdateFoodRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *UpdateFoodRequest) GetFood() *FoodInput {
+	if x != nil {
+		return x.Food
+	}
+	return nil
+}
+
+type DeleteFoodRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFoodRequest) Reset() {
+	*x = DeleteFoodRequest{}
+	mi := &file_food_v1_food_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFoodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFoodRequest) ProtoMessage() {}
+
+func (x *DeleteFoodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFoodRequest.ProtoReflect.Descriptor instead.
+func (*DeleteFoodRequest) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DeleteFoodRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type DeleteFoodResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteFoodResponse) Reset() {
+	*x = DeleteFoodResponse{}
+	mi := &file_food_v1_food_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteFoodResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteFoodResponse) ProtoMessage() {}
+
+func (x *DeleteFoodResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_food_v1_food_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteFoodResponse.ProtoReflect.Descriptor instead.
+func (*DeleteFoodResponse) Descriptor() ([]byte, []int) {
+	return file_food_v1_food_proto_rawDescGZIP(), []int{14}
+}
+
+var File_food_v1_food_proto protoreflect.FileDescriptor
+
+const file_food_v1_food_proto_rawDesc = "" +
+	"\n" +
+	"\x12food/v1/food.proto\x12\afood.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe8\x02\n" +
+	"\x04Food\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x19\n" +
+	"\bknown_as\x18\x02 \x01(\tR\aknownAs\x12\x12\n" +
+	"\x04slug\x18\x03 \x01(\tR\x04slug\x12\x1b\n" +
+	"\tmake_year\x18\x04 \x01(\x05R\bmakeYear\x12 \n" +
+	"\vdescription\x18\x05 \x01(\tR\vdescription\x12*\n" +
+	"\acountry\x18\x06 \x01(\v2\x10.food.v1.CountryR\acountry\x12&\n" +
+	"\x06tastes\x18\a \x03(\v2\x0e.food.v1.TasteR\x06tastes\x129\n" +
+	"\n" +
+	"created_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x12\x18\n" +
+	"\aversion\x18\n" +
+	" \x01(\x05R\aversion\"-\n" +
+	"\aCountry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"+\n" +
+	"\x05Taste\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"\xa1\x01\n" +
+	"\tFoodInput\x12\x19\n" +
+	"\bknown_as\x18\x01 \x01(\tR\aknownAs\x12\x1d\n" +
+	"\n" +
+	"country_id\x18\x02 \x01(\x05R\tcountryId\x12\x1b\n" +
+	"\tmake_year\x18\x03 \x01(\x05R\bmakeYear\x12 \n" +
+	"\vdescription\x18\x04 \x01(\tR\vdescription\x12\x1b\n" +
+	"\ttaste_ids\x18\x05 \x03(\x05R\btasteIds\"d\n" +
+	"\x10ListFoodsRequest\x12\x1d\n" +
+	"\n" +
+	"country_id\x18\x01 \x01(\x05R\tcountryId\x12\x19\n" +
+	"\btaste_id\x18\x02 \x01(\x05R\atasteId\x12\x16\n" +
+	"\x06search\x18\x03 \x01(\tR\x06search\"8\n" +
+	"\x11ListFoodsResponse\x12#\n" +
+	"\x05foods\x18\x01 \x03(\v2\r.food.v1.FoodR\x05foods\"B\n" +
+	"\x0eGetFoodRequest\x12\x10\n" +
+	"\x02id\x18\x01 \x01(\x05H\x00R\x02id\x12\x14\n" +
+	"\x04slug\x18\x02 \x01(\tH\x00R\x04slugB\b\n" +
+	"\x06lookup\"\x16\n" +
+	"\x14ListCountriesRequest\"G\n" +
+	"\x15ListCountriesResponse\x12.\n" +
+	"\tcountries\x18\x01 \x03(\v2\x10.food.v1.CountryR\tcountries\"\x13\n" +
+	"\x11ListTastesRequest\"<\n" +
+	"\x12ListTastesResponse\x12&\n" +
+	"\x06tastes\x18\x01 \x03(\v2\x0e.food.v1.TasteR\x06tastes\";\n" +
+	"\x11CreateFoodRequest\x12&\n" +
+	"\x04food\x18\x01 \x01(\v2\x12.food.v1.FoodInputR\x04food\"e\n" +
+	"\x11UpdateFoodRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x05R\aversion\x12&\n" +
+	"\x04food\x18\x03 \x01(\v2\x12.food.v1.FoodInputR\x04food\"#\n" +
+	"\x11DeleteFoodRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"\x14\n" +
+	"\x12DeleteFoodResponse2\xd4\x03\n" +
+	"\vFoodService\x12B\n" +
+	"\tListFoods\x12\x19.food.v1.ListFoodsRequest\x1a\x1a.food.v1.ListFoodsResponse\x121\n" +
+	"\aGetFood\x12\x17.food.v1.GetFoodRequest\x1a\r.food.v1.Food\x12N\n" +
+	"\rListCountries\x12\x1d.food.v1.ListCountriesRequest\x1a\x1e.food.v1.ListCountriesResponse\x12E\n" +
+	"\n" +
+	"ListTastes\x12\x1a.food.v1.ListTastesRequest\x1a\x1b.food.v1.ListTastesResponse\x127\n" +
+	"\n" +
+	"CreateFood\x12\x1a.food.v1.CreateFoodRequest\x1a\r.food.v1.Food\x127\n" +
+	"\n" +
+	"UpdateFood\x12\x1a.food.v1.UpdateFoodRequest\x1a\r.food.v1.Food\x12E\n" +
+	"\n" +
+	"DeleteFood\x12\x1a.food.v1.DeleteFoodRequest\x1a\x1b.food.v1.DeleteFoodResponseB\x1cZ\x1agithub.com/food/pkg/foodpbb\x06proto3"
+
+var (
+	file_food_v1_food_proto_rawDescOnce sync.Once
+	file_food_v1_food_proto_rawDescData []byte
+)
+
+func file_food_v1_food_proto_rawDescGZIP() []byte {
+	file_food_v1_food_proto_rawDescOnce.Do(func() {
+		file_food_v1_food_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_food_v1_food_proto_rawDesc), len(file_food_v1_food_proto_rawDesc)))
+	})
+	return file_food_v1_food_proto_rawDescData
+}
+
+var file_food_v1_food_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_food_v1_food_proto_goTypes = []any{
+	(*Food)(nil),                  // 0: food.v1.Food
+	(*Country)(nil),               // 1: food.v1.Country
+	(*Taste)(nil),                 // 2: food.v1.Taste
+	(*FoodInput)(nil),             // 3: food.v1.FoodInput
+	(*ListFoodsRequest)(nil),      // 4: food.v1.ListFoodsRequest
+	(*ListFoodsResponse)(nil),     // 5: food.v1.ListFoodsResponse
+	(*GetFoodRequest)(nil),        // 6: food.v1.GetFoodRequest
+	(*ListCountriesRequest)(nil),  // 7: food.v1.ListCountriesRequest
+	(*ListCountriesResponse)(nil), // 8: food.v1.ListCountriesResponse
+	(*ListTastesRequest)(nil),     // 9: food.v1.ListTastesRequest
+	(*ListTastesResponse)(nil),    // 10: food.v1.ListTastesResponse
+	(*CreateFoodRequest)(nil),     // 11: food.v1.CreateFoodRequest
+	(*UpdateFoodRequest)(nil),     // 12: food.v1.UpdateFoodRequest
+	(*DeleteFoodRequest)(nil),     // 13: food.v1.DeleteFoodRequest
+	(*DeleteFoodResponse)(nil),    // 14: food.v1.DeleteFoodResponse
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_food_v1_food_proto_depIdxs = []int32{
+	1,  // 0: food.v1.Food.country:type_name -> food.v1.Country
+	2,  // 1: food.v1.Food.tastes:type_name -> food.v1.Taste
+	15, // 2: food.v1.Food.created_at:type_name -> google.protobuf.Timestamp
+	15, // 3: food.v1.Food.updated_at:type_name -> google.protobuf.Timestamp
+	0,  // 4: food.v1.ListFoodsResponse.foods:type_name -> food.v1.Food
+	1,  // 5: food.v1.ListCountriesResponse.countries:type_name -> food.v1.Country
+	2,  // 6: food.v1.ListTastesResponse.tastes:type_name -> food.v1.Taste
+	3,  // 7: food.v1.CreateFoodRequest.food:type_name -> food.v1.FoodInput
+	3,  // 8: food.v1.UpdateFoodRequest.food:type_name -> food.v1.FoodInput
+	4,  // 9: food.v1.FoodService.ListFoods:input_type -> food.v1.ListFoodsRequest
+	6,  // 10: food.v1.FoodService.GetFood:input_type -> food.v1.GetFoodRequest
+	7,  // 11: food.v1.FoodService.ListCountries:input_type -> food.v1.ListCountriesRequest
+	9,  // 12: food.v1.FoodService.ListTastes:input_type -> food.v1.ListTastesRequest
+	11, // 13: food.v1.FoodService.CreateFood:input_type -> food.v1.CreateFoodRequest
+	12, // 14: food.v1.FoodService.UpdateFood:input_type -> food.v1.UpdateFoodRequest
+	13, // 15: food.v1.FoodService.DeleteFood:input_type -> food.v1.DeleteFoodRequest
+	5,  // 16: food.v1.FoodService.ListFoods:output_type -> food.v1.ListFoodsResponse
+	0,  // 17: food.v1.FoodService.GetFood:output_type -> food.v1.Food
+	8,  // 18: food.v1.FoodService.ListCountries:output_type -> food.v1.ListCountriesResponse
+	10, // 19: food.v1.FoodService.ListTastes:output_type -> food.v1.ListTastesResponse
+	0,  // 20: food.v1.FoodService.CreateFood:output_type -> food.v1.Food
+	0,  // 21: food.v1.FoodService.UpdateFood:output_type -> food.v1.Food
+	14, // 22: food.v1.FoodService.DeleteFood:output_type -> food.v1.DeleteFoodResponse
+	16, // [16:23] is the sub-list for method output_type
+	9,  // [9:16] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_food_v1_food_proto_init() }
+func file_food_v1_food_proto_init() {
+	if File_food_v1_food_proto != nil {
+		return
+	}
+	file_food_v1_food_proto_msgTypes[6].OneofWrappers = []any{
+		(*GetFoodRequest_Id)(nil),
+		(*GetFoodRequest_Slug)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_food_v1_food_proto_rawDesc), len(file_food_v1_food_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_food_v1_food_proto_goTypes,
+		DependencyIndexes: file_food_v1_food_proto_depIdxs,
+		MessageInfos:      file_food_v1_food_proto_msgTypes,
+	}.Build()
+	File_food_v1_food_proto = out.File
+	file_food_v1_food_proto_goTypes = nil
+	file_food_v1_food_proto_depIdxs = nil
+}